@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/psteitz/ifs/engine"
+)
+
+// anonLimits are the largest request parameters a request without an API key may give when
+// the server has API keys (see keyGated).  A limit of 0 means none.
+type anonLimits struct {
+	MaxSize      int `json:"maxSize"`      // size, and the width and height of /palette
+	MaxFrames    int `json:"maxFrames"`    // Frames of an animation: numframes, or the c values of a POST
+	MaxPrecision int `json:"maxPrecision"` // precision
+	MaxIter      int `json:"maxIter"`      // maxiter
+	MaxAA        int `json:"maxAA"`        // aa, the supersampling factor
+	MaxPoints    int `json:"maxPoints"`    // iterations of /ifs, the number of points plotted
+	MaxCells     int `json:"maxCells"`     // rows and cols of /montage and of /explore viewports
+}
+
+var (
+	// apiKeys holds the SHA-256 hashes of the API keys of the server, from the apiKeys setting
+	// of the config file.  Hashing them lets keys be looked up without the time the lookup
+	// takes hinting at their contents.
+	apiKeys = map[[sha256.Size]byte]bool{}
+	// anonymous limits the requests without an API key, if there are API keys.
+	anonymous = anonLimits{MaxSize: engine.DefaultSize, MaxFrames: 64, MaxPrecision: 53, MaxAA: 2,
+		MaxPoints: engine.DefaultIFSIterations, MaxCells: engine.DefaultMontageCells}
+)
+
+// setAPIKeys replaces the API keys of the server by keys.
+func setAPIKeys(keys []string) {
+	apiKeys = map[[sha256.Size]byte]bool{}
+	for _, key := range keys {
+		apiKeys[sha256.Sum256([]byte(key))] = true
+	}
+}
+
+// keyGated wraps h, the handler of an endpoint that renders, so that requests whose X-API-Key
+// header does not hold one of apiKeys may only ask for as much as anonymous allows.  Requests
+// for more, and requests with a key the server does not have, get a 401 response listing the
+// problems, in the JSON form of strict mode.  It returns h itself if the server has no API keys.
+func keyGated(h http.HandlerFunc) http.HandlerFunc {
+	if len(apiKeys) == 0 {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var problems []engine.ParamError
+		if key := r.Header.Get("X-API-Key"); key != "" {
+			if !apiKeys[sha256.Sum256([]byte(key))] {
+				problems = append(problems, engine.ParamError{Message: "unknown API key"})
+			}
+		} else {
+			problems = anonymous.check(r)
+		}
+		if len(problems) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(struct {
+				Errors []engine.ParamError `json:"errors"`
+			}{problems})
+			return
+		}
+		h(w, r)
+	}
+}
+
+// check returns the parameters of r over the limits (see checkQuery).  The c values in the body
+// of a POST are counted, and the body put back for the handler.
+func (l anonLimits) check(r *http.Request) []engine.ParamError {
+	problems := l.checkQuery(r.URL.Path, r.URL.Query())
+	if r.Method == http.MethodPost && l.MaxFrames > 0 {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var cs []json.RawMessage
+		if err == nil && json.Unmarshal(body, &cs) == nil {
+			if len(cs) > l.MaxFrames {
+				problems = append(problems, overLimit("body", "number of c values", l.MaxFrames))
+			}
+		}
+	}
+	return problems
+}
+
+// checkQuery returns the parameters of query, for the endpoint at path, over the limits.  Values
+// that are not numbers are left to the handler, which replaces them by their defaults, as it does
+// missing ones.  rows and cols are only limited where they multiply the work of a request: the
+// rows and cols of /tile just say which part of the window a single tile covers.
+func (l anonLimits) checkQuery(path string, query url.Values) []engine.ParamError {
+	var problems []engine.ParamError
+	param := func(name string, limit int) {
+		if v, err := strconv.Atoi(query.Get(name)); err == nil && limit > 0 && v > limit {
+			problems = append(problems, overLimit(name, name, limit))
+		}
+	}
+	param("size", l.MaxSize)
+	param("width", l.MaxSize)
+	param("height", l.MaxSize)
+	param("numframes", l.MaxFrames)
+	param("precision", l.MaxPrecision)
+	param("maxiter", l.MaxIter)
+	param("aa", l.MaxAA)
+	param("iterations", l.MaxPoints)
+	if path == "/montage" || path == "/explore" {
+		param("rows", l.MaxCells)
+		param("cols", l.MaxCells)
+	}
+	return problems
+}
+
+// overLimit returns the problem with the parameter name, whose value, described by what, is
+// over limit.
+func overLimit(name, what string, limit int) engine.ParamError {
+	return engine.ParamError{Param: name, Message: fmt.Sprintf("%s over %d needs an API key (X-API-Key header)", what, limit)}
+}
+
+// anonymousProblems returns the parameters of query over the anonymous limits, if the server has
+// API keys and r, which passed keyGated, did not give one.
+func anonymousProblems(r *http.Request, query url.Values) []engine.ParamError {
+	if len(apiKeys) == 0 || r.Header.Get("X-API-Key") != "" {
+		return nil
+	}
+	return anonymous.checkQuery(r.URL.Path, query)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Without a key, every parameter that multiplies the work of a request is held to the anonymous
+// limits; with one, it is left to the handler.
+func TestAnonymousLimits(t *testing.T) {
+	defer setAPIKeys(nil)
+	setAPIKeys([]string{"secret"})
+	h := keyGated(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		url  string
+		anon int // status without a key
+	}{
+		{"/julia?size=64&aa=2", http.StatusOK},
+		{"/julia?size=4096", http.StatusUnauthorized},
+		{"/julia?aa=4", http.StatusUnauthorized},
+		{"/mandelbrot?aa=3", http.StatusUnauthorized},
+		{"/ifs?iterations=2000000", http.StatusOK},
+		{"/ifs?iterations=100000000", http.StatusUnauthorized},
+		{"/montage?rows=4&cols=4", http.StatusOK},
+		{"/montage?rows=16", http.StatusUnauthorized},
+		{"/montage?cols=16", http.StatusUnauthorized},
+		{"/montage?size=4096", http.StatusUnauthorized},
+		{"/tile?rows=16&cols=16", http.StatusOK}, // a single tile, however the window is cut up
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", tt.url, nil))
+		if rec.Code != tt.anon {
+			t.Errorf("%s without a key: status %d (%s), want %d", tt.url, rec.Code, rec.Body, tt.anon)
+		}
+		rec = httptest.NewRecorder()
+		r := httptest.NewRequest("GET", tt.url, nil)
+		r.Header.Set("X-API-Key", "secret")
+		h(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s with a key: status %d (%s), want 200", tt.url, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/psteitz/ifs/engine"
+)
+
+// Server-wide bounds on request parameters, lowered from the engine's own limits by the
+// maxSize and maxIter settings of the config file.
+var (
+	sizeLimit = engine.MaxSize
+	iterLimit = engine.MaxIterLimit
+)
+
+// Config holds the server settings read from the file named by the -config flag.  Its fields
+// are all optional: flags given on the command line override the settings of the server, and
+// request parameters override Defaults.
+type Config struct {
+	Addr         string   `json:"addr"`         // Address to listen on, as for -addr
+	CacheSize    *int     `json:"cacheSize"`    // Maximum number of cached images, as for -cachesize
+	MaxRenders   int      `json:"maxRenders"`   // Maximum number of renders at once, as for -maxrenders
+	QueueTimeout duration `json:"queueTimeout"` // How long requests wait for a render, as for -queuetimeout
+	RateLimit    float64  `json:"rateLimit"`    // Requests a second per client, as for -ratelimit
+	RateBurst    int      `json:"rateBurst"`    // Requests a client may make at once, as for -rateburst
+	TrustProxy   bool     `json:"trustProxy"`   // Whether to honor X-Forwarded-For, as for -trustproxy
+	// APIKeys, if any, are the keys that lift the limits of Anonymous on the endpoints that
+	// render, given in the X-API-Key header of a request (see keyGated).
+	APIKeys   []string    `json:"apiKeys"`
+	Anonymous *anonLimits `json:"anonymous"`
+	// AllowedOrigins are the origins, other than the server's own, whose pages may connect
+	// to /explore (see checkOrigin).
+	AllowedOrigins []string `json:"allowedOrigins"`
+	// MaxSize and MaxIter lower the largest image size and iteration cap accepted from a
+	// request below the engine's limits, engine.MaxSize and engine.MaxIterLimit.
+	MaxSize int `json:"maxSize"`
+	MaxIter int `json:"maxIter"`
+	// Defaults holds default values of request parameters, by endpoint path, with "*" for every
+	// endpoint.  Values may be strings, numbers or booleans.  Requests that leave a parameter
+	// out get its default here, for the endpoint first, as if they had given it.
+	Defaults map[string]map[string]any `json:"defaults"`
+}
+
+// duration is a time.Duration read from a JSON string such as "10s".
+type duration time.Duration
+
+// UnmarshalJSON reads d from a string in the format of time.ParseDuration.
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"10s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// loadConfig reads the config file at path.  Unknown settings are an error, so that a
+// misspelled one is not silently ignored.
+func loadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	limits := anonymous // limits left out of the file keep their defaults
+	cfg := Config{Anonymous: &limits}
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if cfg.MaxSize < 0 || cfg.MaxIter < 0 || cfg.MaxRenders < 0 || (cfg.CacheSize != nil && *cfg.CacheSize < 0) ||
+		cfg.RateLimit < 0 || cfg.RateBurst < 0 ||
+		limits.MaxSize < 0 || limits.MaxFrames < 0 || limits.MaxPrecision < 0 || limits.MaxIter < 0 ||
+		limits.MaxAA < 0 || limits.MaxPoints < 0 || limits.MaxCells < 0 {
+		return nil, fmt.Errorf("%s: maxSize, maxIter, maxRenders, cacheSize, rateLimit, rateBurst and the anonymous limits must not be negative", path)
+	}
+	if _, err := cfg.defaultValues(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &cfg, nil
+}
+
+// defaultValues returns cfg.Defaults as request parameter values.
+func (cfg *Config) defaultValues() (map[string]url.Values, error) {
+	defaults := make(map[string]url.Values, len(cfg.Defaults))
+	for path, params := range cfg.Defaults {
+		values := url.Values{}
+		for name, v := range params {
+			switch v := v.(type) {
+			case string:
+				values.Set(name, v)
+			case float64:
+				values.Set(name, strconv.FormatFloat(v, 'g', -1, 64))
+			case bool:
+				values.Set(name, strconv.FormatBool(v))
+			default:
+				return nil, fmt.Errorf("default %s for %s must be a string, number or boolean", name, path)
+			}
+		}
+		defaults[path] = values
+	}
+	return defaults, nil
+}
+
+// applyLimits lowers the bounds on request parameters to those of cfg.
+func (cfg *Config) applyLimits() {
+	if cfg.MaxSize > 0 {
+		sizeLimit = min(cfg.MaxSize, engine.MaxSize)
+	}
+	if cfg.MaxIter > 0 {
+		iterLimit = min(cfg.MaxIter, engine.MaxIterLimit)
+	}
+}
+
+// withDefaults serves requests with next after filling in the parameters they leave out from
+// defaults: those for the path of the endpoint (less any /info suffix) first, then those for "*".
+// The defaults are checked and clamped like any other request parameters.
+func withDefaults(defaults map[string]url.Values, next http.Handler) http.Handler {
+	if len(defaults) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		added := false
+		for _, path := range []string{strings.TrimSuffix(r.URL.Path, "/info"), "*"} {
+			for name, values := range defaults[path] {
+				if !query.Has(name) {
+					query[name] = values
+					added = true
+				}
+			}
+		}
+		if added {
+			r = r.Clone(r.Context())
+			r.URL.RawQuery = query.Encode()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	DefaultPreset        = "fern"    // Affine IFS rendered when none (or an unknown one) is requested
+	DefaultIFSIterations = 2000000   // Default number of chaos game iterations
+	MaxIFSIterations     = 200000000 // Largest number of chaos game iterations accepted from a request
+	chaosWarmup          = 20        // Iterations run before plotting, to land on the attractor
+	chaosSeed            = 1         // Seed of the chaos game, fixed so that renders are repeatable
+)
+
+// Coloring modes of the chaos game, selected by RenderParams.Color
+const (
+	ChaosDensity = "density" // Color pixels by how often they are hit
+	ChaosRecency = "recency" // Color pixels by how recently they were last hit
+)
+
+// ValidChaosColor reports whether mode is a coloring mode of the chaos game.
+func ValidChaosColor(mode string) bool {
+	return mode == ChaosDensity || mode == ChaosRecency
+}
+
+// AffineMap is the affine transformation (x, y) -> (A*x + B*y + E, C*x + D*y + F).
+type AffineMap struct {
+	A, B, C, D, E, F float64
+}
+
+// apply returns the image of (x, y) under m.
+func (m AffineMap) apply(x, y float64) (float64, float64) {
+	return m.A*x + m.B*y + m.E, m.C*x + m.D*y + m.F
+}
+
+// An AffineIFS is an iterated function system made of affine maps, each chosen with the given
+// probability (relative to the sum of Probs) at every step of the chaos game.  View is a window that frames its attractor.
+type AffineIFS struct {
+	Maps  []AffineMap
+	Probs []float64
+	View  Viewport
+}
+
+// affinePresets is the registry of available affine IFSs, keyed by name.
+var affinePresets = map[string]AffineIFS{
+	// Barnsley's fern, from https://en.wikipedia.org/wiki/Barnsley_fern
+	"fern": {
+		Maps: []AffineMap{
+			{0, 0, 0, 0.16, 0, 0},              // stem
+			{0.85, 0.04, -0.04, 0.85, 0, 1.6},  // successively smaller leaflets
+			{0.2, -0.26, 0.23, 0.22, 0, 1.6},   // largest left-hand leaflet
+			{-0.15, 0.28, 0.26, 0.24, 0, 0.44}, // largest right-hand leaflet
+		},
+		Probs: []float64{0.01, 0.85, 0.07, 0.07},
+		View:  Viewport{-5.25, -0.25, 5.25, 10.25},
+	},
+	// The Sierpinski triangle: each map moves halfway towards one corner of the triangle
+	"sierpinski-triangle": sierpinskiTriangle,
+	"sierpinski":          sierpinskiTriangle, // the original name of sierpinski-triangle
+	// The Sierpinski carpet: each map shrinks the unit square into one of the eight outer squares
+	// of a 3x3 grid, leaving out the middle one
+	"sierpinski-carpet": {
+		Maps: []AffineMap{
+			{1.0 / 3, 0, 0, 1.0 / 3, 0, 0},
+			{1.0 / 3, 0, 0, 1.0 / 3, 1.0 / 3, 0},
+			{1.0 / 3, 0, 0, 1.0 / 3, 2.0 / 3, 0},
+			{1.0 / 3, 0, 0, 1.0 / 3, 0, 1.0 / 3},
+			{1.0 / 3, 0, 0, 1.0 / 3, 2.0 / 3, 1.0 / 3},
+			{1.0 / 3, 0, 0, 1.0 / 3, 0, 2.0 / 3},
+			{1.0 / 3, 0, 0, 1.0 / 3, 1.0 / 3, 2.0 / 3},
+			{1.0 / 3, 0, 0, 1.0 / 3, 2.0 / 3, 2.0 / 3},
+		},
+		Probs: []float64{1, 1, 1, 1, 1, 1, 1, 1},
+		View:  Viewport{-0.05, -0.05, 1.05, 1.05},
+	},
+}
+
+var sierpinskiTriangle = AffineIFS{
+	Maps: []AffineMap{
+		{0.5, 0, 0, 0.5, 0, 0},
+		{0.5, 0, 0, 0.5, 0.5, 0},
+		{0.5, 0, 0, 0.5, 0.25, 0.5},
+	},
+	Probs: []float64{1.0 / 3, 1.0 / 3, 1.0 / 3},
+	View:  Viewport{-0.05, -0.05, 1.05, 1.05},
+}
+
+// LookupPreset returns the affine IFS with the given name and true, or the default IFS and
+// false if there is no IFS with that name.
+func LookupPreset(name string) (AffineIFS, bool) {
+	ifs, ok := affinePresets[name]
+	if !ok {
+		return affinePresets[DefaultPreset], false
+	}
+	return ifs, true
+}
+
+// PresetNames returns the names of the registered affine IFSs in sorted order.
+func PresetNames() []string {
+	names := make([]string, 0, len(affinePresets))
+	for name := range affinePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ChaosGame renders the attractor of ifs with the chaos game and writes it to w.  Starting from
+// the origin, the game repeatedly applies a map of ifs chosen at random with the map's probability,
+// and plots each point it reaches in params.View over the given number of iterations.  Pixels
+// that are never hit are black; the others are colored with params.Palette.  With the
+// ChaosDensity coloring mode, the color is given by the logarithm of how often the pixel was
+// hit, relative to the most often hit pixel.  With ChaosRecency, it is given by when the pixel
+// was last hit, so that the pixels the game keeps coming back to are at the top of the palette
+// and those it has left behind fade towards the bottom.  Unlike the escape-time renderers, the
+// imaginary (y) axis points up.  The random sequence is fixed, so that equal requests give equal images.
+func ChaosGame(ifs AffineIFS, iterations int, params RenderParams, w io.Writer) {
+	width, height := params.Size, params.Size
+	view := params.View
+	recency := params.Color == ChaosRecency
+	counts := make([]uint32, width*height) // hit counts, or with recency, 1 + the iteration of the last hit
+
+	// cumulative probabilities, for choosing maps
+	cumulative := make([]float64, len(ifs.Probs))
+	total := 0.0
+	for i, p := range ifs.Probs {
+		total += p
+		cumulative[i] = total
+	}
+
+	rng := rand.New(rand.NewSource(chaosSeed))
+	var x, y float64
+	var maxCount uint32
+	for i := 0; i < iterations+chaosWarmup; i++ {
+		t := rng.Float64() * total
+		k := sort.SearchFloat64s(cumulative, t)
+		if k == len(ifs.Maps) {
+			k--
+		}
+		x, y = ifs.Maps[k].apply(x, y)
+		if i < chaosWarmup {
+			continue
+		}
+		if x < view.XMin || x >= view.XMax || y <= view.YMin || y > view.YMax {
+			continue
+		}
+		px := int((x - view.XMin) / (view.XMax - view.XMin) * float64(width))
+		py := int((view.YMax - y) / (view.YMax - view.YMin) * float64(height))
+		if px >= width || py >= height {
+			continue
+		}
+		if recency {
+			counts[py*width+px] = uint32(i - chaosWarmup + 1)
+		} else {
+			counts[py*width+px]++
+		}
+		maxCount = max(maxCount, counts[py*width+px])
+	}
+
+	pal := params.palette()
+	scale := math.Log1p(float64(maxCount))
+	img := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for py := 0; py < height; py++ {
+		for px := 0; px < width; px++ {
+			c := color.RGBA64{0, 0, 0, 60000}
+			if n := counts[py*width+px]; n > 0 {
+				if recency {
+					c = pal(float64(n) / float64(maxCount))
+				} else {
+					c = pal(math.Log1p(float64(n)) / scale)
+				}
+			}
+			img.SetRGBA64(px, py, c)
+		}
+	}
+	// The marks are drawn as on an escape-time image, with y pointing down, so reflect them.
+	marks := make([]Mark, len(params.Marks))
+	for i, m := range params.Marks {
+		marks[i] = Mark{m.Re, view.YMin + view.YMax - m.Im}
+	}
+	params.Marks = marks
+	encodeImage(w, img, params)
+}
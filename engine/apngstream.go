@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"io"
+	"time"
+)
+
+// pngSignature is the fixed header that starts every PNG (and APNG) file.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// apngStream writes an animated PNG one frame at a time, like gifStream, keeping the full
+// 16 bits per channel of the rendered frames instead of reducing them to a 256-color palette.
+// Every frame is stored as 16-bit RGBA, each row filtered with the PNG Sub filter.  If the
+// underlying writer can be flushed, it is flushed after every frame, and if it is an
+// EncodeObserver, it is told how long each frame took to encode.
+type apngStream struct {
+	w      *bufio.Writer
+	dst    io.Writer // the underlying writer
+	flush  func()
+	width  int
+	height int
+	seq    uint32       // sequence number of the next fcTL or fdAT chunk
+	frames int          // frames written so far
+	buf    bytes.Buffer // compressed pixels of the frame being written
+	row    []byte       // the current row, filtered, with its filter type byte
+	prev   []byte       // the current row, unfiltered
+}
+
+// newAPNGStream writes the PNG signature, header and animation control chunk for a width x height
+// animation of nFrames frames that repeats loop times (0 = forever) to w, and returns an
+// apngStream ready to accept the frames.
+func newAPNGStream(w io.Writer, width, height, nFrames, loop int) (*apngStream, error) {
+	s := &apngStream{
+		w:      bufio.NewWriter(w),
+		dst:    w,
+		flush:  func() {},
+		width:  width,
+		height: height,
+		row:    make([]byte, 1+8*width),
+		prev:   make([]byte, 8*width),
+	}
+	if f, ok := w.(interface{ Flush() }); ok {
+		s.flush = f.Flush
+	}
+	s.w.WriteString(pngSignature)
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(height))
+	ihdr[8] = 16 // bits per channel
+	ihdr[9] = 6  // color type: RGBA
+	s.writeChunk("IHDR", ihdr)
+
+	// The GIF loop count is the number of repeats after the first play; APNG counts every play
+	plays := 0
+	if loop > 0 {
+		plays = loop + 1
+	}
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], uint32(nFrames))
+	binary.BigEndian.PutUint32(actl[4:], uint32(plays))
+	s.writeChunk("acTL", actl)
+	return s, s.w.Flush()
+}
+
+// WriteFrame appends img, which must be width x height, to the animation, to be displayed for
+// delay 100ths of a second.
+func (s *apngStream) WriteFrame(img image.Image, delay int) error {
+	defer observeEncode(s.dst, time.Now())
+
+	fctl := make([]byte, 26)
+	binary.BigEndian.PutUint32(fctl[0:], s.seq)
+	binary.BigEndian.PutUint32(fctl[4:], uint32(s.width))
+	binary.BigEndian.PutUint32(fctl[8:], uint32(s.height))
+	// x and y offsets are 0
+	binary.BigEndian.PutUint16(fctl[20:], uint16(delay))
+	binary.BigEndian.PutUint16(fctl[22:], 100) // delay is in 100ths of a second
+	// dispose_op 0 (none) and blend_op 0 (source): each frame replaces the whole canvas
+	s.writeChunk("fcTL", fctl)
+	s.seq++
+
+	s.buf.Reset()
+	if s.frames > 0 { // frames after the first are fdAT chunks, which start with a sequence number
+		binary.Write(&s.buf, binary.BigEndian, s.seq)
+		s.seq++
+	}
+	if err := s.compress(img); err != nil {
+		return err
+	}
+	if s.frames == 0 {
+		s.writeChunk("IDAT", s.buf.Bytes())
+	} else {
+		s.writeChunk("fdAT", s.buf.Bytes())
+	}
+	s.frames++
+
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+// compress appends the zlib-compressed, Sub-filtered 16-bit RGBA rows of img to s.buf.
+// PNG stores colors without alpha premultiplication, so the channels are divided by alpha.
+func (s *apngStream) compress(img image.Image) error {
+	zw := zlib.NewWriter(&s.buf)
+	b := img.Bounds()
+	s.row[0] = 1 // Sub filter: each byte is stored as the difference from the byte 8 (one pixel) before it
+	for y := b.Min.Y; y < b.Min.Y+s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			r, g, bl, a := img.At(b.Min.X+x, y).RGBA()
+			if a != 0 && a != 0xffff {
+				r, g, bl = r*0xffff/a, g*0xffff/a, bl*0xffff/a
+			}
+			binary.BigEndian.PutUint16(s.prev[8*x:], uint16(r))
+			binary.BigEndian.PutUint16(s.prev[8*x+2:], uint16(g))
+			binary.BigEndian.PutUint16(s.prev[8*x+4:], uint16(bl))
+			binary.BigEndian.PutUint16(s.prev[8*x+6:], uint16(a))
+		}
+		for i, v := range s.prev {
+			if i >= 8 {
+				v -= s.prev[i-8]
+			}
+			s.row[1+i] = v
+		}
+		if _, err := zw.Write(s.row); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// Close writes the closing IEND chunk.  It does not close the underlying writer.
+func (s *apngStream) Close() error {
+	s.writeChunk("IEND", nil)
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+// writeChunk writes a PNG chunk of the given type and data, with its length and CRC.
+func (s *apngStream) writeChunk(typ string, data []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(data)))
+	s.w.Write(n[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	s.w.WriteString(typ)
+	s.w.Write(data)
+	binary.BigEndian.PutUint32(n[:], crc.Sum32())
+	s.w.Write(n[:])
+}
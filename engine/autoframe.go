@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"image/color"
+	"math"
+	"runtime"
+	"sort"
+)
+
+const (
+	autoFrameGrid   = 128 // Width and height of the grid of points sampled to find the boundary
+	autoFrameFrames = 8   // Number of frames of an animation sampled to find the boundary
+	// autoFrameSlow is the fraction of the escaping samples, the slowest to escape, that are
+	// taken to lie near the boundary.
+	autoFrameSlow = 0.1
+	// autoFrameMargin is the margin added around the boundary, on each side, as a fraction of
+	// the larger side of its bounding box.
+	autoFrameMargin = 0.1
+)
+
+// JuliaFrame returns the window JuliaSingle should render for c and params to fill the image with
+// the boundary of the Julia set (see autoFrame).
+func JuliaFrame(c complex128, params RenderParams) Viewport {
+	cl := newColorer(params, color.RGBA64{}, params.pixelWidth())
+	return autoFrame(params.View, boundaryBox(params.View, func(z complex128) float64 {
+		return cl.escapeValue(z, c)
+	}))
+}
+
+// MandelbrotFrame returns the window Mandelbrot should render for params to fill the image with
+// the boundary of the Mandelbrot set (see autoFrame).
+func MandelbrotFrame(params RenderParams) Viewport {
+	cl := newColorer(params, color.RGBA64{}, params.pixelWidth())
+	return autoFrame(params.View, boundaryBox(params.View, func(c complex128) float64 {
+		return cl.escapeValue(cl.critical, c)
+	}))
+}
+
+// BurningShipFrame returns the window BurningShip should render for params to fill the image with
+// the boundary of the Burning Ship fractal (see autoFrame).
+func BurningShipFrame(params RenderParams) Viewport {
+	cl := newColorer(params, color.RGBA64{}, params.pixelWidth())
+	cl.step = burningShipStep
+	return autoFrame(params.View, boundaryBox(params.View, func(c complex128) float64 {
+		return cl.escapeValue(0, c)
+	}))
+}
+
+// BurningShipJuliaFrame returns the window BurningShipJulia should render for c and params to fill
+// the image with the boundary of the Julia set (see autoFrame).
+func BurningShipJuliaFrame(c complex128, params RenderParams) Viewport {
+	cl := newColorer(params, color.RGBA64{}, params.pixelWidth())
+	cl.step = burningShipStep
+	return autoFrame(params.View, boundaryBox(params.View, func(z complex128) float64 {
+		return cl.escapeValue(z, c)
+	}))
+}
+
+// AnimationFrame returns the window Julia should render for animParams and params so that every
+// frame fits, with the boundaries of the Julia sets (or Mandelbrot sets) of up to autoFrameFrames
+// frames, evenly spaced through the animation, inside it (see autoFrame).  The windows of the
+// Zoom path are set by the zoom, so for it the window is params.View itself.
+func AnimationFrame(animParams AnimParams, params RenderParams) Viewport {
+	if animParams.Path == "Zoom" && len(animParams.Cs) == 0 {
+		return params.View
+	}
+	jobs := newFrameJobs(animParams, params)
+	n := min(len(jobs), autoFrameFrames)
+	var boxes []Viewport
+	for i := 0; i < n; i++ {
+		job := jobs[i*len(jobs)/n]
+		cl := newColorer(job.params, color.RGBA64{}, params.pixelWidth())
+		boxes = append(boxes, boundaryBox(params.View, func(z complex128) float64 {
+			if job.mandelbrot {
+				return cl.escapeValue(cl.critical, z)
+			}
+			return cl.escapeValue(z, job.c)
+		})...)
+	}
+	return autoFrame(params.View, boxes)
+}
+
+// autoFrame returns a square window framing the union of boxes, with a margin of autoFrameMargin
+// on each side, or view itself if there are no boxes.
+func autoFrame(view Viewport, boxes []Viewport) Viewport {
+	if len(boxes) == 0 {
+		return view
+	}
+	u := boxes[0]
+	for _, b := range boxes[1:] {
+		u = Viewport{min(u.XMin, b.XMin), min(u.YMin, b.YMin), max(u.XMax, b.XMax), max(u.YMax, b.YMax)}
+	}
+	side := math.Max(u.XMax-u.XMin, u.YMax-u.YMin) * (1 + 2*autoFrameMargin)
+	cx, cy := (u.XMin+u.XMax)/2, (u.YMin+u.YMax)/2
+	return Viewport{cx - side/2, cy - side/2, cx + side/2, cy + side/2}
+}
+
+// boundaryBox samples escapeAt, the escape value of a point or 0 if it does not escape, on an
+// autoFrameGrid x autoFrameGrid grid over view, and returns the bounding box of the grid cells
+// near the boundary of the set, the autoFrameSlow slowest escaping cells.  Cells that do not
+// escape are no guide: besides the interior of the set, they include points so far out that
+// they start beyond the escape radius.  It returns no box if no sample escapes.
+func boundaryBox(view Viewport, escapeAt func(complex128) float64) []Viewport {
+	n := autoFrameGrid
+	values := make([]float64, n*n)
+	renderBands(n, runtime.NumCPU(), func(py int) {
+		y := view.y(py, n)
+		for px := 0; px < n; px++ {
+			values[py*n+px] = escapeAt(complex(view.x(px, n), y))
+		}
+	})
+
+	var escaped []float64
+	for _, v := range values {
+		if v > 0 {
+			escaped = append(escaped, v)
+		}
+	}
+	if len(escaped) == 0 {
+		return nil
+	}
+	sort.Float64s(escaped)
+	slow := escaped[int(float64(len(escaped)-1)*(1-autoFrameSlow))]
+
+	minX, minY, maxX, maxY := n, n, -1, -1
+	for py := 0; py < n; py++ {
+		for px := 0; px < n; px++ {
+			if values[py*n+px] >= slow {
+				minX, minY = min(minX, px), min(minY, py)
+				maxX, maxY = max(maxX, px), max(maxY, py)
+			}
+		}
+	}
+	return []Viewport{{view.x(minX, n), view.y(minY, n), view.x(maxX+1, n), view.y(maxY+1, n)}}
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"log"
+	"math/cmplx"
+	"runtime"
+	"testing"
+)
+
+// benchSize is the side, in pixels, of the images rendered by the benchmarks.
+const benchSize = 256
+
+// BenchmarkNewton renders the same image on one worker and on one per CPU, to show how the
+// render scales with the workers.
+func BenchmarkNewton(b *testing.B) {
+	params := testParams(benchSize)
+	for _, workers := range []struct {
+		name string
+		n    int
+	}{{"workers=1", 1}, {"workers=NumCPU", runtime.NumCPU()}} {
+		b.Run(workers.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Newton(workers.n, params, io.Discard)
+			}
+		})
+	}
+}
+
+func BenchmarkJuliaSingle(b *testing.B) {
+	params := testParams(benchSize)
+	for i := 0; i < b.N; i++ {
+		JuliaSingle(-0.8+0.156i, params, io.Discard)
+	}
+}
+
+func BenchmarkJulia(b *testing.B) {
+	animParams, params := testAnimParams(8), testParams(benchSize/2)
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard) // Julia logs every frame
+	for i := 0; i < b.N; i++ {
+		Julia(context.Background(), animParams, params, io.Discard)
+	}
+}
+
+func BenchmarkMandelbrot(b *testing.B) {
+	params := testParams(benchSize)
+	for i := 0; i < b.N; i++ {
+		Mandelbrot(params, io.Discard)
+	}
+}
+
+// The per-pixel benchmarks iterate a point that does not escape, the most expensive case.
+
+func BenchmarkJuliaIFS(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		juliaIFS(0, -1, DefaultMaxIter, 2)
+	}
+}
+
+func BenchmarkJuliaIFSSmooth(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		juliaIFSSmooth(0, -1, DefaultMaxIter, 2)
+	}
+}
+
+func BenchmarkNewtonIFS(b *testing.B) {
+	roots := unityRoots(4)
+	for i := 0; i < b.N; i++ {
+		newtonIFS(0.5+0.5i, 1, roots, DefaultMaxIter, DefaultTol)
+	}
+}
+
+// juliaIFSModulus is juliaIFS as it was before the escape test compared squared moduli: it
+// takes the modulus, with its square root, of every iterate.  It is kept for BenchmarkEscapeTest.
+func juliaIFSModulus(z complex128, c complex128, maxIter int, big float64) int {
+	for i := 1; i <= maxIter; i++ {
+		z = z*z + c
+		if cmplx.Abs(z) > big {
+			return i
+		}
+	}
+	return 0
+}
+
+// BenchmarkEscapeTest compares the escape test of juliaIFS, on the squared modulus, with the
+// modulus it replaced.
+func BenchmarkEscapeTest(b *testing.B) {
+	for _, test := range []struct {
+		name string
+		f    func(z, c complex128, maxIter int, big float64) int
+	}{{"modulus", juliaIFSModulus}, {"squared", juliaIFS}} {
+		b.Run(test.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				test.f(0, -1, DefaultMaxIter, 2)
+			}
+		})
+	}
+}
+
+// BenchmarkPixelCoordinates compares finding the points of the pixels of a 1024 x 1024 image by
+// division, as the render loops once did, with looking them up in the tables of xs and ys.
+func BenchmarkPixelCoordinates(b *testing.B) {
+	const size = 1024
+	view := DefaultView
+	row := make([]complex128, size)
+	b.Run("divide", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for py := 0; py < size; py++ {
+				for px := range row {
+					row[px] = complex(view.x(px, size), view.y(py, size))
+				}
+			}
+		}
+	})
+	b.Run("tables", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			xs, ys := view.xs(size), view.ys(size)
+			for py := 0; py < size; py++ {
+				y := ys[py]
+				for px := range row {
+					row[px] = complex(xs[px], y)
+				}
+			}
+		}
+	})
+}
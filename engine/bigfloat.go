@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/big"
+	"runtime"
+)
+
+// MaxPrecision is the largest number of mantissa bits accepted for deep-zoom renders.
+const MaxPrecision = 1024
+
+// BigViewport is a window in the complex plane whose edges are decimal numbers with more digits
+// than float64 holds, for deep zooms.  An empty edge is that of the Viewport it goes with.
+type BigViewport struct {
+	XMin, YMin, XMax, YMax string
+}
+
+// edges returns the edges of v at prec bits of mantissa, taking those that are empty or do not
+// parse from view.
+func (v BigViewport) edges(view Viewport, prec uint) (xmin, ymin, xmax, ymax *big.Float) {
+	edge := func(s string, def float64) *big.Float {
+		f := new(big.Float).SetPrec(prec)
+		if _, ok := f.SetString(s); !ok {
+			f.SetFloat64(def)
+		}
+		return f
+	}
+	return edge(v.XMin, view.XMin), edge(v.YMin, view.YMin), edge(v.XMax, view.XMax), edge(v.YMax, view.YMax)
+}
+
+// Tile returns the window of the tile in row and column col of a grid of rows x cols tiles
+// covering v, whose edges missing from v are those of view, as Viewport.Tile does, at
+// MaxPrecision bits.
+func (v BigViewport) Tile(view Viewport, rows, cols, row, col int) BigViewport {
+	xmin, ymin, xmax, ymax := v.edges(view, MaxPrecision)
+	at := func(min, max *big.Float, i, n int) string {
+		f := new(big.Float).SetPrec(MaxPrecision).Sub(max, min)
+		f.Mul(f, big.NewFloat(float64(i))).Quo(f, big.NewFloat(float64(n))).Add(f, min)
+		return f.Text('g', -1)
+	}
+	return BigViewport{
+		XMin: at(xmin, xmax, col, cols),
+		YMin: at(ymin, ymax, row, rows),
+		XMax: at(xmin, xmax, col+1, cols),
+		YMax: at(ymin, ymax, row+1, rows),
+	}
+}
+
+// renderBig renders a width x height image of params.View, computing the plane coordinates of each
+// pixel with params.Precision bits of mantissa and coloring it with colorAt, which is expected to
+// iterate at the same precision.
+//
+// Float64 coordinates run out of precision once the window is narrower than about 1e-13, where
+// neighboring pixels map to the same point and the image turns to mush.  This path keeps the pixels
+// distinct, but big.Float arithmetic is one to two orders of magnitude slower than float64, so
+// rows are rendered concurrently on all available CPUs and supersampling is not applied.  Only escape
+// coloring (banded or smooth) is supported.  The edges of the window are read from params.BigView,
+// at params.Precision bits, where it has them, so that the window can be narrower than float64
+// can tell its edges apart.  As with renderImage, only the pixels in params.Crop are rendered if it
+// is not empty.
+func renderBig(width, height int, params RenderParams, colorAt func(x, y *big.Float) color.RGBA64) *image.RGBA64 {
+	prec := params.Precision
+	newFloat := func(v float64) *big.Float { return new(big.Float).SetPrec(prec).SetFloat64(v) }
+
+	xmin, ymin, dx, dy := params.BigView.edges(params.View, prec)
+	dx.Sub(dx, xmin).Quo(dx, newFloat(float64(width)))
+	dy.Sub(dy, ymin).Quo(dy, newFloat(float64(height)))
+
+	b := params.Bounds()
+	img := image.NewRGBA64(b)
+	renderBands(b.Dy(), runtime.NumCPU(), func(row int) {
+		py := b.Min.Y + row
+		y := newFloat(float64(py))
+		y.Mul(y, dy).Add(y, ymin)
+		x := newFloat(0)
+		for px := b.Min.X; px < b.Max.X; px++ {
+			x.SetFloat64(float64(px)).Mul(x, dx).Add(x, xmin)
+			img.Set(px, py, colorAt(x, y))
+		}
+	})
+	return img
+}
+
+// juliaBig returns a function coloring the point (x, y) for the process z -> z^2 + c in
+// arbitrary precision, started at (x, y) + cl.z0, for use with renderBig.
+func (cl *colorer) juliaBig(c complex128) func(x, y *big.Float) color.RGBA64 {
+	return func(x, y *big.Float) color.RGBA64 {
+		prec := cl.params.Precision
+		cr := new(big.Float).SetPrec(prec).SetFloat64(real(c))
+		ci := new(big.Float).SetPrec(prec).SetFloat64(imag(c))
+		zr := new(big.Float).SetPrec(prec).SetFloat64(real(cl.z0))
+		zi := new(big.Float).SetPrec(prec).SetFloat64(imag(cl.z0))
+		zr.Add(zr, x)
+		zi.Add(zi, y)
+		return cl.bigColor(juliaIFSBig(zr, zi, cr, ci, cl.params.MaxIter, cl.params.Escape))
+	}
+}
+
+// mandelbrotBig colors the parameter c = (x, y) for the process z -> z^2 + c started at z = cl.z0
+// in arbitrary precision, for use with renderBig.
+func (cl *colorer) mandelbrotBig(x, y *big.Float) color.RGBA64 {
+	zr := new(big.Float).SetPrec(cl.params.Precision).SetFloat64(real(cl.z0))
+	zi := new(big.Float).SetPrec(cl.params.Precision).SetFloat64(imag(cl.z0))
+	return cl.bigColor(juliaIFSBig(zr, zi, x, y, cl.params.MaxIter, cl.params.Escape))
+}
+
+// bigColor colors a point from the result of juliaIFSBig, following juliaIFS and juliaIFSSmooth.
+func (cl *colorer) bigColor(i int, modulus float64, escaped bool) color.RGBA64 {
+	if !escaped {
+		return cl.interior
+	}
+	v := float64(i)
+	if cl.params.Smooth {
+		v = smoothCount(i, modulus, 2)
+	}
+	if v > 0 {
+		return escapeColor(cl.pal, v)
+	}
+	return cl.interior
+}
+
+// juliaIFSBig iterates z -> z^2 + c starting at z = zr + zi*i with c = cr + ci*i, at the precision of zr,
+// until either maxIter iterations have completed or the modulus of an iterate exceeds escape.
+// Returns the iteration at which the iterates escaped, counting from 1 as juliaIFS does, the
+// modulus of the escaping iterate and true, or false if they did not escape.  The arguments are not modified.
+func juliaIFSBig(zr, zi, cr, ci *big.Float, maxIter int, escape float64) (int, float64, bool) {
+	prec := zr.Prec()
+	newFloat := func() *big.Float { return new(big.Float).SetPrec(prec) }
+	x, y := newFloat().Set(zr), newFloat().Set(zi)
+	x2, y2, xy, mod2 := newFloat(), newFloat(), newFloat(), newFloat()
+	bound := newFloat().SetFloat64(escape * escape)
+	for i := 1; i <= maxIter; i++ {
+		// (x + yi)^2 + c = (x^2 - y^2 + cr) + (2xy + ci)i
+		x2.Mul(x, x)
+		y2.Mul(y, y)
+		xy.Mul(x, y)
+		x.Sub(x2, y2).Add(x, cr)
+		y.Add(xy, xy).Add(y, ci)
+
+		x2.Mul(x, x)
+		y2.Mul(y, y)
+		if mod2.Add(x2, y2).Cmp(bound) > 0 {
+			m, _ := mod2.Float64()
+			return i, math.Sqrt(m), true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"image/color"
+	"math/big"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// renderBig takes the edges of the window from params.BigView, so that the pixels of a window
+// too narrow for float64, where View has collapsed to a line, are still distinct points.
+func TestRenderBigDeepWindow(t *testing.T) {
+	const size = 8
+	params := testParams(size)
+	params.Precision = 128
+	params.View = Viewport{XMin: 0.5, YMin: 1, XMax: 0.5, YMax: 1} // what float64 makes of BigView
+	params.BigView = BigViewport{XMin: "0.5", YMin: "1", XMax: "0.5000000000000000000000008", YMax: "1.0000000000000000000000008"}
+
+	var mu sync.Mutex
+	got := map[string]bool{} // the x of every pixel, to 30 digits
+	renderBig(size, size, params, func(x, y *big.Float) color.RGBA64 {
+		mu.Lock()
+		defer mu.Unlock()
+		got[x.Text('g', 30)] = true
+		return color.RGBA64{}
+	})
+	step, _ := new(big.Float).SetPrec(128).SetString("1e-25")
+	want := map[string]bool{}
+	for px := 0; px < size; px++ {
+		x := new(big.Float).SetPrec(128).Mul(step, big.NewFloat(float64(px)))
+		want[x.Add(x, big.NewFloat(0.5)).Text('g', 30)] = true
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("the pixels are at x = %v, want %v", got, want)
+	}
+}
+
+// The tiles of a big window share their edges with their neighbors, and cover the window.
+func TestBigViewportTile(t *testing.T) {
+	view := Viewport{XMin: -0.75, YMin: 0.1, XMax: -0.75, YMax: 0.1}
+	v := BigViewport{XMin: "-0.75", YMin: "0.1", XMax: "-0.7499999999999999999999996", YMax: "0.1000000000000000000000003"}
+	parse := func(s string) *big.Float {
+		f, _, err := big.ParseFloat(s, 10, MaxPrecision, big.ToNearestEven)
+		if err != nil {
+			t.Fatalf("parsing %q: %v", s, err)
+		}
+		return f
+	}
+	const rows, cols = 3, 4
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			tile := v.Tile(view, rows, cols, row, col)
+			if parse(tile.XMin).Cmp(parse(tile.XMax)) >= 0 || parse(tile.YMin).Cmp(parse(tile.YMax)) >= 0 {
+				t.Errorf("tile (%d, %d) %+v is empty", row, col, tile)
+			}
+			if col+1 < cols && v.Tile(view, rows, cols, row, col+1).XMin != tile.XMax {
+				t.Errorf("tile (%d, %d) ends at x = %s, but the next one starts elsewhere", row, col, tile.XMax)
+			}
+			if row+1 < rows && v.Tile(view, rows, cols, row+1, col).YMin != tile.YMax {
+				t.Errorf("tile (%d, %d) ends at y = %s, but the next one starts elsewhere", row, col, tile.YMax)
+			}
+		}
+	}
+	first, last := v.Tile(view, rows, cols, 0, 0), v.Tile(view, rows, cols, rows-1, cols-1)
+	if parse(first.XMin).Cmp(parse(v.XMin)) != 0 || parse(first.YMin).Cmp(parse(v.YMin)) != 0 ||
+		parse(last.XMax).Cmp(parse(v.XMax)) != 0 || parse(last.YMax).Cmp(parse(v.YMax)) != 0 {
+		t.Errorf("tiles span %s..%s x %s..%s, want %+v", first.XMin, last.XMax, first.YMin, last.YMax, v)
+	}
+}
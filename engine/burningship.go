@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"image/color"
+	"io"
+	"math"
+)
+
+// BurningShipView is the default window for the Burning Ship renderers.
+var BurningShipView = Viewport{-2.5, -2, +1.5, +2}
+
+// BurningShip creates an image of the Burning Ship fractal, the set of c values for which the process
+//
+//	z -> (|Re z| + i|Im z|)^2 + c
+//
+// started at z = 0 does not escape, and writes it to w.  It is rendered like Mandelbrot, with
+// the same params.  Distance coloring and deep zooms are not supported; the former falls back to
+// escape coloring and params.Precision is ignored.
+func BurningShip(params RenderParams, w io.Writer) {
+	width, height := params.Size, params.Size
+	cl := newColorer(params, params.interior(), params.pixelWidth())
+	cl.step = burningShipStep
+	cl.paramPlane = true
+	img := renderImage(width, height, 1, params, func(c complex128) color.RGBA64 {
+		return cl.julia(0, c)
+	})
+	encodeImage(w, img, params)
+}
+
+// BurningShipJulia creates an image of the Julia set of the Burning Ship process for the fixed
+// parameter c, i.e. the starting points z that do not escape, and writes it to w.
+func BurningShipJulia(c complex128, params RenderParams, w io.Writer) {
+	width, height := params.Size, params.Size
+	cl := newColorer(params, params.interior(), params.pixelWidth())
+	cl.step = burningShipStep
+	img := renderImage(width, height, 1, params, func(z complex128) color.RGBA64 {
+		return cl.julia(z, c)
+	})
+	params.orbit = orbitPoints(c, burningShipStep, params)
+	encodeImage(w, img, params, "c="+CLabel(c))
+}
+
+// burningShipStep is the Burning Ship iteration, which takes the absolute values of the real
+// and imaginary parts of z before squaring.
+func burningShipStep(z, c complex128) complex128 {
+	z = complex(math.Abs(real(z)), math.Abs(imag(z)))
+	return z*z + c
+}
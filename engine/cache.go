@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+// Cache is an in-memory cache of encoded images with least-recently-used eviction.
+// Renders are deterministic functions of their parameters, so an image can be cached under
+// the canonical key of the parameters that produced it (see CacheKey).
+// A Cache is safe for concurrent use.
+type Cache struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List               // Entries, most recently used first
+	entries    map[string]*list.Element // Elements of order, keyed by cache key
+}
+
+// cacheEntry is a cached image and its key.
+type cacheEntry struct {
+	key  string
+	data []byte
+}
+
+// NewCache returns a cache holding at most maxEntries images.
+func NewCache(maxEntries int) *Cache {
+	return &Cache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the image cached under key and true, or nil and false if there is none.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheEntry).data, true
+}
+
+// Add caches data under key, evicting the least recently used image if the cache is full.
+func (c *Cache) Add(key string, data []byte) {
+	if c.maxEntries < 1 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cacheEntry).data = data
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key, data})
+	if c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// CacheKey returns the canonical key for the image produced by the named endpoint with params
+// and any endpoint-specific arguments in extra (e.g. the c value of a Julia set).
+func CacheKey(endpoint string, params RenderParams, extra ...any) string {
+	return fmt.Sprintf("%s|%+v|%v", endpoint, params, extra)
+}
+
+// ETag returns an HTTP entity tag for the image with the given cache key.
+func ETag(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
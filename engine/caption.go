@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strings"
+)
+
+// Corners of an image a caption can be drawn in, selected by RenderParams.LabelPos.
+const (
+	LabelTopLeft     = "top-left"
+	LabelTopRight    = "top-right"
+	LabelBottomLeft  = "bottom-left"
+	LabelBottomRight = "bottom-right"
+)
+
+// ValidLabelPos reports whether pos is a supported caption position.
+func ValidLabelPos(pos string) bool {
+	switch pos {
+	case LabelTopLeft, LabelTopRight, LabelBottomLeft, LabelBottomRight:
+		return true
+	}
+	return false
+}
+
+// captionPixels is the image size per pixel of the caption font: captions are magnified by
+// one for every captionPixels pixels of the shorter side of the image, so that they stay
+// readable on large images.
+const captionPixels = 400
+
+// Caption returns the caption drawn on images rendered with params when params.Label is set:
+// the parts in about, then the center and width of the window.
+func (params RenderParams) Caption(about []string) string {
+	v := params.View
+	parts := append(append([]string{}, about...),
+		"center "+CLabel(v.Center()),
+		fmt.Sprintf("width %.4g", v.XMax-v.XMin))
+	return strings.Join(parts, "  ")
+}
+
+// drawCaption draws the caption of params (see Caption) onto img, in the corner named by
+// params.LabelPos, and returns the result.  img is drawn on directly if it can be.  Only the part
+// of the caption that falls within the bounds of img is drawn.
+func drawCaption(img image.Image, params RenderParams, about []string) image.Image {
+	dst := drawable(img)
+	b := dst.Bounds()
+	// A crop is captioned as part of the whole image, so that crops and tiles fit together.
+	if params.Crop != (PixelRect{}) {
+		b = image.Rect(0, 0, params.Size, params.Size)
+	}
+	text := params.Caption(about)
+	scale := max(1, min(b.Dx(), b.Dy())/captionPixels)
+	size := labelSize(text, scale)
+	margin := 2 * scale
+	at := image.Pt(b.Min.X+margin, b.Max.Y-margin-size.Y)
+	switch params.LabelPos {
+	case LabelTopLeft:
+		at.Y = b.Min.Y + margin
+	case LabelTopRight:
+		at = image.Pt(b.Max.X-margin-size.X, b.Min.Y+margin)
+	case LabelBottomRight:
+		at.X = b.Max.X - margin - size.X
+	}
+	drawLabel(dst, at, text, scale)
+	return dst
+}
+
+// drawable returns img if it can be drawn on, and otherwise a copy of it that can.
+func drawable(img image.Image) draw.Image {
+	if dst, ok := img.(draw.Image); ok {
+		return dst
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA64(b)
+	draw.Draw(rgba, b, img, b.Min, draw.Src)
+	return rgba
+}
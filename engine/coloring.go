@@ -0,0 +1,355 @@
+package engine
+
+import (
+	"image/color"
+	"math"
+	"math/cmplx"
+	"runtime"
+	"sync"
+)
+
+// Coloring modes for escape-time renders, selected by RenderParams.Color.
+const (
+	ColorEscape    = "escape"    // Color escaping points by escape count; interior points are solid
+	ColorTrap      = "trap"      // Color every point by how close its orbit comes to an orbit trap
+	ColorDistance  = "distance"  // Color escaping points by their estimated distance to the set boundary
+	ColorHistogram = "histogram" // Color escaping points by the fraction of escaping pixels that escape sooner
+	ColorPeriod    = "period"    // Color escaping points by escape count and interior points by the period of their cycle
+	ColorMaxMod    = "maxmod"    // Color every point by the largest modulus its orbit reaches before escaping
+)
+
+// colorModes is the set of supported coloring modes.
+var colorModes = map[string]bool{
+	ColorEscape:    true,
+	ColorTrap:      true,
+	ColorDistance:  true,
+	ColorHistogram: true,
+	ColorPeriod:    true,
+	ColorMaxMod:    true,
+}
+
+// ValidColorMode reports whether mode names a supported coloring mode.
+func ValidColorMode(mode string) bool {
+	return colorModes[mode]
+}
+
+// Orbit trap shapes, selected by RenderParams.Trap.
+const (
+	TrapPoint = "point" // The origin
+	TrapCross = "cross" // The real and imaginary axes
+)
+
+const (
+	trapFalloff  = 4  // How quickly trap colors fade with distance from the trap
+	distanceSpan = 64 // Distance, in pixels, from the boundary at which distance colors reach the start of the palette
+	// periodTol is the distance within which two iterates count as the same point of a cycle.
+	periodTol = 1e-6
+	// periodHueStep is the difference in hue, in turns, between the colors of successive periods:
+	// the golden ratio, so that however many periods appear, their hues stay far apart.
+	periodHueStep = 0.6180339887498949
+)
+
+// A colorer colors the points of an escape-time render according to the coloring mode,
+// palette and iteration settings of its params.
+type colorer struct {
+	params   RenderParams
+	pal      Palette
+	interior color.RGBA64 // Color of points that do not escape
+	pixel    float64      // Width of a pixel in the complex plane
+	step     iteration    // Iteration to use instead of z -> z^2 + c, if not nil
+	cdf      []float64    // Cumulative distribution of escape counts, for histogram coloring (see equalize)
+	z0       complex128   // Offset added to the starting point of every orbit
+	critical complex128   // Starting point of the orbits of the parameter plane, before z0
+	// transcendental reports whether step is a transcendental map, whose escape values are
+	// always integer counts, since smooth coloring assumes polynomial growth.
+	transcendental bool
+	// paramPlane reports whether the pixels are values of c, as for the Mandelbrot set, rather
+	// than starting points z, as for Julia sets.
+	paramPlane bool
+}
+
+// newColorer returns a colorer for params that uses interior for points that do not escape
+// and renders pixels that are pixel wide in the complex plane.  If params.Power is not 2, the
+// colorer steps with z -> z^power + c, and if params.Map names a transcendental map, with that
+// map instead; smooth coloring assumes polynomial growth, so those maps are colored in bands.
+// Orbits start params.Z0 away from the starting point they are given: at pixel + z0 for Julia
+// sets, and at z0 instead of 0 (or the critical value of the map) for the Mandelbrot set.
+func newColorer(params RenderParams, interior color.RGBA64, pixel float64) *colorer {
+	cl := &colorer{params: params, pal: params.palette(), interior: interior, pixel: pixel, z0: params.z0()}
+	if m := iterationMaps[params.Map]; m.step != nil {
+		cl.step, cl.critical, cl.transcendental = m.step, m.critical, true
+	} else if params.Power != 2 {
+		cl.step = powerStep(params.Power)
+	}
+	return cl
+}
+
+// julia returns the color of the point z for the process z -> z^2 + c, or cl.step if it is set,
+// started at z + cl.z0.
+func (cl *colorer) julia(z complex128, c complex128) color.RGBA64 {
+	p := cl.params
+	at := z // the point of the pixel, for dithering
+	if cl.paramPlane {
+		at = c
+	}
+	z += cl.z0
+	if cl.step != nil {
+		return cl.orbit(z, c, at)
+	}
+	switch p.Color {
+	case ColorTrap:
+		return cl.pal(math.Exp(-trapFalloff * juliaIFSTrap(z, c, p.MaxIter, p.Escape, p.Trap)))
+	case ColorMaxMod:
+		return cl.pal(maxModShade(juliaIFSMaxMod(z, c, p.MaxIter, p.Escape), p.Escape))
+	case ColorDistance:
+		d, escaped := juliaIFSDistance(z, c, p.MaxIter, p.Escape)
+		return cl.distance(d, escaped)
+	case ColorPeriod:
+		class, st := juliaIFSClassify(z, c, p.MaxIter, p.Escape)
+		switch class {
+		case orbitEscaped:
+			if v := st.escapeValue(p.Smooth); v > 0 {
+				return cl.escapeColor(cl.dither(at, v))
+			}
+			return cl.interior
+		case orbitInterior:
+			return periodColor(st.period)
+		}
+		return cl.interiorColor(z, c) // give orbits still closing in on their cycle longer
+	default:
+		if v := juliaValue(z, c, p); v > 0 {
+			return cl.escapeColor(cl.dither(at, v))
+		}
+		return cl.interiorColor(z, c)
+	}
+}
+
+// orbit returns the color of the point z for the process z -> cl.step(z, c), started at z itself,
+// for the pixel at the point at.  Distance estimation needs the derivative of the step, so
+// distance coloring falls back to escape coloring.
+func (cl *colorer) orbit(z complex128, c complex128, at complex128) color.RGBA64 {
+	p := cl.params
+	switch p.Color {
+	case ColorTrap:
+		return cl.pal(math.Exp(-trapFalloff * escapeIFSTrap(z, c, cl.step, p.MaxIter, p.Escape, p.Trap)))
+	case ColorMaxMod:
+		return cl.pal(maxModShade(escapeIFSMaxMod(z, c, cl.step, p.MaxIter, p.Escape), p.Escape))
+	}
+	if v := cl.value(z, c); v > 0 {
+		return cl.escapeColor(cl.dither(at, v))
+	}
+	return cl.interiorColor(z, c)
+}
+
+// interiorColor returns the color of the point z, whose orbit started at z itself does not
+// escape.  With ColorPeriod the color is given by the period of the cycle the orbit settles on,
+// a different hue for each period; otherwise, and if the orbit does not settle, it is cl.interior.
+func (cl *colorer) interiorColor(z complex128, c complex128) color.RGBA64 {
+	if cl.params.Color != ColorPeriod {
+		return cl.interior
+	}
+	step := cl.step
+	if step == nil {
+		step = quadraticStep
+	}
+	n := orbitPeriod(z, c, step, cl.params.MaxIter)
+	if n == 0 {
+		return cl.interior
+	}
+	return periodColor(n)
+}
+
+// periodColor returns the color of interior points whose orbits settle on a cycle of period n.
+func periodColor(n int) color.RGBA64 {
+	return hueColor(float64(n-1) * periodHueStep)
+}
+
+// orbitPeriod returns the period of the cycle the orbit of z under f settles on, or 0 if it does
+// not settle within maxIter steps.  The orbit is first given maxIter steps to settle, since
+// near the boundary of a component of the interior it closes in on the cycle slowly, by turns
+// from different sides, and returns close enough to a point near the cycle after a multiple of
+// the period to be mistaken for it.  The cycle is then found with Floyd's algorithm: a tortoise
+// takes one step for every two of a hare until they meet, to within periodTol, which puts the
+// tortoise on the cycle; the period is the number of steps it takes the hare to come back to it.
+func orbitPeriod(z complex128, c complex128, f iteration, maxIter int) int {
+	for i := 0; i < maxIter; i++ {
+		z = f(z, c)
+	}
+	tortoise, hare := f(z, c), f(f(z, c), c)
+	for i := 0; cmplx.Abs(tortoise-hare) > periodTol; i++ {
+		if i == maxIter {
+			return 0
+		}
+		tortoise = f(tortoise, c)
+		hare = f(f(hare, c), c)
+	}
+	hare = f(tortoise, c)
+	for n := 1; n <= maxIter; n++ {
+		if cmplx.Abs(tortoise-hare) <= periodTol {
+			return n
+		}
+		hare = f(hare, c)
+	}
+	return 0
+}
+
+// escapeValue returns the escape value of z under the colorer's process, the integer or smooth
+// escape count used by escape coloring, or 0 if z does not escape.  Like julia, the orbit starts
+// at z + cl.z0.
+func (cl *colorer) escapeValue(z complex128, c complex128) float64 {
+	return cl.value(z+cl.z0, c)
+}
+
+// value returns the escape value of the orbit of the colorer's process started at z itself.
+func (cl *colorer) value(z complex128, c complex128) float64 {
+	p := cl.params
+	if cl.step == nil {
+		return juliaValue(z, c, p)
+	}
+	if p.Smooth && !cl.transcendental {
+		return escapeIFSSmooth(z, c, cl.step, p.MaxIter, p.Escape, p.Power)
+	}
+	return float64(escapeIFS(z, c, cl.step, p.MaxIter, p.Escape))
+}
+
+// escapeColor returns the color of a point with escape value v.  Once equalize has run, the
+// color is given by the fraction of escaping pixels with lower escape values; otherwise by v
+// itself, as for escape coloring.
+func (cl *colorer) escapeColor(v float64) color.RGBA64 {
+	if cl.cdf == nil {
+		return escapeColor(cl.pal, v)
+	}
+	// Interpolate between the fractions for the integer counts around smooth values
+	k := min(int(v), len(cl.cdf)-2)
+	frac := math.Min(v-float64(k), 1)
+	return cl.pal(cl.cdf[k] + frac*(cl.cdf[k+1]-cl.cdf[k]))
+}
+
+// equalize prepares cl for histogram coloring of a params.Size square image of params.View,
+// in which the escape value of a pixel at the point z is escapeAt(z), or 0 if z does not escape.
+// It makes a first pass over the pixels to build the histogram of their (integer) escape
+// counts, from which it computes the fraction of escaping pixels that escape within each count.
+// Coloring by that fraction spreads the palette evenly over the pixels, however narrow the
+// range of counts they fall in.  equalize does nothing unless params.Color is ColorHistogram.
+func (cl *colorer) equalize(escapeAt func(complex128) float64) {
+	p := cl.params
+	if p.Color != ColorHistogram {
+		return
+	}
+	size, view := p.Size, p.View
+	var mu sync.Mutex
+	counts := make([]int, p.MaxIter+2)
+	renderBands(size, runtime.NumCPU(), func(py int) {
+		row := make([]int, len(counts))
+		y := view.y(py, size)
+		for px := 0; px < size; px++ {
+			if v := escapeAt(complex(view.x(px, size), y)); v > 0 {
+				row[min(int(v), len(row)-1)]++
+			}
+		}
+		mu.Lock()
+		for k, n := range row {
+			counts[k] += n
+		}
+		mu.Unlock()
+	})
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	cl.cdf = make([]float64, len(counts))
+	if total == 0 {
+		return
+	}
+	sum := 0
+	for k, n := range counts {
+		sum += n
+		cl.cdf[k] = float64(sum) / float64(total)
+	}
+}
+
+// mandelbrot returns the color of the parameter c for the process z -> z^2 + c started at z = 0
+// (or the critical value of the map of cl, offset by cl.z0).
+func (cl *colorer) mandelbrot(c complex128) color.RGBA64 {
+	p := cl.params
+	if p.Color == ColorDistance && cl.step == nil {
+		d, escaped := mandelbrotIFSDistance(cl.z0, c, p.MaxIter, p.Escape)
+		return cl.distance(d, escaped)
+	}
+	// The first iterate of 0 is c, so the Mandelbrot process is the Julia process started at 0
+	return cl.julia(cl.critical, c)
+}
+
+// distance returns the color for a point whose estimated distance to the boundary is d,
+// with points close to the boundary at the bright end of the palette.
+func (cl *colorer) distance(d float64, escaped bool) color.RGBA64 {
+	if !escaped {
+		return cl.interior
+	}
+	return cl.pal(1 - math.Min(1, math.Pow(d/(distanceSpan*cl.pixel), 0.25)))
+}
+
+// juliaIFSDistance iterates z -> z^2 + c like juliaIFS, tracking the derivative dz of the iterate
+// with respect to the starting point (dz -> 2*z*dz, starting at 1).  If the iterates escape, it returns
+// the distance estimate |z|*log(|z|)/|dz| of the starting point to the Julia set and true;
+// otherwise it returns 0 and false.
+func juliaIFSDistance(z complex128, c complex128, maxIter int, big float64) (float64, bool) {
+	dz := complex(1, 0)
+	big2 := big * big
+	for i := 0; i < maxIter; i++ {
+		dz = 2 * z * dz
+		z = z*z + c
+		if abs2(z) > big2 {
+			modulus := cmplx.Abs(z)
+			return modulus * math.Log(modulus) / cmplx.Abs(dz), true
+		}
+	}
+	return 0, false
+}
+
+// juliaIFSTrap iterates z -> z^2 + c like juliaIFS and returns the minimum distance from any
+// iterate to the named orbit trap, which is TrapCross for the axes or the origin otherwise.
+// Unlike the escape count, this distance varies across the interior of the filled Julia set.
+func juliaIFSTrap(z complex128, c complex128, maxIter int, big float64, trap string) float64 {
+	dist := trapDistance(z, trap)
+	big2 := big * big
+	for i := 0; i < maxIter; i++ {
+		z = z*z + c
+		if abs2(z) > big2 {
+			break
+		}
+		dist = math.Min(dist, trapDistance(z, trap))
+	}
+	return dist
+}
+
+// juliaIFSMaxMod iterates z -> z^2 + c like juliaIFS and returns the largest modulus of the
+// iterates before the one that escapes, starting point included.  Like the trap distance, it
+// varies smoothly across the interior of the filled Julia set as well as outside it.
+func juliaIFSMaxMod(z complex128, c complex128, maxIter int, big float64) float64 {
+	max2 := abs2(z)
+	big2 := big * big
+	for i := 0; i < maxIter; i++ {
+		z = z*z + c
+		if abs2(z) > big2 {
+			break
+		}
+		max2 = math.Max(max2, abs2(z))
+	}
+	return math.Sqrt(max2)
+}
+
+// maxModShade maps the largest modulus m of an orbit, at most the escape radius big unless the
+// orbit started beyond it, to the position in the palette of its color, on a log scale: the
+// moduli of orbits that stay small vary the most, and the scale tells them apart.
+func maxModShade(m, big float64) float64 {
+	return math.Min(1, math.Log1p(m)/math.Log1p(big))
+}
+
+// trapDistance returns the distance from z to the named orbit trap.
+func trapDistance(z complex128, trap string) float64 {
+	if trap == TrapCross {
+		return math.Min(math.Abs(real(z)), math.Abs(imag(z)))
+	}
+	return cmplx.Abs(z)
+}
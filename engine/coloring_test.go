@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"math"
+	"testing"
+)
+
+// The distance estimates follow the orbit and its derivative exactly.  For c = 0 the orbit of z0
+// is z0^(2^n), with derivative 2^n z0^(2^n - 1), so the Julia estimate is |z0| log|z0| whichever
+// iteration escapes; the Mandelbrot rows follow short orbits by hand.
+func TestDistanceEstimates(t *testing.T) {
+	tests := []struct {
+		name     string
+		distance func(z0, c complex128, maxIter int, big float64) (float64, bool)
+		z0, c    complex128
+		maxIter  int
+		big      float64
+		want     float64
+		escaped  bool
+	}{
+		{"julia, escapes in the first step", juliaIFSDistance, 3, 0, 100, 2, 3 * math.Log(3), true},
+		{"julia, escapes in the second step", juliaIFSDistance, 1.5, 0, 100, 2, 1.5 * math.Log(1.5), true},
+		{"julia, larger bailout", juliaIFSDistance, 1.5, 0, 100, 100, 1.5 * math.Log(1.5), true},
+		{"julia, off the real axis", juliaIFSDistance, 1.2 + 1.6i, 0, 100, 2, 2 * math.Log(2), true}, // |z0| = 2
+		{"julia, near the unit circle", juliaIFSDistance, 1.01i, 0, 100, 2, 1.01 * math.Log(1.01), true},
+		{"julia, inside the unit circle", juliaIFSDistance, 0.5, 0, 100, 2, 0, false},
+		{"julia, maxiter stops short", juliaIFSDistance, 1.01, 0, 5, 2, 0, false},
+		{"mandelbrot, c = 3", mandelbrotIFSDistance, 0, 3, 100, 2, 3 * math.Log(3), true},      // z 3, dz 1
+		{"mandelbrot, c = 1", mandelbrotIFSDistance, 0, 1, 100, 2, 5 * math.Log(5) / 13, true}, // z 1, 2, 5; dz 1, 3, 13
+		{"mandelbrot, z0 = 1", mandelbrotIFSDistance, 1, 1, 100, 2, math.Log(5), true},         // z 2, 5; dz 1, 5
+		{"mandelbrot, c = -2", mandelbrotIFSDistance, 0, -2, 100, 2, 0, false},                 // 0, -2, 2, 2, ...
+		{"mandelbrot, c = i", mandelbrotIFSDistance, 0, 1i, 100, 2, 0, false},                  // i, -1 + i, -i, ...
+	}
+	for _, tt := range tests {
+		got, escaped := tt.distance(tt.z0, tt.c, tt.maxIter, tt.big)
+		if escaped != tt.escaped || math.Abs(got-tt.want) > 1e-12*math.Max(1, tt.want) {
+			t.Errorf("%s: got %v, %v, want %v, %v", tt.name, got, escaped, tt.want, tt.escaped)
+		}
+	}
+}
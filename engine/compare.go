@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"sync"
+)
+
+// Layouts of the panels of a comparison image, selected by the layout request parameter.
+const (
+	LayoutHorizontal = "horizontal" // panels side by side, left to right
+	LayoutVertical   = "vertical"   // panels one above the other, top to bottom
+)
+
+const (
+	DefaultDivider = 4  // Default width in pixels of the divider between the panels of a comparison
+	MaxDivider     = 64 // Largest divider width accepted from a request
+)
+
+// ValidLayout reports whether layout is a supported comparison layout.
+func ValidLayout(layout string) bool {
+	return layout == LayoutHorizontal || layout == LayoutVertical
+}
+
+// dividerColor is the color of the divider between the panels of a comparison.
+var dividerColor = color.RGBA64{60000, 60000, 60000, 0xffff}
+
+// JuliaCompare creates a PNG image comparing the Julia sets for the values in cs, each rendered
+// as JuliaSingle would render it with params into a params.Size x params.Size panel.  The panels
+// are laid out as given by layout, separated by dividers divider pixels wide, and rendered
+// concurrently.  Mono and Invert apply to the whole image, dividers included.  params.Crop,
+// params.Grid and params.Marks are ignored.
+func JuliaCompare(cs []complex128, params RenderParams, layout string, divider int, w io.Writer) {
+	params.Crop, params.Grid, params.Marks = PixelRect{}, false, nil
+	size, n := params.Size, len(cs)
+	step := image.Pt(size+divider, 0)
+	bounds := image.Rect(0, 0, n*size+(n-1)*divider, size)
+	if layout == LayoutVertical {
+		step = image.Pt(0, size+divider)
+		bounds = image.Rect(0, 0, size, n*size+(n-1)*divider)
+	}
+	img := image.NewRGBA64(bounds)
+	draw.Draw(img, bounds, image.NewUniform(dividerColor), image.Point{}, draw.Src)
+
+	var wg sync.WaitGroup
+	for i, c := range cs {
+		wg.Add(1)
+		go func(i int, c complex128) {
+			defer wg.Done()
+			panel := juliaImage(c, params)
+			at := step.Mul(i)
+			draw.Draw(img, panel.Bounds().Add(at), panel, image.Point{}, draw.Src)
+		}(i, c)
+	}
+	wg.Wait()
+	about := make([]string, len(cs))
+	for i, c := range cs {
+		about[i] = fmt.Sprintf("c%d=%s", i+1, CLabel(c))
+	}
+	encodeImage(w, img, params, about...)
+}
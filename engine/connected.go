@@ -0,0 +1,17 @@
+package engine
+
+// JuliaConnected reports whether the Julia set for c and the process z -> z^params.Power + c is
+// connected.  It is exactly when c is in the Mandelbrot set (or the Multibrot set, for other
+// powers), that is when the orbit of the critical point 0 stays bounded, so this runs the
+// Mandelbrot escape test at c: the orbit is taken to be bounded if it does not pass
+// params.Escape within params.MaxIter iterations.  If it does, escapeIter is the number of
+// iterations it took, 1 if the first one did.  params.Z0Re and params.Z0Im are ignored, since
+// the test is only sound for the critical orbit.
+func JuliaConnected(c complex128, params RenderParams) (connected bool, escapeIter int) {
+	step := quadraticStep
+	if params.Power != 2 {
+		step = powerStep(params.Power)
+	}
+	n := escapeIFS(0, c, step, params.MaxIter, params.Escape)
+	return n == 0, n
+}
@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"image/color"
+	"runtime"
+)
+
+// MaxDataSize is the largest width and height of the matrices of escape values returned by
+// JuliaData, which are far bulkier than images of the same size.
+const MaxDataSize = 1024
+
+// JuliaData returns the escape values of the pixels of the image JuliaSingle renders for c and
+// params, as rows of params.Bounds(), from YMin: the iteration, counting from 1, at which the
+// orbit of each pixel's point escapes, or its normalized iteration count if params.Smooth is
+// set, and 0 for points that do not escape.  These are the values escape coloring uses, whatever params.Color is;
+// supersampling and params.Precision are ignored.
+func JuliaData(c complex128, params RenderParams) [][]float64 {
+	cl := newColorer(params, color.RGBA64{}, params.pixelWidth())
+	return escapeData(params, func(z complex128) float64 {
+		return cl.escapeValue(z, c)
+	})
+}
+
+// escapeData returns the escape values returned by escapeAt for the pixels in params.Bounds()
+// of a params.Size x params.Size image of params.View, row by row.
+func escapeData(params RenderParams, escapeAt func(complex128) float64) [][]float64 {
+	size, view := params.Size, params.View
+	b := params.Bounds()
+	rows := make([][]float64, b.Dy())
+	renderBands(b.Dy(), runtime.NumCPU(), func(row int) {
+		y := view.y(b.Min.Y+row, size)
+		values := make([]float64, b.Dx())
+		for i := range values {
+			values[i] = escapeAt(complex(view.x(b.Min.X+i, size), y))
+		}
+		rows[row] = values
+	})
+	return rows
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"image/color"
+	"math"
+)
+
+// minDimensionBoxes is the least number of boxes across the window at the largest box size
+// JuliaDimension counts with; larger boxes would all be full.
+const minDimensionBoxes = 4
+
+// DimensionPoint is one box size of a box-counting dimension estimate.
+type DimensionPoint struct {
+	Box   float64 `json:"box"`   // Side of the boxes, in the complex plane
+	Count int     `json:"count"` // Number of boxes that contain a boundary pixel
+}
+
+// Dimension is a box-counting dimension estimate: the slope of the least-squares line through
+// the points (log(1/Box), log(Count)) of Points.
+type Dimension struct {
+	Dimension float64          `json:"dimension"`
+	Points    []DimensionPoint `json:"points"`
+}
+
+// JuliaDimension estimates the box-counting dimension of the Julia set for c and params, the
+// boundary of the filled Julia set, within params.View.  It samples one params.Size x params.Size
+// image of the escape-time process, like JuliaSingle, and takes the boundary to be the pixels
+// that do not escape but have a neighbor that does.  For power 2, which has a distance estimate
+// (see juliaIFSDistance), the boundary also includes the escaping pixels estimated to be within
+// half a pixel of the set, so that sets with no interior, dendrites and dust, are found too.
+// The boundary pixels are then counted in square boxes of 1, 2, 4, ... pixels on a side, up to
+// minDimensionBoxes boxes across the window.
+//
+// The estimate is only as good as the sampling: pixels whose points escape after more than
+// params.MaxIter iterations count as not escaping, thickening the boundary, while thin parts of
+// the set that fall between sample points are missed, so the smallest boxes undercount.  Parts
+// of the set outside params.View are not counted at all.  Expect the estimate to be off in the
+// first decimal place, and to improve slowly with params.Size and params.MaxIter.
+func JuliaDimension(c complex128, params RenderParams) Dimension {
+	cl := newColorer(params, color.RGBA64{}, params.pixelWidth())
+	params.Crop = PixelRect{}
+	pixel := params.pixelWidth()
+	kinds := escapeData(params, func(z complex128) float64 {
+		if cl.escapeValue(z, c) == 0 {
+			return pixelInside
+		}
+		if cl.step == nil {
+			if d, escaped := juliaIFSDistance(z+cl.z0, c, params.MaxIter, params.Escape); escaped && d < pixel {
+				return pixelNear
+			}
+		}
+		return pixelOutside
+	})
+	return boxDimension(boundaryPixels(kinds), params.Size, pixel)
+}
+
+// Kinds of pixels sampled by JuliaDimension.  juliaIFSDistance returns twice the estimated
+// distance, so pixelNear pixels are within about half a pixel of the set.
+const (
+	pixelInside  = 0 // The point does not escape
+	pixelOutside = 1 // The point escapes
+	pixelNear    = 2 // The point escapes, but is estimated to be near the set
+)
+
+// boundaryPixels returns the pixels of kinds that are near the set, or inside it with a
+// horizontal or vertical neighbor that is not, as [y, x] pairs.
+func boundaryPixels(kinds [][]float64) [][2]int {
+	var boundary [][2]int
+	for y, row := range kinds {
+		for x, k := range row {
+			if k == pixelNear || k == pixelInside &&
+				((x > 0 && row[x-1] != pixelInside) || (x+1 < len(row) && row[x+1] != pixelInside) ||
+					(y > 0 && kinds[y-1][x] != pixelInside) || (y+1 < len(kinds) && kinds[y+1][x] != pixelInside)) {
+				boundary = append(boundary, [2]int{y, x})
+			}
+		}
+	}
+	return boundary
+}
+
+// boxDimension counts the boxes of 1, 2, 4, ... pixels on a side, each pixel pixelWidth wide,
+// containing the pixels boundary of a square image size pixels on a side, and fits the dimension
+// to the counts.  The dimension is 0 if there are no boundary pixels.
+func boxDimension(boundary [][2]int, size int, pixelWidth float64) Dimension {
+	var d Dimension
+	if len(boundary) == 0 {
+		return d
+	}
+	for s := 1; s == 1 || size/s >= minDimensionBoxes; s *= 2 {
+		boxes := map[[2]int]bool{}
+		for _, p := range boundary {
+			boxes[[2]int{p[0] / s, p[1] / s}] = true
+		}
+		d.Points = append(d.Points, DimensionPoint{Box: float64(s) * pixelWidth, Count: len(boxes)})
+	}
+
+	var n, sx, sy, sxx, sxy float64
+	for _, p := range d.Points {
+		x, y := math.Log(1/p.Box), math.Log(float64(p.Count))
+		n++
+		sx, sy, sxx, sxy = sx+x, sy+y, sxx+x*x, sxy+x*y
+	}
+	if den := n*sxx - sx*sx; den != 0 {
+		d.Dimension = (n*sxy - sx*sy) / den
+	}
+	return d
+}
@@ -0,0 +1,42 @@
+package engine
+
+import "math"
+
+// Dithering modes for escape-time renders, selected by RenderParams.Dither.
+const (
+	DitherNone    = "none"    // Color each pixel by its escape value alone
+	DitherOrdered = "ordered" // Offset escape values by a Bayer matrix to break up the bands between escape counts
+)
+
+// ValidDither reports whether mode names a supported dithering mode.
+func ValidDither(mode string) bool {
+	return mode == DitherNone || mode == DitherOrdered
+}
+
+// bayer4 is the 4 x 4 Bayer matrix: every threshold from 0 to 15 once, arranged so that the
+// pixels above any threshold are spread as evenly as possible over the tile.
+var bayer4 = [4][4]float64{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// dither returns the escape value v of the pixel at the point at, offset for ordered dithering if
+// params.Dither asks for it.  The offsets, between -1/2 and 1/2, follow bayer4 tiled over the
+// pixels of the image, so that across a boundary between two escape counts the pixels of one
+// band give way to those of the other in a fine, regular pattern rather than all at once.  The
+// offsets average to 0 over each tile, which keeps the overall mean color.
+func (cl *colorer) dither(at complex128, v float64) float64 {
+	p := cl.params
+	if p.Dither != DitherOrdered {
+		return v
+	}
+	view := p.View
+	// Points on a pixel's top-left corner may land a hair short of it; the nudge keeps them in it.
+	const nudge = 1e-6
+	px := int(math.Floor((real(at)-view.XMin)/(view.XMax-view.XMin)*float64(p.Size) + nudge))
+	py := int(math.Floor((imag(at)-view.YMin)/(view.YMax-view.YMin)*float64(p.Size) + nudge))
+	offset := (bayer4[py&3][px&3]+0.5)/16 - 0.5
+	return math.Max(0, v+offset)
+}
@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math"
+	"testing"
+)
+
+// The offsets of ordered dithering lie within half an escape count and average to 0 over each
+// 4 x 4 tile of pixels.
+func TestDitherOffsets(t *testing.T) {
+	params := testParams(16)
+	params.Dither = DitherOrdered
+	cl := newColorer(params, params.interior(), params.pixelWidth())
+	v := params.View
+	for ty := 0; ty < params.Size; ty += 4 {
+		for tx := 0; tx < params.Size; tx += 4 {
+			sum := 0.0
+			for py := ty; py < ty+4; py++ {
+				for px := tx; px < tx+4; px++ {
+					offset := cl.dither(complex(v.x(px, params.Size), v.y(py, params.Size)), 10) - 10
+					if math.Abs(offset) >= 0.5 {
+						t.Errorf("pixel (%d, %d): offset %v", px, py, offset)
+					}
+					sum += offset
+				}
+			}
+			if math.Abs(sum) > 1e-9 {
+				t.Errorf("tile at (%d, %d): offsets sum to %v", tx, ty, sum)
+			}
+		}
+	}
+}
+
+// Ordered dithering rearranges the colors of a render without changing its mean color much.
+func TestDitherPreservesMeanColor(t *testing.T) {
+	const tolerance = 0.001 // of full intensity; a bias of half an escape count moves it 0.004
+	for _, c := range []complex128{-0.8 + 0.156i, -0.4 + 0.6i, 0.285 + 0.01i} {
+		params := testParams(128)
+		plain := renderJuliaPNG(t, c, params)
+		params.Dither = DitherOrdered
+		dithered := renderJuliaPNG(t, c, params)
+
+		if bytes.Equal(plain.Pix, dithered.Pix) {
+			t.Errorf("c=%v: dithering changed nothing", c)
+		}
+		want, got := meanColor(plain), meanColor(dithered)
+		for ch := range want {
+			if d := math.Abs(got[ch]-want[ch]) / 0xffff; d > tolerance {
+				t.Errorf("c=%v: mean of channel %d moved by %.4f of full intensity, from %.0f to %.0f", c, ch, d, want[ch], got[ch])
+			}
+		}
+	}
+}
+
+// renderJuliaPNG renders the Julia set of c with JuliaSingle and decodes the image.
+func renderJuliaPNG(t *testing.T, c complex128, params RenderParams) *image.RGBA64 {
+	t.Helper()
+	var buf bytes.Buffer
+	JuliaSingle(c, params, &buf)
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decoding the image: %v", err)
+	}
+	rgba := image.NewRGBA64(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			rgba.Set(x, y, img.At(x, y))
+		}
+	}
+	return rgba
+}
+
+// meanColor returns the mean red, green and blue of the pixels of img.
+func meanColor(img *image.RGBA64) [3]float64 {
+	var sum [3]float64
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.RGBA64At(x, y)
+			sum[0] += float64(c.R)
+			sum[1] += float64(c.G)
+			sum[2] += float64(c.B)
+		}
+	}
+	n := float64(b.Dx() * b.Dy())
+	return [3]float64{sum[0] / n, sum[1] / n, sum[2] / n}
+}
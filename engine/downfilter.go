@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Filters that collapse the samples of a supersampled render (AA > 1) into pixels, selected by
+// RenderParams.DownFilter.
+const (
+	DownFilterBox      = "box"      // Average the AA x AA samples of each pixel
+	DownFilterBilinear = "bilinear" // Tent filter reaching one pixel beyond each side of the pixel
+	DownFilterLanczos  = "lanczos"  // Lanczos filter with 3 lobes, reaching three pixels beyond
+)
+
+// ValidDownFilter reports whether name names a supported supersampling filter.
+func ValidDownFilter(name string) bool {
+	return name == DownFilterBox || name == DownFilterBilinear || name == DownFilterLanczos
+}
+
+// downKernel returns the kernel of the filter named by name, as a function of the distance from
+// the center of a pixel in pixels, and the radius in pixels beyond which it is 0.  It returns a
+// nil kernel for DownFilterBox, which renderImage applies itself.
+func downKernel(name string) (kernel func(t float64) float64, radius int) {
+	switch name {
+	case DownFilterBilinear:
+		return func(t float64) float64 { return math.Max(0, 1-math.Abs(t)) }, 1
+	case DownFilterLanczos:
+		const lobes = 3
+		return func(t float64) float64 {
+			if t == 0 {
+				return 1
+			}
+			if math.Abs(t) >= lobes {
+				return 0
+			}
+			pt := math.Pi * t
+			return lobes * math.Sin(pt) * math.Sin(pt/lobes) / (pt * pt)
+		}, lobes
+	}
+	return nil, 0
+}
+
+// downWeights holds the weights of the samples that make up one pixel: samples first, first+1,
+// and so on, in sample units of 1/aa pixel, counting from the top-left corner of the image.
+type downWeights struct {
+	first   int
+	weights []float64
+}
+
+// newDownWeights returns the weights kernel, of radius radius, gives the samples of pixel p, which
+// sits on samples p*aa to p*aa + aa - 1.  The weights add up to 1.
+func newDownWeights(p, aa int, kernel func(float64) float64, radius int) downWeights {
+	first := (p - radius) * aa
+	center := float64(p*aa) + float64(aa-1)/2
+	weights := make([]float64, (2*radius+1)*aa)
+	total := 0.0
+	for i := range weights {
+		weights[i] = kernel((float64(first+i) - center) / float64(aa))
+		total += weights[i]
+	}
+	for i := range weights {
+		weights[i] /= total
+	}
+	return downWeights{first, weights}
+}
+
+// renderFiltered renders the same image as renderImage with the samples of params.AA > 1
+// collapsed into pixels by the filter params.DownFilter instead of averaged.  Unlike the average,
+// the filter takes in samples of the neighboring pixels too, weighting each by its distance from
+// the center of the pixel, which suppresses the aliasing the average leaves: the tent filter is
+// the smoothest and softest, and the Lanczos filter keeps fine filaments crisp, but may ring
+// slightly next to hard edges.  Samples beyond the edges of the image are taken from the plane
+// beyond them, so crops and tiles still match the whole image.  The filter is separable: each row
+// of samples is filtered across, once, and the pixels of a row are then filtered down from the
+// rows of samples around them, which are kept only as long as they are needed.  The rows are
+// rendered concurrently in nWorkers bands.
+func renderFiltered(width, height, nWorkers int, params RenderParams, colorAt func(complex128) color.RGBA64) *image.RGBA64 {
+	kernel, radius := downKernel(params.DownFilter)
+	aa, view := params.AA, params.View
+	dx, dy := (view.XMax-view.XMin)/float64(width), (view.YMax-view.YMin)/float64(height)
+	b := params.Bounds()
+	img := image.NewRGBA64(b)
+
+	across := make([]downWeights, b.Dx())
+	for i := range across {
+		across[i] = newDownWeights(b.Min.X+i, aa, kernel, radius)
+	}
+	firstColumn := across[0].first
+	columns := across[len(across)-1].first + len(across[len(across)-1].weights) - firstColumn
+
+	// filterRow returns the samples of row ky, filtered across into the pixels of a row of img,
+	// as the R, G, B and A channels of each pixel in turn.
+	filterRow := func(ky int) []float64 {
+		y := view.YMin + float64(ky)/float64(aa)*dy
+		samples := make([]color.RGBA64, columns)
+		for i := range samples {
+			samples[i] = colorAt(complex(view.XMin+float64(firstColumn+i)/float64(aa)*dx, y))
+		}
+		row := make([]float64, 4*len(across))
+		for px, dw := range across {
+			var r, g, b, a float64
+			for i, w := range dw.weights {
+				if w == 0 {
+					continue
+				}
+				c := samples[dw.first-firstColumn+i]
+				r += w * float64(c.R)
+				g += w * float64(c.G)
+				b += w * float64(c.B)
+				a += w * float64(c.A)
+			}
+			row[4*px], row[4*px+1], row[4*px+2], row[4*px+3] = r, g, b, a
+		}
+		return row
+	}
+
+	rows := b.Dy()
+	workers := max(1, min(nWorkers, rows))
+	// Each call renders one band of rows, keeping the rows of samples it is still using.
+	renderBands(workers, workers, func(band int) {
+		filtered := map[int][]float64{}
+		for row := band * rows / workers; row < (band+1)*rows/workers; row++ {
+			py := b.Min.Y + row
+			down := newDownWeights(py, aa, kernel, radius)
+			for ky := range filtered {
+				if ky < down.first {
+					delete(filtered, ky)
+				}
+			}
+			pixels := make([]float64, 4*len(across))
+			for i, w := range down.weights {
+				if w == 0 {
+					continue
+				}
+				ky := down.first + i
+				if filtered[ky] == nil {
+					filtered[ky] = filterRow(ky)
+				}
+				for k, v := range filtered[ky] {
+					pixels[k] += w * v
+				}
+			}
+			for px := range across {
+				// The negative lobes of the Lanczos filter can overshoot the range of the
+				// channels; colors are premultiplied, so they may not exceed alpha.
+				a := math.Max(0, math.Min(0xffff, math.Round(pixels[4*px+3])))
+				channel := func(v float64) uint16 { return uint16(math.Max(0, math.Min(a, math.Round(v)))) }
+				img.SetRGBA64(b.Min.X+px, py, color.RGBA64{
+					channel(pixels[4*px]), channel(pixels[4*px+1]), channel(pixels[4*px+2]), uint16(a)})
+			}
+		}
+	})
+	return img
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// renderStep renders a size x size image, one unit per pixel, of a vertical step from black to
+// white at x = edge, supersampled 4 x 4 and collapsed with filter.
+func renderStep(size int, edge float64, filter string) *image.RGBA64 {
+	params := testParams(size)
+	params.AA = 4
+	params.DownFilter = filter
+	params.View = Viewport{0, 0, float64(size), float64(size)}
+	black, white := color.RGBA64{0, 0, 0, 60000}, color.RGBA64{60000, 60000, 60000, 60000}
+	return renderImage(size, size, 2, params, func(z complex128) color.RGBA64 {
+		if real(z) >= edge {
+			return white
+		}
+		return black
+	})
+}
+
+// transitionWidth returns the distance in pixels over which row y of img rises from 10% to 90%
+// of white, interpolating linearly between the centers of the pixels.
+func transitionWidth(img *image.RGBA64, y int) float64 {
+	crossing := func(level float64) float64 {
+		prev := 0.0
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			v := float64(img.RGBA64At(x, y).R) / 60000
+			if v >= level {
+				return float64(x) - 0.5 + (level-prev)/(v-prev)
+			}
+			prev = v
+		}
+		return float64(img.Bounds().Max.X)
+	}
+	return crossing(0.9) - crossing(0.1)
+}
+
+// A hard edge is spread over the fewest pixels by the box filter, which only mixes the samples
+// within a pixel, then by Lanczos, whose central lobe is narrower than the tent of bilinear,
+// which reaches a whole pixel beyond each side and so gives the softest edges.  However the
+// edge falls within a pixel, the pixels beyond the reach of the filter keep the flat colors on
+// either side exactly.
+func TestDownFilterEdges(t *testing.T) {
+	const size = 32
+	filters := []string{DownFilterBox, DownFilterLanczos, DownFilterBilinear} // sharpest first
+	var total [3]float64
+	for _, offset := range []float64{0, 0.25, 0.5, 0.75} {
+		edge := size/2 + offset
+		var widths [3]float64
+		for i, filter := range filters {
+			img := renderStep(size, edge, filter)
+			widths[i] = transitionWidth(img, size/2)
+			total[i] += widths[i]
+
+			_, radius := downKernel(filter)
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					want := -1
+					if x < size/2-radius-1 {
+						want = 0
+					} else if x > size/2+radius+1 {
+						want = 60000
+					}
+					if c := img.RGBA64At(x, y); want >= 0 && c != (color.RGBA64{uint16(want), uint16(want), uint16(want), 60000}) {
+						t.Errorf("%s, edge at %v: flat pixel (%d, %d) is %v", filter, edge, x, y, c)
+					}
+				}
+			}
+		}
+		for i := 1; i < len(filters); i++ {
+			if widths[i] < widths[i-1] {
+				t.Errorf("edge at %v: %s spreads it over %.3f pixels, less than the %.3f of %s",
+					edge, filters[i], widths[i], widths[i-1], filters[i-1])
+			}
+		}
+	}
+	for i := 1; i < len(filters); i++ {
+		if total[i] <= total[i-1] {
+			t.Errorf("%s spreads edges over %.3f pixels in all, no more than the %.3f of %s",
+				filters[i], total[i], total[i-1], filters[i-1])
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"time"
+)
+
+// DefaultFormat is the output format used for still images when none (or an unknown one) is requested.
+const DefaultFormat = "png"
+
+// PNG compression levels, selected by RenderParams.PNGCompress.
+const (
+	PNGDefault         = "default"          // The standard library's default compression
+	PNGBestSpeed       = "best-speed"       // Fastest compression, for larger files
+	PNGBestCompression = "best-compression" // Smallest files, at the cost of encode time
+)
+
+// pngLevels maps the supported PNG compression levels to those of image/png.
+var pngLevels = map[string]png.CompressionLevel{
+	PNGDefault:         png.DefaultCompression,
+	PNGBestSpeed:       png.BestSpeed,
+	PNGBestCompression: png.BestCompression,
+}
+
+// ValidPNGCompress reports whether level names a supported PNG compression level.
+func ValidPNGCompress(level string) bool {
+	_, ok := pngLevels[level]
+	return ok
+}
+
+// formats maps the supported still-image output formats to their MIME types.
+var formats = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+}
+
+// FormatWebP names WebP, which is not among the formats: neither the standard library nor
+// golang.org/x/image can encode it.  Requests for it are refused rather than served as PNG.
+const FormatWebP = "webp"
+
+// ContentType returns the MIME type of the named output format and true, or the MIME type
+// of the default format and false if the format is not supported.
+func ContentType(format string) (string, bool) {
+	ct, ok := formats[format]
+	if !ok {
+		return formats[DefaultFormat], false
+	}
+	return ct, true
+}
+
+// An EncodeObserver is told how long the images written to it took to encode.  The writers passed
+// to the renderers may implement it to tell encode time apart from render time.
+type EncodeObserver interface {
+	ObserveEncode(d time.Duration)
+}
+
+// observeEncode tells w, if it is an EncodeObserver, that an encode which began at start has finished.
+func observeEncode(w io.Writer, start time.Time) {
+	if o, ok := w.(EncodeObserver); ok {
+		o.ObserveEncode(time.Since(start))
+	}
+}
+
+// encodeImage writes img to w in the output format named by params.Format, using
+// params.Quality for JPEG and params.PNGCompress for PNG.  Unknown formats are written as PNG.  img is cropped to params.Crop,
+// if it was rendered whole, shrunk to a thumbnail if params.Thumb asks for one (see downscale)
+// and post-processed as params asks first (see postProcess).  If params.Grid is set, a coordinate grid is drawn over it (see drawGrid),
+// then the orbit the renderer set, if any (see drawOrbit), and if params.Label is set, the
+// caption is drawn, led by the parts in about (see drawCaption).  Last, the finished image is
+// rotated or flipped as params.Transform asks (see transformImage).
+func encodeImage(w io.Writer, img image.Image, params RenderParams, about ...string) error {
+	defer observeEncode(w, time.Now())
+	if b := params.Bounds(); params.Crop != (PixelRect{}) && img.Bounds() != b {
+		if sub, ok := img.(subImager); ok {
+			img = sub.SubImage(b)
+		}
+	}
+	if size := thumbSize(img.Bounds().Size(), params.Thumb); size != img.Bounds().Size() {
+		img = downscale(img, size.X, size.Y)
+		// The overlays are drawn on the thumbnail as they would be on an image rendered at its size.
+		params.Size, params.Crop = size.X, PixelRect{}
+	}
+	img = postProcess(img, params)
+	if params.Grid {
+		img = drawGrid(img, params)
+	}
+	if len(params.orbit) > 0 {
+		img = drawOrbit(img, params)
+	}
+	if len(params.Marks) > 0 {
+		img = drawMarks(img, params)
+	}
+	if params.Label {
+		img = drawCaption(img, params, about)
+	}
+	img = transformImage(img, params.Transform)
+	switch params.Format {
+	case "jpeg":
+		// The JPEG encoder is much faster with 8-bit RGBA input than with RGBA64
+		rgba := image.NewRGBA(img.Bounds())
+		draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+		return jpeg.Encode(w, rgba, &jpeg.Options{Quality: params.Quality})
+	default:
+		enc := png.Encoder{CompressionLevel: pngLevels[params.PNGCompress]}
+		return enc.Encode(w, img)
+	}
+}
+
+// subImager is implemented by the image types of the standard library, which can return a
+// part of themselves.
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+// postProcess applies the finishing steps requested by params to a rendered image (or animation
+// frame): inverting its colors if params.Invert is set, then converting it to grayscale if
+// params.Mono is set.  It returns img itself if there is nothing to do.
+func postProcess(img image.Image, params RenderParams) image.Image {
+	if params.Invert {
+		img = invert(img)
+	}
+	if params.Mono {
+		img = monochrome(img)
+	}
+	return img
+}
+
+// invert returns a copy of img with its colors inverted and alpha unchanged.  Each channel c
+// becomes alpha - c, which is 65535 - c for opaque pixels, so that with the premultiplied
+// alpha of image/color, inversion also works for the partially transparent pixels the
+// renderers produce.
+func invert(img image.Image) *image.RGBA64 {
+	b := img.Bounds()
+	inv := image.NewRGBA64(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			inv.SetRGBA64(x, y, color.RGBA64{uint16(a - r), uint16(a - g), uint16(a - bl), uint16(a)})
+		}
+	}
+	return inv
+}
+
+// monochrome returns a grayscale copy of img, in which each pixel is the luminance of the
+// corresponding pixel of img.  Transparent pixels become black.
+func monochrome(img image.Image) *image.Gray16 {
+	gray := image.NewGray16(img.Bounds())
+	draw.Draw(gray, gray.Bounds(), img, img.Bounds().Min, draw.Src)
+	return gray
+}
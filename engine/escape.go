@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// An iteration maps an iterate z and a parameter c to the next iterate.
+// The escape-time functions in this file work with any iteration; juliaIFS and its variants
+// are the specialized (faster) versions for z -> z^2 + c.
+type iteration func(z, c complex128) complex128
+
+// quadraticStep is the iteration z -> z^2 + c, for code that needs it as an iteration.
+func quadraticStep(z, c complex128) complex128 {
+	return z*z + c
+}
+
+// abs2 returns the squared modulus of z.  The escape tests compare it with the squared escape
+// radius, which saves the square root of cmplx.Abs on every iteration.
+func abs2(z complex128) float64 {
+	return real(z)*real(z) + imag(z)*imag(z)
+}
+
+// escapeIFS iterates f starting at z until either maxIter iterations have completed or the modulus
+// of an iterate exceeds big.  Like juliaIFS, returns 0 in the first case (no escape);
+// otherwise the number of iterations required to escape, 1 if the first one takes z past big.
+func escapeIFS(z complex128, c complex128, f iteration, maxIter int, big float64) int {
+	big2 := big * big
+	for i := 1; i <= maxIter; i++ {
+		z = f(z, c)
+		if abs2(z) > big2 {
+			return i
+		}
+	}
+	return 0
+}
+
+// escapeIFSSmooth is the counterpart of juliaIFSSmooth for the iteration f, which should
+// grow like |z|^power for large |z|; the log(2) in the normalization becomes log(power).
+func escapeIFSSmooth(z complex128, c complex128, f iteration, maxIter int, big float64, power float64) float64 {
+	big2 := big * big
+	for i := 1; i <= maxIter; i++ {
+		z = f(z, c)
+		if abs2(z) > big2 {
+			return smoothCount(i, cmplx.Abs(z), power)
+		}
+	}
+	return 0
+}
+
+// minSmooth is the smallest smooth escape value, given to orbits that escape so fast that the
+// normalized count would be 0 or less, so that no escaping orbit reads as one that does not.
+const minSmooth = 1e-3
+
+// smoothCount returns the normalized iteration count
+//
+//	nu = n - log(log(modulus))/log(power)
+//
+// of an orbit that passes the escape radius at iteration n, counting from 1, with an iterate of
+// the given modulus, or minSmooth if that is smaller.
+func smoothCount(n int, modulus float64, power float64) float64 {
+	return math.Max(minSmooth, float64(n)-math.Log(math.Log(modulus))/math.Log(power))
+}
+
+// Iteration maps of escape-time renders, selected by RenderParams.Map.
+const (
+	MapSquare = "square" // z -> z^2 + c, or z^power + c
+	MapSin    = "sin"    // z -> c*sin(z)
+	MapCos    = "cos"    // z -> c*cos(z)
+	MapExp    = "exp"    // z -> c*exp(z)
+)
+
+// TranscendentalEscape is the default escape radius of the transcendental maps.  Their orbits
+// escape along strips (sin and cos) or to the right (exp) rather than in every direction, and
+// grow so fast once they do that a larger radius costs little while keeping points near the set
+// from being taken for escaping.
+const TranscendentalEscape = 50.0
+
+// iterationMaps describes each iteration map: its iteration, which is nil for MapSquare, whose
+// iteration depends on the power (see newColorer); the critical value of the map its
+// parameter-plane orbits start from; and its default escape radius.  The critical value of
+// z^power + c is 0, as it is for cos, and the critical point pi/2 of sin starts the orbit of
+// c*sin(z) at c.  exp has none, so its orbits start from the asymptotic value 0.
+// The escape radius of z^2 + c is 2, the smallest that decides escape exactly: if |z| > 2 and
+// |z| >= |c|, then |z^2 + c| >= |z|^2 - |z| > |z|, so the orbit grows without bound, while
+// orbits that stay within 2 need not escape.  A larger radius only adds iterations.
+var iterationMaps = map[string]struct {
+	step     iteration
+	critical complex128
+	escape   float64
+}{
+	MapSquare: {nil, 0, DefaultEscape},
+	MapSin:    {func(z, c complex128) complex128 { return c * cmplx.Sin(z) }, math.Pi / 2, TranscendentalEscape},
+	MapCos:    {func(z, c complex128) complex128 { return c * cmplx.Cos(z) }, 0, TranscendentalEscape},
+	MapExp:    {func(z, c complex128) complex128 { return c * cmplx.Exp(z) }, 0, TranscendentalEscape},
+}
+
+// ValidMap reports whether name names a supported iteration map.
+func ValidMap(name string) bool {
+	_, ok := iterationMaps[name]
+	return ok
+}
+
+// MapEscape returns the default escape radius of the iteration map named name, or DefaultEscape
+// if there is no such map.
+func MapEscape(name string) float64 {
+	if m, ok := iterationMaps[name]; ok {
+		return m.escape
+	}
+	return DefaultEscape
+}
+
+// powerStep returns the Multibrot iteration z -> z^power + c.  z^power is computed with cmplx.Pow,
+// which takes the principal branch, so a non-integer power has a branch cut along the negative
+// real axis and its images show a seam there instead of the (power-1)-fold symmetry of integer powers.
+func powerStep(power float64) iteration {
+	p := complex(power, 0)
+	return func(z, c complex128) complex128 {
+		return cmplx.Pow(z, p) + c
+	}
+}
+
+// escapeIFSTrap is the counterpart of juliaIFSTrap for the iteration f.
+func escapeIFSTrap(z complex128, c complex128, f iteration, maxIter int, big float64, trap string) float64 {
+	dist := trapDistance(z, trap)
+	big2 := big * big
+	for i := 0; i < maxIter; i++ {
+		z = f(z, c)
+		if abs2(z) > big2 {
+			break
+		}
+		dist = math.Min(dist, trapDistance(z, trap))
+	}
+	return dist
+}
+
+// escapeIFSMaxMod is the counterpart of juliaIFSMaxMod for the iteration f.
+func escapeIFSMaxMod(z complex128, c complex128, f iteration, maxIter int, big float64) float64 {
+	max2 := abs2(z)
+	big2 := big * big
+	for i := 0; i < maxIter; i++ {
+		z = f(z, c)
+		if abs2(z) > big2 {
+			break
+		}
+		max2 = math.Max(max2, abs2(z))
+	}
+	return math.Sqrt(max2)
+}
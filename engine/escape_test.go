@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// Each map has its own default escape radius: 2 for z^2 + c, and 50 for the transcendental maps.
+func TestMapEscape(t *testing.T) {
+	tests := []struct {
+		name string
+		want float64
+	}{
+		{MapSquare, 2},
+		{MapSin, TranscendentalEscape},
+		{MapCos, TranscendentalEscape},
+		{MapExp, TranscendentalEscape},
+		{"unknown", DefaultEscape},
+	}
+	for _, tt := range tests {
+		if got := MapEscape(tt.name); got != tt.want {
+			t.Errorf("MapEscape(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if got := DefaultRenderParams().Escape; got != 2 {
+		t.Errorf("default escape radius %v, want 2", got)
+	}
+}
+
+// Over the Mandelbrot window, the radius 2 picks out the same escaping points as the old default
+// of 10, only sooner: no point escapes 10 without first passing 2, and every point that passes 2
+// goes on to escape 10 (given some more iterations).
+func TestEscapeRadius2MatchesLarger(t *testing.T) {
+	const (
+		maxIter = 200
+		n       = 64
+	)
+	square := func(z, c complex128) complex128 { return z*z + c }
+	v := MandelbrotView
+	for py := 0; py < n; py++ {
+		for px := 0; px < n; px++ {
+			c := complex(v.x(px, n), v.y(py, n))
+			at2 := escapeIFS(0, c, square, maxIter, 2)
+			at10 := escapeIFS(0, c, square, 2*maxIter, 10)
+			if at10 != 0 && at10 <= maxIter && (at2 == 0 || at2 > at10) {
+				t.Errorf("c=%v: escapes 10 at iteration %d, but 2 at %d", c, at10, at2)
+			}
+			if at2 != 0 && at10 == 0 {
+				t.Errorf("c=%v: escapes 2 at iteration %d, but never 10", c, at2)
+			}
+		}
+	}
+}
+
+// Rendered at the default escape radius of 2, the default views show the same interior as at
+// the old radius of 10: points that escape in the first iteration, such as the corners of the
+// window, are colored as escaping, not as interior.
+func TestEscapeRadius2Interior(t *testing.T) {
+	tests := []struct {
+		name   string
+		view   Viewport
+		render func(RenderParams) image.Image
+	}{
+		{"julia", DefaultView, func(p RenderParams) image.Image { return juliaImage(-0.8+0.156i, p) }},
+		{"julia smooth", DefaultView, func(p RenderParams) image.Image {
+			p.Smooth = true
+			return juliaImage(-0.8+0.156i, p)
+		}},
+		{"mandelbrot", MandelbrotView, mandelbrotImage},
+		{"mandelbrot cycle check", MandelbrotView, func(p RenderParams) image.Image {
+			p.CycleCheck = true
+			return mandelbrotImage(p)
+		}},
+	}
+	for _, tt := range tests {
+		interior := map[float64]int{}
+		for _, escape := range []float64{2, 10} {
+			params := testParams(64)
+			params.View, params.Escape = tt.view, escape
+			img := tt.render(params)
+			b := img.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if color.RGBA64Model.Convert(img.At(x, y)) == params.interior() {
+						interior[escape]++
+					}
+				}
+			}
+			for _, p := range []image.Point{b.Min, {b.Max.X - 1, b.Min.Y}, {b.Min.X, b.Max.Y - 1}, b.Max.Sub(image.Pt(1, 1))} {
+				if color.RGBA64Model.Convert(img.At(p.X, p.Y)) == params.interior() {
+					t.Errorf("%s, escape %v: corner %v has the interior color", tt.name, escape, p)
+				}
+			}
+		}
+		if d := interior[2] - interior[10]; d < -10 || d > 10 {
+			t.Errorf("%s: %d interior pixels at escape 2, %d at escape 10", tt.name, interior[2], interior[10])
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+// The labels drawn on images use a small embedded bitmap font: glyphs of glyphHeight rows of
+// glyphWidth pixels, for the digits, the lower-case letters (upper-case letters are drawn in
+// lower case) and the punctuation that numbers and captions need.  Other characters are drawn
+// as a box.
+const (
+	glyphWidth   = 5
+	glyphHeight  = 7
+	glyphSpacing = 1 // blank columns between glyphs
+	labelPadding = 2 // margin around the text of a label, in font pixels
+)
+
+// glyphs holds the rows of each glyph, '#' for a set pixel.
+var glyphs = map[rune][glyphHeight]string{
+	' ': {".....", ".....", ".....", ".....", ".....", ".....", "....."},
+	'0': {".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	'1': {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2': {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3': {"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	'4': {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5': {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6': {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8': {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9': {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+	'+': {".....", "..#..", "..#..", "#####", "..#..", "..#..", "....."},
+	'-': {".....", ".....", ".....", "#####", ".....", ".....", "....."},
+	'.': {".....", ".....", ".....", ".....", ".....", ".##..", ".##.."},
+	',': {".....", ".....", ".....", ".....", ".##..", "..#..", ".#..."},
+	'=': {".....", ".....", "#####", ".....", "#####", ".....", "....."},
+	':': {".....", ".##..", ".##..", ".....", ".##..", ".##..", "....."},
+	'(': {"...#.", "..#..", ".#...", ".#...", ".#...", "..#..", "...#."},
+	')': {".#...", "..#..", "...#.", "...#.", "...#.", "..#..", ".#..."},
+	'[': {".###.", ".#...", ".#...", ".#...", ".#...", ".#...", ".###."},
+	']': {".###.", "...#.", "...#.", "...#.", "...#.", "...#.", ".###."},
+	'/': {".....", "....#", "...#.", "..#..", ".#...", "#....", "....."},
+	'^': {"..#..", ".#.#.", "#...#", ".....", ".....", ".....", "....."},
+	'a': {".....", ".....", ".###.", "....#", ".####", "#...#", ".####"},
+	'b': {"#....", "#....", "#.##.", "##..#", "#...#", "#...#", "####."},
+	'c': {".....", ".....", ".###.", "#....", "#....", "#...#", ".###."},
+	'd': {"....#", "....#", ".##.#", "#..##", "#...#", "#...#", ".####"},
+	'e': {".....", ".....", ".###.", "#...#", "#####", "#....", ".###."},
+	'f': {"..##.", ".#..#", ".#...", "###..", ".#...", ".#...", ".#..."},
+	'g': {".....", ".####", "#...#", "#...#", ".####", "....#", ".###."},
+	'h': {"#....", "#....", "#.##.", "##..#", "#...#", "#...#", "#...#"},
+	'i': {"..#..", ".....", ".##..", "..#..", "..#..", "..#..", ".###."},
+	'j': {"...#.", ".....", "..##.", "...#.", "...#.", "#..#.", ".##.."},
+	'k': {"#....", "#....", "#..#.", "#.#..", "##...", "#.#..", "#..#."},
+	'l': {".##..", "..#..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'm': {".....", ".....", "##.#.", "#.#.#", "#.#.#", "#...#", "#...#"},
+	'n': {".....", ".....", "#.##.", "##..#", "#...#", "#...#", "#...#"},
+	'o': {".....", ".....", ".###.", "#...#", "#...#", "#...#", ".###."},
+	'p': {".....", ".....", "####.", "#...#", "####.", "#....", "#...."},
+	'q': {".....", ".....", ".##.#", "#..##", ".####", "....#", "....#"},
+	'r': {".....", ".....", "#.##.", "##..#", "#....", "#....", "#...."},
+	's': {".....", ".....", ".###.", "#....", ".###.", "....#", "####."},
+	't': {".#...", ".#...", "###..", ".#...", ".#...", ".#..#", "..##."},
+	'u': {".....", ".....", "#...#", "#...#", "#...#", "#..##", ".##.#"},
+	'v': {".....", ".....", "#...#", "#...#", "#...#", ".#.#.", "..#.."},
+	'w': {".....", ".....", "#...#", "#...#", "#.#.#", "#.#.#", ".#.#."},
+	'x': {".....", ".....", "#...#", ".#.#.", "..#..", ".#.#.", "#...#"},
+	'y': {".....", ".....", "#...#", "#...#", ".####", "....#", ".###."},
+	'z': {".....", ".....", "#####", "...#.", "..#..", ".#...", "#####"},
+}
+
+// unknownGlyph is drawn for characters the font does not have.
+var unknownGlyph = [glyphHeight]string{"#####", "#...#", "#...#", "#...#", "#...#", "#...#", "#####"}
+
+var (
+	labelText       = color.RGBA64{0xffff, 0xffff, 0xffff, 0xffff}
+	labelBackground = color.RGBA64{0, 0, 0, 0xa000} // translucent black, premultiplied
+)
+
+// textSize returns the size in pixels of text drawn with the font magnified scale times.
+func textSize(text string, scale int) image.Point {
+	n := len([]rune(text))
+	if n == 0 {
+		return image.Point{}
+	}
+	return image.Pt((n*(glyphWidth+glyphSpacing)-glyphSpacing)*scale, glyphHeight*scale)
+}
+
+// drawText draws text onto img with its top-left corner at at, with the font magnified scale
+// times, in color c.
+func drawText(img draw.Image, at image.Point, text string, scale int, c color.Color) {
+	src := image.NewUniform(c)
+	x := at.X
+	for _, r := range strings.ToLower(text) {
+		glyph, ok := glyphs[r]
+		if !ok {
+			glyph = unknownGlyph
+		}
+		for gy, row := range glyph {
+			for gx := 0; gx < glyphWidth; gx++ {
+				if row[gx] == '#' {
+					pixel := image.Rect(x+gx*scale, at.Y+gy*scale, x+(gx+1)*scale, at.Y+(gy+1)*scale)
+					draw.Draw(img, pixel, src, image.Point{}, draw.Over)
+				}
+			}
+		}
+		x += (glyphWidth + glyphSpacing) * scale
+	}
+}
+
+// labelSize returns the size in pixels of the label drawLabel draws for text.
+func labelSize(text string, scale int) image.Point {
+	return textSize(text, scale).Add(image.Pt(2*labelPadding*scale, 2*labelPadding*scale))
+}
+
+// drawLabel draws text onto img in white on a translucent black box, so that it can be read on
+// any background, with the top-left corner of the box at at.
+func drawLabel(img draw.Image, at image.Point, text string, scale int) {
+	box := image.Rectangle{at, at.Add(labelSize(text, scale))}
+	draw.Draw(img, box, image.NewUniform(labelBackground), image.Point{}, draw.Over)
+	drawText(img, at.Add(image.Pt(labelPadding*scale, labelPadding*scale)), text, scale, labelText)
+}
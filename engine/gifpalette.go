@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"sort"
+)
+
+// Palettes that GIF animation frames are reduced to, selected by AnimParams.GIFPalette.
+const (
+	GIFPlan9    = "plan9"    // The fixed Plan 9 palette, the same for every frame
+	GIFAdaptive = "adaptive" // A palette fitted to the colors of each frame by median cut
+	GIFRamp     = "ramp"     // Evenly spaced samples of the coloring palette, plus the interior color
+	// GIFGlobal is one palette fitted by median cut to a sample of frames before the animation
+	// starts, shared by every frame so that colors do not shift from one frame to the next.
+	GIFGlobal = "global"
+)
+
+// ValidGIFPalette reports whether name is one of the GIF frame palettes.
+func ValidGIFPalette(name string) bool {
+	return name == GIFPlan9 || name == GIFAdaptive || name == GIFRamp || name == GIFGlobal
+}
+
+const (
+	gifColors = 256 // Number of colors in a GIF frame palette
+	// Number of frames, and their size in pixels, sampled to fit the GIFGlobal palette
+	globalSamples    = 8
+	globalSampleSize = 128
+)
+
+// gifPalette returns a function giving the palette, of at most gifColors colors, to reduce each
+// rendered and post-processed frame to, according to the GIF palette named by name.  Monochrome
+// frames always use shades of gray.  For every palette but GIFAdaptive the palette is the same
+// for every frame, and is also returned as shared.  jobs are the jobs rendering the frames of the
+// animation, which GIFGlobal samples.
+func gifPalette(ctx context.Context, name string, params RenderParams, jobs []*frameJob) (perFrame func(image.Image) color.Palette, shared color.Palette) {
+	switch {
+	case params.Mono:
+		shared = grays
+	case name == GIFAdaptive:
+		return func(img image.Image) color.Palette { return medianCut(img, gifColors) }, nil
+	case name == GIFRamp:
+		shared = rampPalette(params)
+	case name == GIFGlobal:
+		shared = globalPalette(ctx, params, jobs)
+	default:
+		shared = palette.Plan9[:gifColors]
+	}
+	return func(image.Image) color.Palette { return shared }, shared
+}
+
+// globalPalette fits a palette by median cut to up to globalSamples of the frames of jobs, evenly
+// spaced through the animation and rendered at no more than globalSampleSize pixels square.
+// If ctx is canceled first, it returns the Plan 9 palette.
+func globalPalette(ctx context.Context, params RenderParams, jobs []*frameJob) color.Palette {
+	n := min(len(jobs), globalSamples)
+	size := min(params.Size, globalSampleSize)
+	samples := image.NewRGBA64(image.Rect(0, 0, size, n*size))
+	for i := 0; i < n; i++ {
+		sample := *jobs[i*len(jobs)/n]
+		sample.params.Size = size
+		img := renderFrame(ctx, &sample)
+		if img == nil {
+			return palette.Plan9[:gifColors]
+		}
+		draw.Draw(samples, image.Rect(0, i*size, size, (i+1)*size), img, image.Point{}, draw.Src)
+	}
+	return medianCut(postProcess(samples, params), gifColors)
+}
+
+// rampPalette returns gifColors-1 evenly spaced samples of the palette of params, plus black
+// for the interior, post-processed like the frames themselves so that inverted frames get
+// an inverted ramp.
+func rampPalette(params RenderParams) color.Palette {
+	pal := params.palette()
+	ramp := image.NewRGBA64(image.Rect(0, 0, gifColors, 1))
+	for i := 0; i < gifColors-1; i++ {
+		ramp.SetRGBA64(i, 0, pal(float64(i)/float64(gifColors-2)))
+	}
+	ramp.SetRGBA64(gifColors-1, 0, color.RGBA64{0, 0, 0, 60000})
+	processed := postProcess(ramp, params)
+	p := make(color.Palette, gifColors)
+	for i := range p {
+		p[i] = processed.At(i, 0)
+	}
+	return p
+}
+
+// colorBin counts the pixels whose colors fall in one cell of a 32x32x32 grid over RGB space.
+type colorBin struct {
+	key              [3]uint8 // cell coordinates, the top 5 bits of each channel
+	count            int
+	sumR, sumG, sumB int // sums of the 8-bit channels of the pixels in the cell
+}
+
+// medianCut returns a palette of at most n colors fitted to the colors of img by the median cut
+// algorithm: starting with a box holding every color, it repeatedly splits the box with the
+// widest range along one channel at the pixel median of that channel, until there are n boxes,
+// and then takes the mean color of each box.  Colors are binned to 5 bits per channel first,
+// which keeps the work independent of the size of the image.
+func medianCut(img image.Image, n int) color.Palette {
+	var grid [32 * 32 * 32]colorBin
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			r, g, bl = r>>8, g>>8, bl>>8
+			bin := &grid[r>>3<<10|g>>3<<5|bl>>3]
+			bin.key = [3]uint8{uint8(r >> 3), uint8(g >> 3), uint8(bl >> 3)}
+			bin.count++
+			bin.sumR += int(r)
+			bin.sumG += int(g)
+			bin.sumB += int(bl)
+		}
+	}
+	var bins []colorBin
+	for _, bin := range grid {
+		if bin.count > 0 {
+			bins = append(bins, bin)
+		}
+	}
+
+	// widest returns the channel along which box spans the widest range, and that range
+	widest := func(box []colorBin) (int, int) {
+		channel, width := 0, -1
+		for c := 0; c < 3; c++ {
+			lo, hi := uint8(255), uint8(0)
+			for _, bin := range box {
+				lo, hi = min(lo, bin.key[c]), max(hi, bin.key[c])
+			}
+			if int(hi)-int(lo) > width {
+				channel, width = c, int(hi)-int(lo)
+			}
+		}
+		return channel, width
+	}
+	boxes := [][]colorBin{bins}
+	for len(boxes) < n {
+		// split the box with the widest range; stop once every box is a single cell
+		split, channel, width := -1, 0, 0
+		for i, box := range boxes {
+			if c, w := widest(box); w > width {
+				split, channel, width = i, c, w
+			}
+		}
+		if split < 0 {
+			break
+		}
+		box := boxes[split]
+		sort.Slice(box, func(i, j int) bool { return box[i].key[channel] < box[j].key[channel] })
+		total := 0
+		for _, bin := range box {
+			total += bin.count
+		}
+		// cut at the median pixel, keeping at least one cell on each side
+		k, seen := 1, box[0].count
+		for k < len(box)-1 && seen+box[k].count <= total/2 {
+			seen += box[k].count
+			k++
+		}
+		boxes[split] = box[:k]
+		boxes = append(boxes, box[k:])
+	}
+
+	p := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		var count, r, g, bl int
+		for _, bin := range box {
+			count += bin.count
+			r += bin.sumR
+			g += bin.sumG
+			bl += bin.sumB
+		}
+		p[i] = color.RGBA{uint8(r / count), uint8(g / count), uint8(bl / count), 0xff}
+	}
+	return p
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"compress/lzw"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"time"
+)
+
+// gifStream writes an animated GIF one frame at a time, so frames can be delivered to a client
+// as soon as they are rendered instead of after the whole animation has been encoded.
+// Each frame carries its own (local) color table, unless its palette is the global color table
+// given to newGIFStream.  If the underlying writer can be flushed (e.g. an http.ResponseWriter),
+// it is flushed after every frame, and if it is an EncodeObserver, it is told how long each frame
+// took to encode.
+type gifStream struct {
+	w      *bufio.Writer
+	dst    io.Writer // the underlying writer
+	flush  func()
+	global color.Palette // the global color table, if any
+	buf    bytes.Buffer  // LZW-compressed pixels of the frame being written
+}
+
+// newGIFStream writes the GIF header for a width x height animation that repeats loop times
+// (0 = forever) to w and returns a gifStream ready to accept frames.  If global is not nil, it is
+// written as the global color table, which frames using the same palette share.
+func newGIFStream(w io.Writer, width, height, loop int, global color.Palette) (*gifStream, error) {
+	if len(global) > 256 {
+		return nil, errors.New("gifstream: global palette must have at most 256 colors")
+	}
+	s := &gifStream{w: bufio.NewWriter(w), dst: w, flush: func() {}, global: global}
+	if f, ok := w.(interface{ Flush() }); ok {
+		s.flush = f.Flush
+	}
+	s.w.WriteString("GIF89a")
+	s.writeUint16(width)
+	s.writeUint16(height)
+	if len(global) == 0 {
+		s.w.Write([]byte{0x00, 0x00, 0x00}) // no global color table, background index, aspect ratio
+	} else {
+		sizeField := tableSize(global)
+		s.w.Write([]byte{0x80 | byte(sizeField), 0x00, 0x00})
+		s.writeColorTable(global, sizeField)
+	}
+
+	// NETSCAPE2.0 application extension carrying the loop count
+	s.w.Write([]byte{0x21, 0xff, 0x0b})
+	s.w.WriteString("NETSCAPE2.0")
+	s.w.Write([]byte{0x03, 0x01})
+	s.writeUint16(loop)
+	s.w.WriteByte(0x00)
+	return s, s.w.Flush()
+}
+
+// WriteFrame appends img, which must be an *image.Paletted, to the animation, to be displayed
+// for delay 100ths of a second.
+func (s *gifStream) WriteFrame(frame image.Image, delay int) error {
+	defer observeEncode(s.dst, time.Now())
+	img, ok := frame.(*image.Paletted)
+	if !ok {
+		return errors.New("gifstream: frames must be paletted images")
+	}
+	b := img.Bounds()
+	if len(img.Palette) == 0 || len(img.Palette) > 256 {
+		return errors.New("gifstream: palette must have between 1 and 256 colors")
+	}
+
+	local := !samePalette(img.Palette, s.global)
+	sizeField := tableSize(img.Palette)
+	if !local {
+		sizeField = tableSize(s.global)
+	}
+
+	// Graphic control extension: delay and optional transparent color
+	transparent, flags := 0, byte(0)
+	for i, c := range img.Palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			transparent, flags = i, 0x01
+			break
+		}
+	}
+	s.w.Write([]byte{0x21, 0xf9, 0x04, flags})
+	s.writeUint16(delay)
+	s.w.Write([]byte{byte(transparent), 0x00})
+
+	// Image descriptor and local color table
+	s.w.WriteByte(0x2c)
+	s.writeUint16(b.Min.X)
+	s.writeUint16(b.Min.Y)
+	s.writeUint16(b.Dx())
+	s.writeUint16(b.Dy())
+	if local {
+		s.w.WriteByte(0x80 | byte(sizeField))
+		s.writeColorTable(img.Palette, sizeField)
+	} else {
+		s.w.WriteByte(0x00)
+	}
+
+	// LZW-compressed pixels, split into sub-blocks of at most 255 bytes
+	litWidth := sizeField + 1
+	if litWidth < 2 {
+		litWidth = 2
+	}
+	s.buf.Reset()
+	lw := lzw.NewWriter(&s.buf, lzw.LSB, litWidth)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := img.PixOffset(b.Min.X, y)
+		if _, err := lw.Write(img.Pix[i : i+b.Dx()]); err != nil {
+			return err
+		}
+	}
+	if err := lw.Close(); err != nil {
+		return err
+	}
+	s.w.WriteByte(byte(litWidth))
+	data := s.buf.Bytes()
+	for len(data) > 0 {
+		n := min(len(data), 255)
+		s.w.WriteByte(byte(n))
+		s.w.Write(data[:n])
+		data = data[n:]
+	}
+	s.w.WriteByte(0x00)
+
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+// Close writes the GIF trailer.  It does not close the underlying writer.
+func (s *gifStream) Close() error {
+	s.w.WriteByte(0x3b)
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+// tableSize returns the size field of a color table holding pal, which has 2^(sizeField+1) entries.
+func tableSize(pal color.Palette) int {
+	sizeField := 0
+	for 1<<(sizeField+1) < len(pal) {
+		sizeField++
+	}
+	return sizeField
+}
+
+// writeColorTable writes pal as a color table of 2^(sizeField+1) entries, padded with black.
+func (s *gifStream) writeColorTable(pal color.Palette, sizeField int) {
+	for i := 0; i < 1<<(sizeField+1); i++ {
+		var r, g, bl uint32
+		if i < len(pal) {
+			r, g, bl, _ = pal[i].RGBA()
+		}
+		s.w.Write([]byte{byte(r >> 8), byte(g >> 8), byte(bl >> 8)})
+	}
+}
+
+// samePalette reports whether a and b are the same non-empty palette.
+func samePalette(a, b color.Palette) bool {
+	if len(a) == 0 || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeUint16 writes v in little-endian order, as GIF requires.
+func (s *gifStream) writeUint16(v int) {
+	s.w.Write([]byte{byte(v), byte(v >> 8)})
+}
@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// Small renders with fixed parameters match their golden images, to catch unintended changes to
+// the coloring or the mapping of pixels to the plane.  Run go test -update after an intended one.
+// The corners of the escape-time renders lie well outside the sets, so they must not have the
+// interior color.
+func TestRenderGolden(t *testing.T) {
+	tests := []struct {
+		name       string
+		render     func(params RenderParams, w *bytes.Buffer)
+		adjust     func(params *RenderParams)
+		escapeTime bool
+	}{
+		{"newton.png", func(p RenderParams, w *bytes.Buffer) { Newton(2, p, w) }, nil, false},
+		{"newton_degree5.png", func(p RenderParams, w *bytes.Buffer) { Newton(2, p, w) }, func(p *RenderParams) { p.Degree = 5 }, false},
+		{"julia.png", func(p RenderParams, w *bytes.Buffer) { JuliaSingle(-0.8+0.156i, p, w) }, nil, true},
+		{"julia_smooth.png", func(p RenderParams, w *bytes.Buffer) { JuliaSingle(-0.4+0.6i, p, w) }, func(p *RenderParams) { p.Smooth = true }, true},
+		{"mandelbrot.png", func(p RenderParams, w *bytes.Buffer) { Mandelbrot(p, w) }, func(p *RenderParams) { p.View = MandelbrotView }, true},
+	}
+	for _, tt := range tests {
+		params := testParams(64)
+		if tt.adjust != nil {
+			tt.adjust(&params)
+		}
+		var buf bytes.Buffer
+		tt.render(params, &buf)
+		checkGolden(t, tt.name, buf.Bytes())
+		if !tt.escapeTime {
+			continue
+		}
+		img := decodeFrames(t, tt.name, buf.Bytes())[0]
+		b := img.Bounds()
+		for _, p := range []image.Point{b.Min, {b.Max.X - 1, b.Min.Y}, {b.Min.X, b.Max.Y - 1}, b.Max.Sub(image.Pt(1, 1))} {
+			if color.RGBA64Model.Convert(img.At(p.X, p.Y)) == params.interior() {
+				t.Errorf("%s: corner %v has the interior color", tt.name, p)
+			}
+		}
+	}
+}
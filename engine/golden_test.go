@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden images in testdata with the current output")
+
+// checkGolden compares the image or GIF animation encoded in got with the golden file
+// testdata/name, pixel for pixel, so that changes in how the encoders compress do not count.
+// With -update, it writes got to the golden file instead.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	gotFrames, wantFrames := decodeFrames(t, name, got), decodeFrames(t, name, want)
+	if len(gotFrames) != len(wantFrames) {
+		t.Fatalf("%s: %d frames, want %d", name, len(gotFrames), len(wantFrames))
+	}
+	for i := range gotFrames {
+		if p, ok := firstDifference(gotFrames[i], wantFrames[i]); !ok {
+			t.Errorf("%s: frame %d differs from the golden image at %v", name, i, p)
+		}
+	}
+}
+
+// decodeFrames decodes the frames of a GIF animation, or the image of a PNG file, by the
+// extension of name.
+func decodeFrames(t *testing.T, name string, data []byte) []image.Image {
+	t.Helper()
+	if filepath.Ext(name) == ".gif" {
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		frames := make([]image.Image, len(anim.Image))
+		for i, frame := range anim.Image {
+			frames[i] = frame
+		}
+		return frames
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return []image.Image{img}
+}
+
+// firstDifference returns the first pixel where a and b differ, and whether they are the same.
+// Images of different bounds differ at the minimum point of a.
+func firstDifference(a, b image.Image) (image.Point, bool) {
+	r := a.Bounds()
+	if r != b.Bounds() {
+		return r.Min, false
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if color.RGBA64Model.Convert(a.At(x, y)) != color.RGBA64Model.Convert(b.At(x, y)) {
+				return image.Pt(x, y), false
+			}
+		}
+	}
+	return image.Point{}, true
+}
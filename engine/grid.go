@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+)
+
+// gridLines is the most gridlines drawn across the window in each direction.  The spacing is
+// the smallest 1, 2 or 5 times a power of ten that gives no more.
+const gridLines = 8
+
+var (
+	gridColor = color.RGBA64{0x6000, 0x6000, 0x6000, 0x6000} // translucent white, premultiplied
+	axisColor = color.RGBA64{0xe000, 0xe000, 0xe000, 0xe000}
+)
+
+// gridStep returns the spacing of the gridlines across a window span wide.
+func gridStep(span float64) float64 {
+	raw := span / gridLines
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if m*mag >= raw {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+// tickLabel formats the value v of a gridline step apart from its neighbors, with just the
+// decimals that tell them apart.
+func tickLabel(v, step float64) string {
+	decimals := max(0, int(math.Ceil(-math.Log10(step)-1e-9)))
+	if v == 0 {
+		return "0" // not -0
+	}
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
+
+// gridTicks returns the values of the gridlines across [lo, hi] step apart, and their pixel
+// offsets in a size pixel image of it, where pixel p shows lo + p/size*(hi-lo).  It returns
+// none if the window is too narrow for float64 to tell the gridlines apart.
+func gridTicks(lo, hi, step float64, size int) (values []float64, pixels []int) {
+	k0 := math.Ceil(lo / step)
+	if math.Abs(k0) > 1<<52 {
+		return nil, nil
+	}
+	for k := k0; k*step <= hi && len(values) <= gridLines; k++ {
+		values = append(values, k*step)
+		pixels = append(pixels, int(math.Round((k*step-lo)/(hi-lo)*float64(size))))
+	}
+	return values, pixels
+}
+
+// drawGrid draws a coordinate grid over img, an image of params.View (or a crop of one), and
+// returns the result: light gridlines at round values of the real and imaginary parts, the axes
+// in brighter lines, and tick labels giving the values of the gridlines along the top and left
+// edges, leaving out any that would overlap the one before.  Lines and labels are thicker on
+// large images, as captions are.  img is drawn on directly if it can be.
+func drawGrid(img image.Image, params RenderParams) image.Image {
+	dst := drawable(img)
+	v, size := params.View, params.Size
+	scale := max(1, size/captionPixels)
+	margin := 2 * scale
+	lineAt := func(p int) (int, int) { return p - scale/2, p - scale/2 + scale }
+	lineColor := func(value float64) *image.Uniform {
+		if value == 0 {
+			return image.NewUniform(axisColor)
+		}
+		return image.NewUniform(gridColor)
+	}
+
+	// The real parts label the vertical lines in a band along the top edge, and the imaginary
+	// parts the horizontal lines below that band, so that the two never overlap.
+	band := labelSize("0", scale).Y + margin
+	step := gridStep(v.XMax - v.XMin)
+	xs, pxs := gridTicks(v.XMin, v.XMax, step, size)
+	free := 0 // labels that would overlap the last one drawn are left out
+	for i, x := range xs {
+		x0, x1 := lineAt(pxs[i])
+		draw.Draw(dst, image.Rect(x0, 0, x1, size), lineColor(x), image.Point{}, draw.Over)
+		text := tickLabel(x, step)
+		if at := image.Pt(x1+margin, margin); at.X >= free && at.X+labelSize(text, scale).X <= size {
+			drawLabel(dst, at, text, scale)
+			free = at.X + labelSize(text, scale).X + margin
+		}
+	}
+	step = gridStep(v.YMax - v.YMin)
+	ys, pys := gridTicks(v.YMin, v.YMax, step, size)
+	free = band
+	for i, y := range ys {
+		y0, y1 := lineAt(pys[i])
+		draw.Draw(dst, image.Rect(0, y0, size, y1), lineColor(y), image.Point{}, draw.Over)
+		text := tickLabel(y, step) + "i"
+		if at := image.Pt(margin, y1+margin); at.Y >= free && at.Y+labelSize(text, scale).Y <= size {
+			drawLabel(dst, at, text, scale)
+			free = at.Y + labelSize(text, scale).Y + margin
+		}
+	}
+	return dst
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"sync"
+)
+
+const (
+	MinInsetSize = 16 // Smallest Julia inset accepted from a request, in pixels
+	// DefaultInsetFraction is the default size of the Julia inset as a fraction of the size of the
+	// Mandelbrot image.
+	DefaultInsetFraction = 4
+)
+
+// MandelbrotInset creates an image of the Mandelbrot set, as Mandelbrot would render it with
+// params, with a thumbnail of the Julia set for c, inset pixels square, in the corner named by
+// corner (one of the caption positions, such as LabelTopRight), and a crosshair marking c on the
+// Mandelbrot set.  The thumbnail shows DefaultView, framed by a light border; apart from the
+// window and the size, it is rendered with params, so it has the same power, map and colors.
+// The two images are rendered concurrently.  params.Marks are drawn on the Mandelbrot set only;
+// params.Crop and params.Grid are ignored.
+func MandelbrotInset(c complex128, params RenderParams, inset int, corner string, w io.Writer) {
+	params.Crop, params.Grid = PixelRect{}, false
+	juliaParams := params
+	juliaParams.Size, juliaParams.View = inset, DefaultView
+	juliaParams.Precision = min(params.Precision, 53) // the default window needs no more
+
+	var img, thumb image.Image
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		img = mandelbrotImage(params)
+	}()
+	go func() {
+		defer wg.Done()
+		thumb = juliaImage(c, juliaParams)
+	}()
+	wg.Wait()
+
+	dst := drawable(img)
+	drawMarker(dst, c, params.View, params.Size)
+	drawMarks(dst, params) // under the thumbnail, which covers that corner of the set
+	params.Marks = nil
+	scale := max(1, params.Size/captionPixels)
+	border, margin := scale, 4*scale
+	b := dst.Bounds()
+	at := image.Pt(b.Max.X-margin-inset, b.Min.Y+margin)
+	switch corner {
+	case LabelTopLeft:
+		at.X = b.Min.X + margin
+	case LabelBottomLeft:
+		at = image.Pt(b.Min.X+margin, b.Max.Y-margin-inset)
+	case LabelBottomRight:
+		at.Y = b.Max.Y - margin - inset
+	}
+	frame := image.Rectangle{at, at.Add(image.Pt(inset, inset))}
+	draw.Draw(dst, frame.Inset(-border), image.NewUniform(dividerColor), image.Point{}, draw.Src)
+	draw.Draw(dst, frame, thumb, thumb.Bounds().Min, draw.Src)
+	encodeImage(w, dst, params, fmt.Sprintf("c=%s", CLabel(c)))
+}
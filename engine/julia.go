@@ -1,12 +1,11 @@
 package engine
 
 import (
+	"context"
 	"image"
 	"image/color"
-	"image/color/palette"
 	"image/draw"
 	"image/gif"
-	"image/png"
 	"io"
 	"log"
 	"math"
@@ -14,85 +13,261 @@ import (
 	"time"
 )
 
-func Julia(nFrames int, nWorkers int, paramPath string, writer io.Writer) {
-	const (
-		xmin, ymin, xmax, ymax = -2, -2, +2, +2
-		width, height          = 1024, 1024
-		delay                  = 8
-	)
+const (
+	DefaultMaxIter  = 400    // Default iteration cap for escape-time renders
+	MaxIterLimit    = 100000 // Largest iteration cap accepted from a request
+	DefaultEscape   = 2.0    // Default escape radius of z -> z^2 + c: no orbit that passes it comes back
+	DefaultDelay    = 8      // Default delay between animation frames, in 100ths of a second
+	MaxFrames       = 1024   // Largest number of animation frames accepted from a request
+	DefaultMaxPower = 5      // Default exponent reached at the last frame of the Power path
+	PowerLimit      = 16     // Largest exponent accepted from a request
+	DefaultTurns    = 3      // Default number of turns of the Spiral path
+	MaxTurns        = 1000   // Largest number of turns of the Spiral path accepted from a request
+	// DefaultZoomFactor is the default magnification from one frame of the Zoom path to the next.
+	DefaultZoomFactor = 1.1
+	MaxZoomFactor     = 10 // Largest magnification per frame of the Zoom path accepted from a request
+	// MaxEscape is the largest escape radius accepted from a request.  The escape tests compare
+	// squared moduli, and the square of a larger radius would overflow.
+	MaxEscape = 1e150
+)
 
-	// A paramFunc is a function that takes a frame number and number of frames as arguments
-	// and returns a c value.  For example, watFunc varies the c parameter along the real axis
-	// over a range from -1.45 to -1.25 (and back again) in increments determined by the number of frames.
-	type paramFunc func(int, int) complex128
+// Output formats for Julia animations, selected by AnimParams.Format.
+const (
+	AnimGIF  = "gif"  // Animated GIF, with each frame dithered to a 256-color palette
+	AnimAPNG = "apng" // Animated PNG, with each frame in full 16-bit RGBA color
+)
 
-	// Create a map of parameter functions, keyed by name
-	paramFuncs := map[string]paramFunc{
-		"Angor":  watFunc,
-		"Exp":    expFunc,
-		"Wabbit": linFunc,
+// animFormats maps the supported animation formats to their MIME types.
+var animFormats = map[string]string{
+	AnimGIF:  "image/gif",
+	AnimAPNG: "image/apng",
+}
+
+// AnimContentType returns the MIME type of the named animation format and true, or the MIME
+// type of animated GIF and false if the format is not supported.
+func AnimContentType(format string) (string, bool) {
+	ct, ok := animFormats[format]
+	if !ok {
+		return animFormats[AnimGIF], false
+	}
+	return ct, true
+}
+
+// An animationStream writes the frames of an animation as they are delivered.
+type animationStream interface {
+	WriteFrame(img image.Image, delay int) error
+	Close() error
+}
+
+// AnimParams holds the settings that control a Julia animation.
+type AnimParams struct {
+	Frames  int        // Number of frames in the animation
+	Workers int        // Number of goroutines rendering frames
+	Path    string     // Name of the parameter path followed by c
+	CStart  complex128 // First c value of the Line path
+	CEnd    complex128 // Last c value of the Line path; CStart is also the fixed c of the Power path
+	// MaxPower is the exponent reached at the last frame of the Power path, which sweeps the
+	// exponent of z -> z^power + c up from params.Power while c stays fixed at CStart.
+	MaxPower float64
+	Turns    float64 // Number of turns c makes about the origin along the Spiral path
+	Delay    int     // Delay between frames, in 100ths of a second
+	Loop     int     // Number of times the animation loops; 0 loops forever
+	// Boomerang appends the frames in reverse order (minus the endpoints), so the animation
+	// plays forward and then backward and loops seamlessly along any parameter path.
+	Boomerang bool
+	Format    string // Output format, AnimGIF or AnimAPNG
+	// GIFPalette names the palette GIF frames are dithered to: GIFPlan9, GIFAdaptive, GIFRamp
+	// or GIFGlobal.  It defaults to GIFPlan9 and is ignored for AnimAPNG.
+	GIFPalette string
+	// ZoomFactor is the magnification from each frame of the Zoom path to the next.  The Zoom
+	// path holds c at CStart and instead shrinks the window about the center of params.View.
+	ZoomFactor float64
+	// Mandelbrot renders the Mandelbrot set (or Multibrot set, for other powers) in every frame
+	// instead of a Julia set, so that the c values of the path are ignored.
+	Mandelbrot bool
+	// Cs, if not empty, gives the c value of each frame explicitly, in place of the parameter
+	// path.  Frames must then be len(Cs).
+	Cs []complex128
+}
+
+// A ProgressObserver is told how many frames of an animation written to it have been rendered.
+// The writers passed to Julia may implement it to report progress on long animations.
+type ProgressObserver interface {
+	ObserveProgress(done, total int)
+}
+
+// observeProgress tells w, if it is a ProgressObserver, that done of total frames are rendered.
+func observeProgress(w io.Writer, done, total int) {
+	if o, ok := w.(ProgressObserver); ok {
+		o.ObserveProgress(done, total)
 	}
+}
+
+// Julia creates an animation with anim.Frames frames, each showing the Julia set
+// for z -> z^power + c with c taken from the parameter path named by anim.Path, and writes it to w
+// as an animated GIF, or an animated PNG if anim.Format is AnimAPNG.
+// The Power path holds c at anim.CStart and instead moves the exponent from params.Power to anim.MaxPower,
+// the Zoom path holds c at anim.CStart and dives into the center of params.View, magnifying it
+// anim.ZoomFactor times more at each frame, and if anim.Cs is not empty, the frames use its c
+// values instead of a path.  With anim.Mandelbrot set, the frames show the Mandelbrot set instead.
+// Frames are rendered concurrently by anim.Workers goroutines using the iteration settings in params.
+// If ctx is canceled (e.g. the client goes away or the server shuts down), the workers stop
+// starting new frames and Julia returns without finishing the animation.  If w is a
+// ProgressObserver, it is told each time a frame is rendered.
+func Julia(ctx context.Context, animParams AnimParams, params RenderParams, w io.Writer) {
+	width, height := params.Size, params.Size
 
+	nFrames, nWorkers, paramPath := animParams.Frames, animParams.Workers, animParams.Path
 	start := time.Now()
 
 	log.Printf(" Starting job with nframes = %d nworkers = %d parampath = %s \n", nFrames, nWorkers, paramPath)
 
-	anim := gif.GIF{LoopCount: nFrames}         // The animated GIF we are building
-	jobs := make(chan *frameParameter, nFrames) // <i, c> pairs where c is the parameter for ith frame
-	results := make(chan *frame, nFrames)       // Channel for workers to deliver completed frames
-	frames := make([]*image.Paletted, nFrames)  // Completed frames
+	jobs := make(chan *frameJob, nFrames)  // The frames to render, with their parameters
+	results := make(chan *frame, nFrames)  // Channel for workers to deliver completed frames
+	frames := make([]image.Image, nFrames) // Completed frames
 
-	for k := 0; k < nFrames; k++ { // Push frame generation jobs into the channel
-		cp := paramFuncs[paramPath](k, nFrames)
-		fp := frameParameter{
-			k,
-			cp,
-		}
-		jobs <- &fp
+	frameJobs := newFrameJobs(animParams, params)
+	for _, job := range frameJobs { // Push frame generation jobs into the channel
+		jobs <- job
 	}
 
+	// GIF frames are dithered to a palette; the GIFGlobal palette also becomes the GIF's global
+	// color table, so that frames need not repeat it
+	var framePalette func(image.Image) color.Palette
+	var globalTable color.Palette
+	if animParams.Format != AnimAPNG {
+		var shared color.Palette
+		framePalette, shared = gifPalette(ctx, animParams.GIFPalette, params, frameJobs)
+		if animParams.GIFPalette == GIFGlobal {
+			globalTable = shared
+		}
+	}
 	for i := 0; i < nWorkers; i++ { // Start the worker goroutines
-		go frameWorker(jobs, results)
+		go frameWorker(ctx, jobs, results, framePalette)
 	}
 	close(jobs) // Close the channel
 
+	// Stream frames to w as they complete.  Workers finish out of order, so completed frames
+	// are held until all of their predecessors have been written.
+	var stream animationStream
+	var err error
+	if animParams.Format == AnimAPNG {
+		total := nFrames
+		if animParams.Boomerang {
+			total += max(0, nFrames-2)
+		}
+		stream, err = newAPNGStream(w, width, height, total, animParams.Loop)
+	} else {
+		stream, err = newGIFStream(w, width, height, animParams.Loop, globalTable)
+	}
+	next := 0 // index of the next frame to write
 	for i := 0; i < nFrames; i++ {
-		frame := <-results
+		var frame *frame
+		select {
+		case frame = <-results:
+		case <-ctx.Done():
+			log.Println("Abandoning animation:", ctx.Err())
+			return
+		}
 		frames[frame.index] = frame.img
+		observeProgress(w, i+1, nFrames)
+		for ; err == nil && next < nFrames && frames[next] != nil; next++ {
+			err = stream.WriteFrame(frames[next], animParams.Delay)
+		}
 	}
 
-	for i := 0; i < nFrames; i++ { // add frames *in order*
-		frame := frames[i]
-		anim.Delay = append(anim.Delay, delay)
-		anim.Image = append(anim.Image, frame)
+	if animParams.Boomerang { // play the frames back in reverse, without repeating the endpoints
+		for i := nFrames - 2; err == nil && i > 0; i-- {
+			err = stream.WriteFrame(frames[i], animParams.Delay)
+		}
+	}
+	if err == nil {
+		err = stream.Close()
+	}
+	if err != nil {
+		log.Println("Error writing animation:", err)
 	}
 	elapsed := time.Since(start)
 	log.Printf("Took %s", elapsed)
-	gif.EncodeAll(writer, &anim)
 }
 
-// Creates a PNG image of a single Julia set for the process z->z^2 + c.
-// The c parameter is constructed from the re and im request parameters.
-func JuliaSingle(c complex128, w io.Writer) {
-	const (
-		xmin, ymin, xmax, ymax = -2, -2, +2, +2
-		width, height          = 1024, 1024
-	)
-	img := image.NewRGBA64(image.Rect(0, 0, width, height))
-	for py := 0; py < height; py++ {
-		y := float64(py)/height*(ymax-ymin) + ymin
-		for px := 0; px < width; px++ {
-			x := float64(px)/width*(xmax-xmin) + xmin
-			z := complex(x, y)
-			result := juliaIFS(z, c, 400, 10.0)
-			co := color.RGBA64{0, 0, 0, 60000}
-			if result > 0 {
-				co = color.RGBA64{0, uint16(2000 * result), 60000 - uint16(2000*result), 60000}
-			}
-			img.Set(px, py, co)
+// newFrameJobs returns the jobs rendering the frames of the animation described by animParams and
+// params, each with its c value and params resolved for the frame: the exponent of the Power
+// path and the window of the Zoom path.
+func newFrameJobs(animParams AnimParams, params RenderParams) []*frameJob {
+	// A paramFunc is a function that takes a frame number and number of frames as arguments
+	// and returns a c value.  For example, watFunc varies the c parameter along the real axis
+	// over a range from -1.45 to -1.25 (and back again) in increments determined by the number of frames.
+	type paramFunc func(int, int) complex128
+
+	// Create a map of parameter functions, keyed by name
+	paramFuncs := map[string]paramFunc{
+		"Angor":  watFunc,
+		"Exp":    expFunc,
+		"Wabbit": linFunc,
+		"Line":   lineFunc(animParams.CStart, animParams.CEnd),
+		"Spiral": spiralFunc(animParams.Turns),
+	}
+
+	nFrames, paramPath := animParams.Frames, animParams.Path
+	jobs := make([]*frameJob, nFrames)
+	for k := 0; k < nFrames; k++ {
+		job := frameJob{
+			index:      k,
+			mandelbrot: animParams.Mandelbrot,
+			params:     params,
 		}
+		if len(animParams.Cs) > 0 {
+			job.c = animParams.Cs[k]
+		} else if paramPath == "Power" {
+			job.c = animParams.CStart
+			job.params.Power = powerFunc(params.Power, animParams.MaxPower)(k, nFrames)
+		} else if paramPath == "Zoom" {
+			job.c = animParams.CStart
+			job.params.View = zoomFunc(params.View, animParams.ZoomFactor)(k, nFrames)
+		} else {
+			job.c = paramFuncs[paramPath](k, nFrames)
+		}
+		jobs[k] = &job
 	}
-	png.Encode(w, img)
+	return jobs
+}
+
+// Creates a PNG image of a single Julia set for the process z->z^power + c.
+// The c parameter is constructed from the re and im request parameters.
+// params supplies the window, iteration cap, escape radius, coloring mode and supersampling factor.
+// If params.Precision is above 53 and params.Power is 2, the image is rendered with math/big
+// instead (see renderBig), and histogram coloring falls back to escape coloring.
+func JuliaSingle(c complex128, params RenderParams, w io.Writer) {
+	img := juliaImage(c, params)
+	params.orbit = orbitPoints(c, juliaStep(params), params)
+	encodeImage(w, img, params, "c="+CLabel(c))
+}
+
+// juliaImage renders the image JuliaSingle encodes, before post-processing.
+func juliaImage(c complex128, params RenderParams) image.Image {
+	width, height := params.Size, params.Size
+	cl := newColorer(params, params.interior(), params.pixelWidth())
+	if params.Precision > 53 && cl.step == nil {
+		return renderBig(width, height, params, cl.juliaBig(c))
+	}
+	cl.equalize(func(z complex128) float64 { return cl.escapeValue(z, c) })
+	render := renderImage
+	if cl.pointSymmetric() {
+		render = renderSymmetric
+	}
+	return render(width, height, 1, params, func(z complex128) color.RGBA64 {
+		return cl.julia(z, c)
+	})
+}
+
+// pointSymmetric reports whether cl.julia colors z and -z alike, so that JuliaSingle can use
+// renderSymmetric: the process is z -> z^2 + c, whose iterates from z and -z coincide after one
+// step, started at z itself.  Supersampling, crops and dithering, whose pattern is not symmetric,
+// are left to renderImage.
+func (cl *colorer) pointSymmetric() bool {
+	p := cl.params
+	return cl.step == nil && cl.z0 == 0 && p.AA <= 1 && p.Crop == (PixelRect{}) && p.Dither != DitherOrdered
 }
 
 // watFunc varies c along the real axis, starting at -1.45, increasing to -1.25 (edge of the Mandelbrot set)
@@ -131,75 +306,291 @@ func linFunc(i int, nFrames int) complex128 {
 	return complex(real(center)+alpha, imag(center)+alpha)
 }
 
+// lineFunc returns a parameter function that moves c along the straight line from start to end,
+// reaching end at the last frame.
+func lineFunc(start, end complex128) func(int, int) complex128 {
+	return func(i int, nFrames int) complex128 {
+		if nFrames < 2 {
+			return start
+		}
+		t := float64(i) / float64(nFrames-1)
+		return start + complex(t, 0)*(end-start)
+	}
+}
+
+// powerFunc returns a function that moves the exponent linearly from start, at the first frame,
+// to end, at the last frame.
+func powerFunc(start, end float64) func(int, int) float64 {
+	return func(i int, nFrames int) float64 {
+		if nFrames < 2 {
+			return start
+		}
+		return start + float64(i)/float64(nFrames-1)*(end-start)
+	}
+}
+
+// zoomFunc returns a function that gives the window of each frame of a zoom into the center of
+// view: view itself at the first frame, shrunk about its center by a further factor at each
+// frame after that.
+func zoomFunc(view Viewport, factor float64) func(int, int) Viewport {
+	center := view.Center()
+	cx, cy := real(center), imag(center)
+	return func(i int, nFrames int) Viewport {
+		scale := math.Pow(factor, float64(i))
+		return Viewport{
+			cx - (cx-view.XMin)/scale,
+			cy - (cy-view.YMin)/scale,
+			cx + (view.XMax-cx)/scale,
+			cy + (view.YMax-cy)/scale,
+		}
+	}
+}
+
+// spiralFunc returns a parameter function that moves c outward along the logarithmic spiral
+// c = r0 * e^(k*t) * e^(i*t), with t going from 0 to 2pi*turns over the frames.  The radius grows
+// from 0.3, inside the main cardioid of the Mandelbrot set, to 1, outside it, so c crosses the
+// boundary of the set again and again as it winds around.
+func spiralFunc(turns float64) func(int, int) complex128 {
+	const (
+		r0 = 0.3 // radius at the first frame
+		r1 = 1.0 // radius at the last frame
+	)
+	tMax := 2 * math.Pi * turns
+	k := math.Log(r1/r0) / tMax
+	return func(i int, nFrames int) complex128 {
+		if nFrames < 2 {
+			return r0
+		}
+		t := float64(i) / float64(nFrames-1) * tMax
+		return complex(r0*math.Exp(k*t), 0) * cmplx.Exp(complex(0, t))
+	}
+}
+
 // expFunc moves c around the circle, .7885e^i*alpha where alfpha goes from 0 to 2pi.
 func expFunc(i int, nFrames int) complex128 {
 	return .7885 * cmplx.Exp(complex(0, float64(i)*2*math.Pi/float64(nFrames)))
 }
 
 // frameworker is a worker goroutine to generate a frame.
-// Takes a frame index i from the input jobs channel and creates the image for the ith frame,
-// returning the index and the completed image on the results channel.  The paramFunc parameter
-// is applied to the int from the input channel to get the c value.
-func frameWorker(jobs <-chan *frameParameter, results chan<- *frame) {
-	const (
-		xmin, ymin, xmax, ymax = -2, -2, +2, +2
-		width, height          = 1024, 1024
-		delay                  = 8
-	)
-
+// Takes a frame job from the input jobs channel and creates the image for its frame,
+// returning the index and the completed image on the results channel.
+// The worker returns once ctx is canceled, checking before each frame and each scanline
+// so that a canceled request does not keep the CPU busy finishing a frame nobody will see.
+// If framePalette is not nil, each frame is dithered to the palette it returns for the frame;
+// otherwise frames are delivered in full color.
+func frameWorker(ctx context.Context, jobs <-chan *frameJob, results chan<- *frame, framePalette func(image.Image) color.Palette) {
 	opts := gif.Options{
-		NumColors: 256,
+		NumColors: gifColors,
 		Drawer:    draw.FloydSteinberg,
 	}
-	for fp := range jobs {
-		img := image.NewRGBA64(image.Rect(0, 0, width, height))
-		for py := 0; py < height; py++ {
-			y := float64(py)/height*(ymax-ymin) + ymin
-			for px := 0; px < width; px++ {
-				x := float64(px)/width*(xmax-xmin) + xmin
-				z := complex(x, y)
-				j := juliaIFS(z, fp.c, 400, 10.0)
-				c := color.RGBA64{0, 0, 0, 0}
-				if j > 0 {
-					c = color.RGBA64{0, uint16(2000 * j), 60000 - uint16(2000*j), 60000}
-				}
-				img.Set(px, py, c)
-			}
+	for job := range jobs {
+		img := renderFrame(ctx, job)
+		if img == nil {
+			return
+		}
+
+		out := postProcess(img, job.params)
+		if job.params.Grid {
+			out = drawGrid(out, job.params)
+		}
+		if len(job.params.Marks) > 0 {
+			out = drawMarks(out, job.params)
+		}
+		out = transformImage(out, job.params.Transform)
+		if framePalette == nil {
+			results <- &frame{job.index, out}
+			log.Println("Finished Frame number ", job.index)
+			continue
 		}
 
 		// Convert img to a paletted image
-		b := img.Bounds()
-		pimg := image.NewPaletted(b, palette.Plan9[:opts.NumColors])
-		opts.Drawer.Draw(pimg, b, img, image.ZP)
+		b := out.Bounds()
+		pimg := image.NewPaletted(b, framePalette(out))
+		opts.Drawer.Draw(pimg, b, out, image.ZP)
 		results <- &frame{
-			fp.index,
+			job.index,
 			pimg,
 		}
-		log.Println("Finished Frame number ", fp.index)
+		log.Println("Finished Frame number ", job.index)
 	}
 }
 
-// frameParameter is an indexed c parameter for the process z -> z^2 + c
-type frameParameter struct {
-	index int
-	c     complex128
+// renderFrame renders the frame of job, before post-processing: the Julia set for job.c, or the
+// Mandelbrot set if job.mandelbrot is set, with the settings in job.params.  The interior of the
+// set is transparent.  It returns nil if ctx is canceled before the frame is finished.
+func renderFrame(ctx context.Context, job *frameJob) *image.RGBA64 {
+	params := job.params
+	width, height := params.Size, params.Size
+	view := params.View
+	if ctx.Err() != nil {
+		return nil
+	}
+	cl := newColorer(params, color.RGBA64{0, 0, 0, 0}, params.pixelWidth())
+	colorAt := func(z complex128) color.RGBA64 { return cl.julia(z, job.c) }
+	if job.mandelbrot {
+		cl.paramPlane = true
+		colorAt = cl.mandelbrot
+	}
+	xs, ys := view.xs(width), view.ys(height)
+	img := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for py := 0; py < height; py++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+		for px := 0; px < width; px++ {
+			img.Set(px, py, colorAt(complex(xs[px], ys[py])))
+		}
+	}
+	return img
+}
+
+// frameJob is the work of rendering one frame of an animation: the index of the frame, its c
+// value, and the render parameters resolved for it, whose exponent and window, among others,
+// can vary from frame to frame.
+type frameJob struct {
+	index      int
+	c          complex128
+	mandelbrot bool // whether the frame shows the Mandelbrot set rather than the Julia set for c
+	params     RenderParams
 }
 
+// grays is the palette of monochrome GIF frames, 256 evenly spaced shades of gray.
+var grays = func() color.Palette {
+	p := make(color.Palette, 256)
+	for i := range p {
+		p[i] = color.Gray{uint8(i)}
+	}
+	return p
+}()
+
 // frame is an indexed image
 type frame struct {
 	index int
-	img   *image.Paletted
+	img   image.Image
 }
 
 // juliaIFS iterates the process z -> z^2 + c starting at z until either maxIter iterations have
 // completed or the modulus of an iterate exceeds big.  Returns 0 in the first case (no escape);
-// otherwise the number of iterations required to escape.
+// otherwise the number of iterations required to escape, 1 if the first one takes z past big.
 func juliaIFS(z complex128, c complex128, maxIter int, big float64) int {
-	for i := 0; i < maxIter; i++ {
+	big2 := big * big
+	for i := 1; i <= maxIter; i++ {
 		z = z*z + c
-		if cmplx.Abs(z) > big {
+		if abs2(z) > big2 {
 			return i
 		}
 	}
 	return 0
 }
+
+// juliaIFSSmooth iterates z -> z^2 + c like juliaIFS, but returns the normalized iteration count
+//
+//	nu = n - log(log(|z|))/log(2)
+//
+// when the iterates escape at iteration n, giving a continuous value that removes the banding of
+// the integer count (see smoothCount).  Returns 0 if the iterates do not escape within maxIter
+// iterations.
+func juliaIFSSmooth(z complex128, c complex128, maxIter int, big float64) float64 {
+	big2 := big * big
+	for i := 1; i <= maxIter; i++ {
+		z = z*z + c
+		if abs2(z) > big2 {
+			return smoothCount(i, cmplx.Abs(z), 2)
+		}
+	}
+	return 0
+}
+
+// Classes of orbits told apart by juliaIFSClassify.
+type orbitClass int
+
+const (
+	orbitUnknown  orbitClass = iota // neither escaped nor settled within the iteration cap
+	orbitEscaped                    // passed the escape radius
+	orbitInterior                   // settled on an attracting cycle, so it never escapes
+)
+
+// orbitStats describes an orbit classified by juliaIFSClassify.
+type orbitStats struct {
+	iter       int     // iteration at which the orbit escaped, counted as juliaIFS does, or settled
+	modulus    float64 // modulus of the escaping iterate
+	period     int     // period of the attracting cycle of an interior orbit
+	multiplier float64 // modulus of the multiplier of that cycle, below 1
+}
+
+// escapeValue returns the escape value of an escaped orbit with stats st, as juliaIFS (or, if
+// smooth is set, juliaIFSSmooth) would return it.
+func (st orbitStats) escapeValue(smooth bool) float64 {
+	if smooth {
+		return smoothCount(st.iter, st.modulus, 2)
+	}
+	return float64(st.iter)
+}
+
+// juliaIFSClassify iterates z -> z^2 + c like juliaIFS, but also stops as soon as the orbit has
+// settled on an attracting cycle, which it then never leaves, so that interior points need not
+// run to maxIter.  Cycles are looked for with Brent's algorithm: the orbit is compared with the
+// iterate saved at the last of a series of checkpoints spaced 1, 2, 4, ... iterations apart,
+// and when it comes back within periodTol of it, quadraticCycle checks that it has converged
+// on a cycle and finds the cycle's period and multiplier.  Orbits that have not escaped or
+// settled within maxIter iterations are orbitUnknown, and are as a rule interior points near the
+// boundary, still closing in on their cycle.
+func juliaIFSClassify(z complex128, c complex128, maxIter int, big float64) (orbitClass, orbitStats) {
+	big2 := big * big
+	tol2 := periodTol * periodTol
+	saved, lam, power := z, 0, 1
+	checked := false // whether the cycle has been checked for since the last checkpoint
+	for i := 1; i <= maxIter; i++ {
+		z = z*z + c
+		if abs2(z) > big2 {
+			return orbitEscaped, orbitStats{iter: i, modulus: cmplx.Abs(z)}
+		}
+		lam++
+		if !checked && abs2(z-saved) <= tol2 {
+			checked = true
+			if period, multiplier := quadraticCycle(z, c, lam); period > 0 && multiplier < 1 {
+				return orbitInterior, orbitStats{iter: i, period: period, multiplier: multiplier}
+			}
+		}
+		if lam == power {
+			saved, lam, power, checked = z, 0, 2*power, false
+		}
+	}
+	return orbitUnknown, orbitStats{iter: maxIter}
+}
+
+// quadraticCycle returns the period of the cycle of z -> z^2 + c that z lies on, to within
+// periodTol, and the modulus of its multiplier, the derivative of the n-th iterate over the
+// cycle; or 0 if z is not that close to a cycle of period up to maxPeriod.  The distance from z
+// to the nearest point of an n-cycle is estimated, as by a step of Newton's method, from how
+// far the n-th iterate w lands from z and the derivative d of that iterate as |w - z| / |1 - d|.
+// Unlike the gap |w - z| itself, the estimate stays large for an orbit spiraling slowly into a
+// cycle, which returns close to where it was after a multiple of the period.
+func quadraticCycle(z complex128, c complex128, maxPeriod int) (int, float64) {
+	w, d := z, complex(1, 0)
+	for n := 1; n <= maxPeriod; n++ {
+		d *= 2 * w
+		w = w*w + c
+		if cmplx.Abs(w-z) <= periodTol*cmplx.Abs(1-d) {
+			return n, cmplx.Abs(d)
+		}
+	}
+	return 0, 0
+}
+
+// juliaValue returns the escape value of z under z -> z^2 + c used to color a pixel,
+// either the integer count from juliaIFS or the smooth count from juliaIFSSmooth.  With
+// params.CycleCheck, the orbit is classified by juliaIFSClassify instead, which stops early
+// for interior points.
+func juliaValue(z complex128, c complex128, params RenderParams) float64 {
+	if params.CycleCheck {
+		if class, st := juliaIFSClassify(z, c, params.MaxIter, params.Escape); class == orbitEscaped {
+			return st.escapeValue(params.Smooth)
+		}
+		return 0
+	}
+	if params.Smooth {
+		return juliaIFSSmooth(z, c, params.MaxIter, params.Escape)
+	}
+	return float64(juliaIFS(z, c, params.MaxIter, params.Escape))
+}
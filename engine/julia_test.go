@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"image/gif"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testAnimParams returns the settings of a short animation along the Exp path, small enough for
+// tests.
+func testAnimParams(frames int) AnimParams {
+	return AnimParams{
+		Frames:     frames,
+		Workers:    2,
+		Path:       "Exp",
+		Delay:      DefaultDelay,
+		Format:     AnimGIF,
+		GIFPalette: GIFPlan9,
+	}
+}
+
+// testParams returns the default rendering settings at size x size pixels.
+func testParams(size int) RenderParams {
+	params := DefaultRenderParams()
+	params.Size = size
+	return params
+}
+
+// Julia once referred to a writer it was not given, so the package did not build; it must write
+// the whole animation to the writer it is passed.
+func TestJuliaWritesMultiFrameGIF(t *testing.T) {
+	const frames = 3
+	var buf bytes.Buffer
+	Julia(context.Background(), testAnimParams(frames), testParams(32), &buf)
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("decoding the animation: %v", err)
+	}
+	if len(anim.Image) != frames {
+		t.Fatalf("got %d frames, want %d", len(anim.Image), frames)
+	}
+	for i, frame := range anim.Image {
+		if b := frame.Bounds(); b.Dx() != 32 || b.Dy() != 32 {
+			t.Errorf("frame %d is %v, want 32x32", i, b)
+		}
+	}
+}
+
+// juliaIFS returns the iteration at which the orbit of z leaves the disk of radius big, counting
+// from 1, or 0 if it stays inside for maxIter iterations.
+func TestJuliaIFS(t *testing.T) {
+	tests := []struct {
+		name    string
+		z, c    complex128
+		maxIter int
+		big     float64
+		want    int
+	}{
+		{"fixed point", 0, 0, 100, 2, 0},
+		{"period 2 cycle", 0, -1, 100, 2, 0},
+		{"preperiodic orbit", 0, 1i, 100, 2, 0},
+		{"inside the unit circle", 0.5 + 0.5i, 0, 100, 2, 0},
+		{"escapes after three steps", 0, 1, 100, 2, 3},  // 1, 2, 5
+		{"|z| = big does not escape", 2, -2, 100, 2, 0}, // 2 is a fixed point of z^2 - 2
+		{"escapes in the first step", 3, 0, 100, 2, 1},  // 9
+		{"outside the unit circle", 1.1, 0, 100, 2, 3},  // 1.21, 1.46, 2.14
+		{"larger bailout takes longer", 0, 1, 100, 10, 4},
+		{"slow escape near the cusp", 0, 0.26, 100, 2, 30},
+		{"no iterations", 0, 1, 0, 2, 0},
+		{"maxiter stops short of the escape", 0, 1, 2, 2, 0},
+		{"maxiter just reaches the escape", 0, 1, 3, 2, 3},
+	}
+	for _, tt := range tests {
+		if got := juliaIFS(tt.z, tt.c, tt.maxIter, tt.big); got != tt.want {
+			t.Errorf("%s: juliaIFS(%v, %v, %d, %v) = %d, want %d", tt.name, tt.z, tt.c, tt.maxIter, tt.big, got, tt.want)
+		}
+	}
+}
+
+// The animations along the c paths, which vary c alone, match the frames rendered before frame
+// jobs carried complete render parameters.  The golden GIFs were checked to be identical to the
+// output of that older code.
+func TestJuliaCPathsGolden(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard) // Julia logs every frame
+	for _, path := range []string{"Angor", "Exp", "Wabbit", "Spiral", "Line"} {
+		animParams := testAnimParams(4)
+		animParams.Path = path
+		animParams.CStart, animParams.CEnd, animParams.Turns = -0.8+0.156i, 0.285+0.01i, 1
+		params := testParams(48)
+		params.Escape = 10 // the escape radius of the older code
+		var buf bytes.Buffer
+		Julia(context.Background(), animParams, params, &buf)
+		checkGolden(t, "julia_"+strings.ToLower(path)+".gif", buf.Bytes())
+	}
+
+	// The c of each frame is the point of the path, and nothing else about the frame changes.
+	animParams, params := testAnimParams(6), testParams(48)
+	for _, job := range newFrameJobs(animParams, params) {
+		if want := expFunc(job.index, animParams.Frames); job.c != want {
+			t.Errorf("frame %d: c = %v, want %v", job.index, job.c, want)
+		}
+		if !reflect.DeepEqual(job.params, params) {
+			t.Errorf("frame %d: params %+v, want %+v", job.index, job.params, params)
+		}
+	}
+}
+
+// An orbit that escapes in the first step has a nonzero escape value in every variant of the
+// escape test, however far out it starts, so that it is never taken for one that stays bounded.
+func TestFirstStepEscapeIsNonzero(t *testing.T) {
+	const c = -0.8 + 0.156i
+	for _, z := range []complex128{3, -2 - 2i, 1.5i, 100, 1e10 + 1e10i} {
+		if n := juliaIFS(z, c, 100, 2); n != 1 {
+			t.Errorf("juliaIFS(%v) = %d, want 1", z, n)
+		}
+		if n := escapeIFS(z, c, quadraticStep, 100, 2); n != 1 {
+			t.Errorf("escapeIFS(%v) = %d, want 1", z, n)
+		}
+		if v := juliaIFSSmooth(z, c, 100, 2); v <= 0 {
+			t.Errorf("juliaIFSSmooth(%v) = %v, want > 0", z, v)
+		}
+		if v := escapeIFSSmooth(z, c, quadraticStep, 100, 2, 2); v <= 0 {
+			t.Errorf("escapeIFSSmooth(%v) = %v, want > 0", z, v)
+		}
+		class, st := juliaIFSClassify(z, c, 100, 2)
+		if class != orbitEscaped || st.iter != 1 || st.escapeValue(false) != 1 || st.escapeValue(true) <= 0 {
+			t.Errorf("juliaIFSClassify(%v) = %v, %+v, want escaped at iteration 1", z, class, st)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"image"
+	"io"
+	"math"
+	"math/cmplx"
+)
+
+// Mandelbrot creates an image of the Mandelbrot set, the set of c values for which the process
+// z -> z^2 + c started at z = 0 does not escape, and writes it to w.
+// params supplies the window, iteration cap, escape radius, coloring mode, palette, supersampling factor
+// and output format.  params.Power replaces the exponent 2, giving the Multibrot set for that power.
+// If params.Precision is above 53 and params.Power is 2, the image is rendered with math/big
+// instead (see renderBig), and histogram coloring falls back to escape coloring.
+func Mandelbrot(params RenderParams, w io.Writer) {
+	encodeImage(w, mandelbrotImage(params), params)
+}
+
+// mandelbrotImage renders the image of the Mandelbrot set that Mandelbrot encodes.
+func mandelbrotImage(params RenderParams) image.Image {
+	width, height := params.Size, params.Size
+	cl := newColorer(params, params.interior(), params.pixelWidth())
+	cl.paramPlane = true
+	if params.Precision > 53 && cl.step == nil {
+		return renderBig(width, height, params, cl.mandelbrotBig)
+	}
+	cl.equalize(func(c complex128) float64 { return cl.escapeValue(cl.critical, c) })
+	return renderImage(width, height, 1, params, cl.mandelbrot)
+}
+
+// mandelbrotIFSDistance iterates z -> z^2 + c starting at z = z0, tracking the derivative dz of the
+// iterate with respect to c (dz -> 2*z*dz + 1, starting at 0).  If the iterates escape, it returns
+// the distance estimate |z|*log(|z|)/|dz| of c to the Mandelbrot set and true; otherwise it returns
+// 0 and false.
+func mandelbrotIFSDistance(z0 complex128, c complex128, maxIter int, big float64) (float64, bool) {
+	z, dz := z0, complex128(0)
+	big2 := big * big
+	for i := 0; i < maxIter; i++ {
+		dz = 2*z*dz + 1
+		z = z*z + c
+		if abs2(z) > big2 {
+			modulus := cmplx.Abs(z)
+			return modulus * math.Log(modulus) / cmplx.Abs(dz), true
+		}
+	}
+	return 0, false
+}
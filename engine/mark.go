@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// MaxMarks is the largest number of points marked on an image accepted from a request.
+const MaxMarks = 64
+
+// A Mark is a point of the complex plane marked on an image with a crosshair, selected by
+// RenderParams.Marks.
+type Mark struct {
+	Re float64 `json:"re"`
+	Im float64 `json:"im"`
+}
+
+// drawMarks draws a crosshair at each of params.Marks that falls within params.View over img, an
+// image of params.View (or a crop of one), and returns the result.  img is drawn on directly if
+// it can be.
+func drawMarks(img image.Image, params RenderParams) image.Image {
+	dst := drawable(img)
+	v := params.View
+	for _, m := range params.Marks {
+		if m.Re < v.XMin || m.Re > v.XMax || m.Im < v.YMin || m.Im > v.YMax {
+			continue
+		}
+		drawMarker(dst, complex(m.Re, m.Im), v, params.Size)
+	}
+	return dst
+}
+
+// drawMarker draws a crosshair at z on img, an image of view size pixels square: a ring around
+// z with short arms reaching out from it, in white outlined in black like an orbit (see
+// drawOrbit), so that the point itself stays visible.  The crosshair is clipped to img.
+func drawMarker(img draw.Image, z complex128, view Viewport, size int) {
+	x := (real(z) - view.XMin) / (view.XMax - view.XMin) * float64(size)
+	y := (imag(z) - view.YMin) / (view.YMax - view.YMin) * float64(size)
+	scale := max(1, size/captionPixels)
+	inner, outer := float64(4*scale), float64(12*scale)
+	for _, pass := range []struct {
+		src   image.Image
+		width int
+	}{{image.NewUniform(orbitOutline), scale + 2}, {image.NewUniform(orbitLine), scale}} {
+		for _, d := range [4][2]float64{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			drawLine(img, x+d[0]*inner, y+d[1]*inner, x+d[0]*outer, y+d[1]*outer, pass.width, pass.src)
+		}
+		// The ring, as a polygon fine enough to look round.
+		const sides = 24
+		for k := 0; k < sides; k++ {
+			a0, a1 := 2*math.Pi*float64(k)/sides, 2*math.Pi*float64(k+1)/sides
+			drawLine(img, x+inner*math.Cos(a0), y+inner*math.Sin(a0), x+inner*math.Cos(a1), y+inner*math.Sin(a1), pass.width, pass.src)
+		}
+	}
+}
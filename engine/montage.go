@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"runtime"
+	"sync"
+)
+
+const (
+	DefaultMontageCells = 4   // Default number of rows and columns of a montage
+	MaxMontageCells     = 16  // Largest number of rows or columns of a montage accepted from a request
+	DefaultMontageSize  = 128 // Default width and height of the thumbnails of a montage, in pixels
+	MaxMontageSize      = 512 // Largest thumbnail size of a montage accepted from a request
+	montageGap          = 2   // Width of the dividers between the thumbnails of a montage, in pixels
+)
+
+// CLabel formats c for a label: re+imi, each part with 4 significant digits.
+func CLabel(c complex128) string {
+	return fmt.Sprintf("%.4g%+.4gi", real(c), imag(c))
+}
+
+// MontageC returns the value of c sampled for the thumbnail in row row and column col of a rows x
+// cols montage of the window cView of the c-plane: the center of the cell of that thumbnail
+// when cView is divided into rows x cols cells, with row 0 at cView.YMin.
+func MontageC(cView Viewport, rows, cols, row, col int) complex128 {
+	return cView.Tile(rows, cols, row, col).Center()
+}
+
+// JuliaMontage creates a PNG contact sheet of the Julia sets for a rows x cols grid of c values
+// sampled across the window cView of the c-plane (see MontageC).  Each is rendered as JuliaSingle
+// would render it with params into a params.Size x params.Size thumbnail labeled with its c, with
+// the thumbnails rendered concurrently on all CPUs.  params.Crop, params.Grid and params.Marks
+// are ignored.
+func JuliaMontage(cView Viewport, rows, cols int, params RenderParams, w io.Writer) {
+	params.Crop, params.Grid, params.Marks = PixelRect{}, false, nil
+	size := params.Size
+	bounds := image.Rect(0, 0, cols*size+(cols-1)*montageGap, rows*size+(rows-1)*montageGap)
+	img := image.NewRGBA64(bounds)
+	draw.Draw(img, bounds, image.NewUniform(dividerColor), image.Point{}, draw.Src)
+
+	cells := make(chan image.Point)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for cell := range cells {
+				c := MontageC(cView, rows, cols, cell.Y, cell.X)
+				at := cell.Mul(size + montageGap)
+				thumb := juliaImage(c, params)
+				draw.Draw(img, thumb.Bounds().Add(at), thumb, image.Point{}, draw.Src)
+				// The label is clipped to the thumbnail, whose neighbors other goroutines may be drawing.
+				cellImg := img.SubImage(image.Rectangle{at, at.Add(image.Pt(size, size))}).(draw.Image)
+				label := CLabel(c)
+				drawLabel(cellImg, image.Pt(at.X, at.Y+size-labelSize(label, 1).Y), label, 1)
+			}
+		}()
+	}
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			cells <- image.Pt(col, row)
+		}
+	}
+	close(cells)
+	wg.Wait()
+	encodeImage(w, img, params)
+}
@@ -1,66 +1,296 @@
 package engine
 
 import (
-	"image"
+	"fmt"
 	"image/color"
-	"image/png"
 	"io"
+	"math"
 	"math/cmplx"
+	"strconv"
+	"strings"
 )
 
+const (
+	DefaultDegree   = 4     // Default degree n of the polynomial z^n - 1 used by Newton
+	MaxDegree       = 32    // Largest degree accepted by Newton
+	DefaultTol      = 1e-10 // Default convergence tolerance for Newton
+	DefaultContrast = 2000  // Default Newton contrast, the initial darkening per iteration out of 60000
+	MaxContrast     = 60000 // Largest Newton contrast; larger values would darken a point to black in one iteration
+)
+
+// Coloring modes for the points whose Newton iterates do not converge, selected by RenderParams.NonConv.
+const (
+	NonConvBlack = "black" // Color non-converging points black
+	NonConvGray  = "gray"  // Shade non-converging points in gray by the modulus of their last iterate
+	NonConvRamp  = "ramp"  // Color non-converging points from params.Palette by the modulus of their last iterate
+)
+
+// ValidNonConv reports whether mode names a coloring mode for non-converging Newton points.
+func ValidNonConv(mode string) bool {
+	return mode == NonConvBlack || mode == NonConvGray || mode == NonConvRamp
+}
+
+// newtonResult is the eventual behavior of Newton's iterates from one initial guess.
+type newtonResult struct {
+	root int        // Index of the root the iterates converged to, or -1 if they did not converge
+	iter int        // Iteration at which the iterates converged
+	z    complex128 // Last iterate
+}
+
 // Creates a PNG image showing eventual behavior of Newton's method IFS
-// seeking 4th roots of unity.  Points in the complex plane are colored according
+// seeking roots of z^n - 1, where n = params.Degree, or of the polynomial with coefficients params.Coeffs
+// if it is not empty.  Points in the complex plane are colored according
 // to eventual behavior when they are taken as initial guesses.
-func Newton(w io.Writer) {
-	const (
-		xmin, ymin, xmax, ymax = -2, -2, +2, +2
-		width, height          = 1024, 1024
-	)
-
-	img := image.NewRGBA64(image.Rect(0, 0, width, height))
-	for py := 0; py < height; py++ {
-		y := float64(py)/height*(ymax-ymin) + ymin
-		for px := 0; px < width; px++ {
-			x := float64(px)/width*(xmax-xmin) + xmin
-			z := complex(x, y)
-			img.Set(px, py, newtonIFS(z, 2000))
+// The basins are colored with params.Colors if it is not empty (see basinColors).
+// Each pixel is supersampled on a params.AA x params.AA grid, and params.Contrast sets how
+// quickly the basin colors darken as convergence slows (see convergenceLevel).
+// The image is split into horizontal bands rendered concurrently by nWorkers goroutines.
+func Newton(nWorkers int, params RenderParams, w io.Writer) {
+	width, height := params.Size, params.Size
+	roots, colors := NewtonRoots(params)
+	var colorAt func(z complex128) color.RGBA64
+	if len(params.Coeffs) > 0 {
+		coeffs := complexCoeffs(params.Coeffs)
+		colorAt = func(z complex128) color.RGBA64 {
+			return newtonColor(newtonPolyIFS(z, coeffs, params.Relax, roots, params.MaxIter, params.Tol), colors, params)
+		}
+	} else {
+		colorAt = func(z complex128) color.RGBA64 {
+			return newtonColor(newtonIFS(z, params.Relax, roots, params.MaxIter, params.Tol), colors, params)
+		}
+	}
+	encodeImage(w, renderImage(width, height, nWorkers, params, colorAt), params)
+}
+
+// NewtonRoots returns the roots whose basins Newton colors for params, and the color of the
+// basin of each: the roots of the polynomial with coefficients params.Coeffs, found by
+// polyRoots, if it is not empty, and otherwise the params.Degree-th roots of unity.
+func NewtonRoots(params RenderParams) (roots []complex128, colors []color.RGBA64) {
+	if len(params.Coeffs) > 0 {
+		roots = polyRoots(complexCoeffs(params.Coeffs))
+	} else {
+		roots = unityRoots(params.Degree)
+	}
+	return roots, basinColors(params.Colors, len(roots))
+}
+
+// complexCoeffs returns the real coefficients coeffs as complex numbers.
+func complexCoeffs(coeffs []float64) []complex128 {
+	cs := make([]complex128, len(coeffs))
+	for k, a := range coeffs {
+		cs[k] = complex(a, 0)
+	}
+	return cs
+}
+
+// newtonIFS iterates Newton's method to find a root of p(z) = z^n - 1 starting with initial guess = z,
+// where n = len(roots) and roots are the n-th roots of unity.  Each Newton correction is multiplied
+// by the relaxation factor a; a = 1 is the plain method, while other values give relaxed Newton,
+// z -> z - a*p(z)/p'(z), which converges more slowly and can break the basins into filaments.
+// The iterates converge to roots[k] once they come within tol of it, and the result records k
+// and the iteration; if they have not converged after maxIter iterations, its root is -1.
+func newtonIFS(z complex128, a float64, roots []complex128, maxIter int, tol float64) newtonResult {
+	n := len(roots)
+	for i := 0; i < maxIter; i++ {
+		// z - (z^n - 1)/(n*z^(n-1)) = z - (z - 1/z^(n-1))/n
+		zn1 := complex(1, 0)
+		for k := 1; k < n; k++ {
+			zn1 *= z
+		}
+		z -= complex(a, 0) * (z - 1/zn1) / complex(float64(n), 0)
+		for k, root := range roots {
+			if cmplx.Abs(z-root) < tol {
+				return newtonResult{k, i, z}
+			}
 		}
 	}
-	png.Encode(w, img)
-}
-
-// mewtomIFS iterates Newton's method to find a root of p(x) = x^4 - 1 starting with initial guess = z.
-// Returns a color coded as follows:
-//   if the iterates do not converge (max iterations and not close to any root), black
-//   if the iterates converge, then
-//      1 <-> red
-//     -1 <-> blue
-//      i <-> green
-//     -i <-> purple
-//     with saturation dampened by the number of iterations required for the iterations to converge.
-func newtonIFS(z complex128, contrast int) color.RGBA64 {
-	const (
-		iterations = 400
-		one        = complex(1, 0)
-		minusOne   = complex(-1, 0)
-		posI       = complex(0, 1)
-		negI       = complex(0, -1)
-		tol        = 1e-16
-	)
-	for i := 0; i < iterations; i++ {
-		z -= (z - 1/(z*z*z)) / 4
-		if cmplx.Abs(z-one) < tol {
-			return color.RGBA64{60000 - uint16(contrast*i), 0, 0, 60000}
+	return newtonResult{-1, maxIter, z}
+}
+
+// newtonPolyIFS is the counterpart of newtonIFS for an arbitrary polynomial, given by its coefficients,
+// highest degree first, with relaxation factor a.  p(z) and p'(z) are evaluated with Horner's method.  The iterates are taken
+// to have converged once a Newton step moves them less than tol, and the result then records the
+// root nearest the last iterate, so basins of multiple roots (where Newton's method converges
+// only linearly) are still colored.  Iterates that hit a critical point of p do not converge.
+func newtonPolyIFS(z complex128, coeffs []complex128, a float64, roots []complex128, maxIter int, tol float64) newtonResult {
+	for i := 0; i < maxIter; i++ {
+		p, dp := horner(coeffs, z)
+		if dp == 0 {
+			return newtonResult{-1, i, z}
 		}
-		if cmplx.Abs(z-minusOne) < tol {
-			return color.RGBA64{0, 60000 - uint16(contrast*i), 0, 60000}
+		step := complex(a, 0) * p / dp
+		z -= step
+		if cmplx.Abs(step) < tol {
+			nearest := 0
+			for k, root := range roots {
+				if cmplx.Abs(z-root) < cmplx.Abs(z-roots[nearest]) {
+					nearest = k
+				}
+			}
+			return newtonResult{nearest, i, z}
 		}
-		if cmplx.Abs(z-posI) < tol {
-			return color.RGBA64{0, 0, 60000 - uint16(contrast*i), 60000}
+	}
+	return newtonResult{-1, maxIter, z}
+}
+
+// newtonColor returns the color of a point whose Newton iterates behaved as res.  Points that
+// converge to roots[k] are colored colors[k], with saturation dampened by the number of iterations
+// required for the iterates to converge (see convergenceLevel).  For n = 4 the default colors are
+//
+//	 1 <-> red
+//	-1 <-> green
+//	 i <-> blue
+//	-i <-> purple
+//
+// Points that do not converge are colored as params.NonConv selects: black, or by the modulus of
+// their last iterate, mapped to [0, 1) with 2/pi*atan(|z|), in gray or from params.Palette.
+// Iterates that blew up count as infinitely far out.
+func newtonColor(res newtonResult, colors []color.RGBA64, params RenderParams) color.RGBA64 {
+	if res.root >= 0 {
+		return shade(colors[res.root], convergenceLevel(res.iter, params.Contrast))
+	}
+	if params.NonConv != NonConvGray && params.NonConv != NonConvRamp {
+		return color.RGBA64{0, 0, 0, 0}
+	}
+	t := 1.0
+	if !cmplx.IsNaN(res.z) {
+		t = 2 / math.Pi * math.Atan(cmplx.Abs(res.z))
+	}
+	if params.NonConv == NonConvRamp {
+		return params.palette()(t)
+	}
+	level := uint16(60000 * t)
+	return color.RGBA64{level, level, level, 60000}
+}
+
+// convergenceLevel returns the brightness, out of 60000, of a point whose Newton iterates converged
+// after i iterations.  The brightness falls off exponentially, 60000*exp(-contrast*i/60000), which
+// starts out close to the straight line 60000 - contrast*i but keeps decreasing long after that
+// line reaches 0, so that slowly converging points are still told apart (at the default contrast,
+// for about 300 iterations).
+func convergenceLevel(i int, contrast int) uint16 {
+	return uint16(60000 * math.Exp(-float64(contrast)*float64(i)/60000))
+}
+
+// unityRoots returns the n-th roots of unity, starting at 1 and proceeding counterclockwise.
+// Components within rounding error of 0 are set to exactly 0, so that roots on the axes
+// (e.g. -1 and i) are exact and the convergence test in newtonIFS can reach them.
+func unityRoots(n int) []complex128 {
+	const eps = 1e-15
+	roots := make([]complex128, n)
+	for k := range roots {
+		s, c := math.Sincos(2 * math.Pi * float64(k) / float64(n))
+		if math.Abs(s) < eps {
+			s = 0
 		}
-		if cmplx.Abs(z-negI) < tol {
-			return color.RGBA64{60000 - uint16(contrast*i), 0, 60000 - uint16(contrast*i), 60000}
+		if math.Abs(c) < eps {
+			c = 0
 		}
+		roots[k] = complex(c, s)
+	}
+	return roots
+}
+
+// basinColors returns the colors of the basins of n roots: the hex colors custom (see
+// ParseHexColor), repeated as often as needed, or rootColors(n) if custom is empty.
+func basinColors(custom []string, n int) []color.RGBA64 {
+	if len(custom) == 0 {
+		return rootColors(n)
+	}
+	colors := make([]color.RGBA64, n)
+	for k := range colors {
+		colors[k], _ = ParseHexColor(custom[k%len(custom)])
+	}
+	return colors
+}
+
+// ParseHexColor parses an opaque color given as six hex digits rrggbb, optionally preceded by
+// "#".  Like the built-in colors, the channels are scaled so that ff becomes 60000.
+func ParseHexColor(s string) (color.RGBA64, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return color.RGBA64{}, fmt.Errorf("color %q is not of the form rrggbb", s)
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA64{}, fmt.Errorf("color %q is not of the form rrggbb", s)
+	}
+	channel := func(shift uint) uint16 {
+		return uint16((rgb >> shift & 0xff) * 60000 / 0xff)
+	}
+	return color.RGBA64{channel(16), channel(8), channel(0), 60000}, nil
+}
+
+// HexColor formats the opaque color c as six hex digits rrggbb, the inverse of ParseHexColor:
+// 60000 becomes ff.
+func HexColor(c color.RGBA64) string {
+	channel := func(v uint16) int {
+		return int(math.Round(float64(v) * 0xff / 60000))
+	}
+	return fmt.Sprintf("%02x%02x%02x", channel(c.R), channel(c.G), channel(c.B))
+}
+
+// rootColors returns the basin colors for the n-th roots of unity, in the order returned by unityRoots.
+func rootColors(n int) []color.RGBA64 {
+	colors := make([]color.RGBA64, n)
+	for k := range colors {
+		colors[k] = rootColor(k, n)
+	}
+	return colors
+}
+
+// rootColor returns the basin color of root k of n.  The four roots of z^4 - 1 keep their
+// original red, blue, green and purple; for other degrees the roots get evenly spaced hues,
+// starting with red for the root 1.
+func rootColor(k, n int) color.RGBA64 {
+	if n == 4 {
+		return [...]color.RGBA64{
+			{60000, 0, 0, 60000},     // 1
+			{0, 0, 60000, 60000},     // i
+			{0, 60000, 0, 60000},     // -1
+			{60000, 0, 60000, 60000}, // -i
+		}[k]
+	}
+	return hueColor(float64(k) / float64(n))
+}
+
+// hueColor returns the fully saturated color with hue h, measured in turns (so h in [0, 1)).
+func hueColor(h float64) color.RGBA64 {
+	return hsvToRGBA64(h, 1, 1)
+}
+
+// hsvToRGBA64 converts the color with hue h, measured in turns, saturation s and value v, both
+// in [0, 1], to an opaque RGBA64 color, with channels scaled so that full intensity is 60000
+// like the other colors of the package.
+func hsvToRGBA64(h, s, v float64) color.RGBA64 {
+	h = 6 * (h - math.Floor(h))
+	chroma := v * s
+	m := v - chroma
+	channel := func(f float64) uint16 {
+		return uint16(60000 * (f + m))
+	}
+	c, x := channel(chroma), channel(chroma*(1-math.Abs(math.Mod(h, 2)-1)))
+	zero := channel(0)
+	switch int(h) {
+	case 0:
+		return color.RGBA64{c, x, zero, 60000}
+	case 1:
+		return color.RGBA64{x, c, zero, 60000}
+	case 2:
+		return color.RGBA64{zero, c, x, 60000}
+	case 3:
+		return color.RGBA64{zero, x, c, 60000}
+	case 4:
+		return color.RGBA64{x, zero, c, 60000}
+	default:
+		return color.RGBA64{c, zero, x, 60000}
+	}
+}
+
+// shade scales the color channels of c by level / 60000, leaving alpha unchanged.
+func shade(c color.RGBA64, level uint16) color.RGBA64 {
+	scale := func(v uint16) uint16 {
+		return uint16(uint32(v) * uint32(level) / 60000)
 	}
-	return color.RGBA64{0, 0, 0, 0}
+	return color.RGBA64{scale(c.R), scale(c.G), scale(c.B), c.A}
 }
@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+// The tolerance and iteration cap of newtonIFS decide when iterates count as converged.
+func TestNewtonIFSTolAndMaxIter(t *testing.T) {
+	roots := unityRoots(4)
+	tests := []struct {
+		name     string
+		z        complex128
+		maxIter  int
+		tol      float64
+		wantRoot int
+		wantIter int
+	}{
+		{"no iterations", 1.1, 0, DefaultTol, -1, 0},
+		{"too few iterations", 3, 2, DefaultTol, -1, 2},
+		{"enough iterations", 3, 100, DefaultTol, 0, 7},
+		{"loose tolerance converges at once", 1.01, 100, 0.1, 0, 0},
+		{"tight tolerance needs more steps", 1.01, 100, 1e-12, 0, 2},
+	}
+	for _, tt := range tests {
+		res := newtonIFS(tt.z, 1, roots, tt.maxIter, tt.tol)
+		if res.root != tt.wantRoot {
+			t.Errorf("%s: root %d, want %d", tt.name, res.root, tt.wantRoot)
+		}
+		if res.iter != tt.wantIter {
+			t.Errorf("%s: converged at iteration %d, want %d", tt.name, res.iter, tt.wantIter)
+		}
+	}
+	// A looser tolerance never takes more iterations than a tighter one.
+	for _, z := range []complex128{2, -0.5 + 2i, 0.3 - 0.9i} {
+		loose, tight := newtonIFS(z, 1, roots, 400, 1e-3), newtonIFS(z, 1, roots, 400, 1e-12)
+		if loose.root != tight.root || loose.iter > tight.iter {
+			t.Errorf("%v: tol 1e-3 gives root %d at %d, tol 1e-12 root %d at %d",
+				z, loose.root, loose.iter, tight.root, tight.iter)
+		}
+	}
+}
+
+// convergenceLevel starts out close to the old linear falloff, 60000 - contrast*i, but keeps
+// decreasing long after the linear falloff has reached black.
+func TestConvergenceLevel(t *testing.T) {
+	tests := []struct {
+		i, contrast int
+		lo, hi      uint16
+	}{
+		{0, DefaultContrast, 60000, 60000},
+		{1, DefaultContrast, 60000 - DefaultContrast, 60000 - DefaultContrast + 100},
+		{5, DefaultContrast, 60000 - 5*DefaultContrast, 60000 - 5*DefaultContrast + 1000},
+		{30, DefaultContrast, 20000, 25000}, // 60000 - 30*contrast is already 0
+		{300, DefaultContrast, 1, 10},
+		{400, DefaultContrast, 0, 1},
+		{100, 0, 60000, 60000},
+		{1, MaxContrast, 22000, 22100}, // 60000/e, not black in one iteration
+	}
+	for _, tt := range tests {
+		if got := convergenceLevel(tt.i, tt.contrast); got < tt.lo || got > tt.hi {
+			t.Errorf("convergenceLevel(%d, %d) = %d, want %d-%d", tt.i, tt.contrast, got, tt.lo, tt.hi)
+		}
+	}
+	for i := 1; i < 60; i++ {
+		if prev, level := convergenceLevel(i-1, DefaultContrast), convergenceLevel(i, DefaultContrast); level >= prev || level == 0 {
+			t.Errorf("level %d after %d iterations, %d after %d", level, i, prev, i-1)
+		}
+	}
+}
+
+// Starting next to a root of z^n - 1, newtonIFS converges to that root, to within tol, for every
+// root of every degree.
+func TestNewtonIFSConvergesToEachRoot(t *testing.T) {
+	for _, n := range []int{2, 3, 4, 5, 6} {
+		roots := unityRoots(n)
+		for k, root := range roots {
+			for _, z := range []complex128{1.2 * root, root * complex(1, 0.1), root * complex(0.8, -0.05)} {
+				res := newtonIFS(z, 1, roots, DefaultMaxIter, DefaultTol)
+				if res.root != k {
+					t.Errorf("degree %d: from %v, converged to root %d, want %d", n, z, res.root, k)
+					continue
+				}
+				if d := cmplx.Abs(res.z - root); d >= DefaultTol {
+					t.Errorf("degree %d: from %v, ended %v away from root %d", n, z, d, k)
+				}
+			}
+		}
+	}
+	// Relaxed (a = 0.5) iteration converges to the same roots, linearly, so more slowly.
+	roots := unityRoots(3)
+	for k, root := range roots {
+		full, relaxed := newtonIFS(1.2*root, 1, roots, DefaultMaxIter, DefaultTol), newtonIFS(1.2*root, 0.5, roots, DefaultMaxIter, DefaultTol)
+		if relaxed.root != k || relaxed.iter <= full.iter {
+			t.Errorf("root %d: relaxed iteration reached root %d after %d steps, full %d after %d", k, relaxed.root, relaxed.iter, full.root, full.iter)
+		}
+	}
+}
+
+// Iterates that never come near a root, or not within maxIter iterations, report root -1 after
+// maxIter iterations: the origin is a critical point of z^n - 1, and the diagonal, where the
+// basins of 1 and i meet, maps to itself.
+func TestNewtonIFSMaxIterEdges(t *testing.T) {
+	roots := unityRoots(4)
+	tests := []struct {
+		name    string
+		z       complex128
+		maxIter int
+	}{
+		{"origin", 0, DefaultMaxIter},
+		{"diagonal, between basins", 0.5 + 0.5i, DefaultMaxIter},
+		{"one iteration", 5 + 5i, 1},
+	}
+	for _, tt := range tests {
+		res := newtonIFS(tt.z, 1, roots, tt.maxIter, DefaultTol)
+		if res.root != -1 || res.iter != tt.maxIter {
+			t.Errorf("%s: root %d at iteration %d, want no root after %d", tt.name, res.root, res.iter, tt.maxIter)
+		}
+	}
+}
+
+// The four roots of z^4 - 1 keep the colors they had before other degrees were supported.
+func TestRootColorsDegree4(t *testing.T) {
+	legacy := []color.RGBA64{
+		{60000, 0, 0, 60000},     // 1: red
+		{0, 0, 60000, 60000},     // i: blue
+		{0, 60000, 0, 60000},     // -1: green
+		{60000, 0, 60000, 60000}, // -i: purple
+	}
+	_, colors := NewtonRoots(DefaultRenderParams())
+	if len(colors) != len(legacy) {
+		t.Fatalf("%d basin colors, want %d", len(colors), len(legacy))
+	}
+	for k, c := range colors {
+		if c != legacy[k] {
+			t.Errorf("root %d colored %v, want %v", k, c, legacy[k])
+		}
+	}
+}
+
+// At degree 6 every basin of a rendered image has a color of its own, the color of its root.
+func TestNewtonDegree6Basins(t *testing.T) {
+	params := testParams(64)
+	params.Degree = 6
+	roots, colors := NewtonRoots(params)
+	for j := range colors {
+		for k := j + 1; k < len(colors); k++ {
+			if similarity(colors[j], colors[k]) > 0.9 {
+				t.Errorf("roots %d and %d have similar colors %v and %v", j, k, colors[j], colors[k])
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	Newton(2, params, &buf)
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decoding the image: %v", err)
+	}
+	v := params.View
+	seen := map[color.RGBA64]bool{}
+	for k, root := range roots {
+		// The pixel of the root itself converges at once, in the full color of its basin.
+		px := int(math.Round((real(root) - v.XMin) / (v.XMax - v.XMin) * float64(params.Size)))
+		py := int(math.Round((imag(root) - v.YMin) / (v.YMax - v.YMin) * float64(params.Size)))
+		got := color.RGBA64Model.Convert(img.At(px, py)).(color.RGBA64)
+		nearest := 0
+		for j, c := range colors {
+			if similarity(got, c) > similarity(got, colors[nearest]) {
+				nearest = j
+			}
+		}
+		if nearest != k {
+			t.Errorf("root %d: pixel (%d, %d) is %v, closest to the color of root %d", k, px, py, got, nearest)
+		}
+		seen[got] = true
+	}
+	if len(seen) != len(roots) {
+		t.Errorf("%d distinct basin colors at the roots, want %d", len(seen), len(roots))
+	}
+}
+
+// similarity returns the cosine of the angle between the RGB channels of a and b, 1 for colors
+// that differ only in brightness.
+func similarity(a, b color.RGBA64) float64 {
+	ar, ag, ab := float64(a.R), float64(a.G), float64(a.B)
+	br, bg, bb := float64(b.R), float64(b.G), float64(b.B)
+	return (ar*br + ag*bg + ab*bb) / math.Sqrt((ar*ar+ag*ag+ab*ab)*(br*br+bg*bg+bb*bb))
+}
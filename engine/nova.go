@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"image/color"
+	"io"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	DefaultNovaDegree = 3 // Default degree n of the polynomial z^n - 1 of the Nova process
+	// DefaultNovaContrast is the default contrast of Nova images.  The Nova iterates settle
+	// linearly rather than quadratically like Newton's, so they need a gentler falloff.
+	DefaultNovaContrast = 300
+)
+
+// NovaView is the default window for the Nova renderer.
+var NovaView = Viewport{-1.5, -1.25, +1, +1.25}
+
+// Nova creates an image of the Nova fractal and writes it to w.  The Nova process adds the
+// pixel c to each relaxed Newton step for the roots of z^n - 1,
+//
+//	z -> z - a*(z^n - 1)/(n*z^(n-1)) + c
+//
+// so that, as with Mandelbrot, every pixel is a different process, started at the critical point
+// z = 1 (offset by params.Z0Re + params.Z0Im i).  n is params.Degree and a is params.Relax.  As with Newton,
+// pixels whose iterates settle are colored by the root of unity nearest to where they settle,
+// shaded by how long that took, and the others are black.  The image is split into horizontal
+// bands rendered concurrently by nWorkers goroutines.
+func Nova(nWorkers int, params RenderParams, w io.Writer) {
+	width, height := params.Size, params.Size
+	roots := unityRoots(params.Degree)
+	colors := basinColors(params.Colors, params.Degree)
+	z0 := 1 + params.z0()
+	img := renderImage(width, height, nWorkers, params, func(c complex128) color.RGBA64 {
+		return novaIFS(z0, c, params.Relax, roots, colors, params.Contrast, params.MaxIter, params.Tol)
+	})
+	encodeImage(w, img, params)
+}
+
+// novaIFS iterates the Nova process z -> z - a*(z^n - 1)/(n*z^(n-1)) + c starting at z, where
+// n = len(roots) and roots are the n-th roots of unity.  Unlike Newton's iterates, which settle
+// on a root, the iterates settle on a fixed point that depends on c, so they are taken to have
+// converged once a step moves them less than tol, and are then colored colors[k] for the root
+// roots[k] nearest to them, shaded as in newtonColor.  Iterates that have not converged after
+// maxIter iterations, or that blow up, are black.
+func novaIFS(z complex128, c complex128, a float64, roots []complex128, colors []color.RGBA64, contrast int, maxIter int, tol float64) color.RGBA64 {
+	n := len(roots)
+	for i := 0; i < maxIter; i++ {
+		zn1 := complex(1, 0)
+		for k := 1; k < n; k++ {
+			zn1 *= z
+		}
+		step := complex(a, 0)*(z-1/zn1)/complex(float64(n), 0) - c
+		z -= step
+		if cmplx.IsNaN(z) || cmplx.IsInf(z) {
+			break
+		}
+		if cmplx.Abs(step) < tol {
+			nearest, best := 0, math.Inf(1)
+			for k, root := range roots {
+				if d := cmplx.Abs(z - root); d < best {
+					nearest, best = k, d
+				}
+			}
+			return shade(colors[nearest], convergenceLevel(i, contrast))
+		}
+	}
+	return color.RGBA64{0, 0, 0, 60000}
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// MaxOrbitSteps is the largest number of steps of an orbit drawn over a Julia set accepted from
+// a request.
+const MaxOrbitSteps = 10000
+
+var (
+	orbitLine    = color.RGBA64{0xffff, 0xffff, 0xffff, 0xffff}
+	orbitOutline = color.RGBA64{0, 0, 0, 0xc000} // translucent black, premultiplied
+)
+
+// orbitPoints returns the orbit of params.OrbitRe + params.OrbitIm i under the process of params
+// for c: the starting point and up to params.OrbitSteps iterates after it.  The orbit stops at the
+// first iterate past the escape radius, which is far outside the set.  It returns nil if
+// params.OrbitSteps is 0.
+func orbitPoints(c complex128, f iteration, params RenderParams) []complex128 {
+	if params.OrbitSteps <= 0 {
+		return nil
+	}
+	z := complex(params.OrbitRe, params.OrbitIm)
+	points := []complex128{z}
+	big2 := params.Escape * params.Escape
+	for i := 0; i < params.OrbitSteps && abs2(z) <= big2; i++ {
+		z = f(z, c)
+		points = append(points, z)
+	}
+	return points
+}
+
+// juliaStep returns the iteration of the Julia sets of params: z -> z^2 + c, or the map or power
+// params names.
+func juliaStep(params RenderParams) iteration {
+	if step := newColorer(params, color.RGBA64{}, 0).step; step != nil {
+		return step
+	}
+	return quadraticStep
+}
+
+// drawOrbit draws params.orbit over img, an image of params.View (or a crop of one), and returns
+// the result: the iterates joined in order by white lines, each marked with a dot and the
+// starting point with a larger one, all outlined in black so that they show up on any
+// background.  Lines and dots are thicker on large images, as captions are.  img is drawn on
+// directly if it can be.
+func drawOrbit(img image.Image, params RenderParams) image.Image {
+	dst := drawable(img)
+	v, size := params.View, float64(params.Size)
+	scale := max(1, params.Size/captionPixels)
+	pixel := func(z complex128) (float64, float64) {
+		return (real(z) - v.XMin) / (v.XMax - v.XMin) * size, (imag(z) - v.YMin) / (v.YMax - v.YMin) * size
+	}
+	// The outlines go underneath everything, so that they do not cut across the lines.
+	for _, pass := range []struct {
+		c     color.RGBA64
+		width int
+	}{{orbitOutline, scale + 2}, {orbitLine, scale}} {
+		src := image.NewUniform(pass.c)
+		for k, z := range params.orbit {
+			x, y := pixel(z)
+			if k > 0 {
+				x0, y0 := pixel(params.orbit[k-1])
+				drawLine(dst, x0, y0, x, y, pass.width, src)
+			}
+			radius := pass.width
+			if k == 0 {
+				radius = 2 * pass.width
+			}
+			if math.Abs(x) < size*2 && math.Abs(y) < size*2 {
+				px, py := int(math.Floor(x)), int(math.Floor(y))
+				draw.Draw(dst, image.Rect(px-radius, py-radius, px+radius+1, py+radius+1), src, image.Point{}, draw.Over)
+			}
+		}
+	}
+	return dst
+}
+
+// drawLine draws the line from (x0, y0) to (x1, y1) onto img with src, width pixels thick,
+// clipped to the bounds of img.  Each pixel is drawn once, so translucent colors stay even.
+func drawLine(img draw.Image, x0, y0, x1, y1 float64, width int, src image.Image) {
+	b := img.Bounds()
+	// Clip the line to the bounds, widened by the width of the line (Liang-Barsky).
+	w := float64(width)
+	lo, hi := 0.0, 1.0
+	dx, dy := x1-x0, y1-y0
+	for _, edge := range [4][2]float64{
+		{-dx, x0 - (float64(b.Min.X) - w)}, {dx, (float64(b.Max.X) + w) - x0},
+		{-dy, y0 - (float64(b.Min.Y) - w)}, {dy, (float64(b.Max.Y) + w) - y0},
+	} {
+		p, q := edge[0], edge[1]
+		if p == 0 {
+			if q < 0 {
+				return
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 {
+			lo = math.Max(lo, t)
+		} else {
+			hi = math.Min(hi, t)
+		}
+	}
+	if lo > hi {
+		return
+	}
+	x0, y0, x1, y1 = x0+lo*dx, y0+lo*dy, x0+hi*dx, y0+hi*dy
+
+	n := int(math.Ceil(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))))
+	mask := image.NewAlpha(b)
+	half := width / 2
+	for i := 0; i <= n; i++ {
+		t := 0.0
+		if n > 0 {
+			t = float64(i) / float64(n)
+		}
+		px, py := int(math.Floor(x0+t*(x1-x0))), int(math.Floor(y0+t*(y1-y0)))
+		draw.Draw(mask, image.Rect(px-half, py-half, px-half+width, py-half+width), image.Opaque, image.Point{}, draw.Src)
+	}
+	draw.DrawMask(img, b, src, image.Point{}, mask, b.Min, draw.Over)
+}
@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// DefaultPalette is the name of the palette used when none (or an unknown one) is requested.
+const DefaultPalette = "default"
+
+// paletteSpan is the number of escape iterations spanned by a palette.
+// An escape value v is mapped to the palette argument v / paletteSpan.
+const paletteSpan = 30
+
+// A Palette maps a value t in [0, 1] to a color.  Escape-time renderers use a palette to color
+// points that escape, with t increasing with the number of iterations required to escape.
+type Palette func(t float64) color.RGBA64
+
+// palettes is the registry of available palettes, keyed by name.
+var palettes = map[string]Palette{
+	DefaultPalette: defaultPalette,
+	"fire":         firePalette,
+	"ice":          icePalette,
+	"grayscale":    grayscalePalette,
+}
+
+// LookupPalette returns the palette with the given name and true, or the default palette and
+// false if there is no palette with that name.
+func LookupPalette(name string) (Palette, bool) {
+	p, ok := palettes[name]
+	if !ok {
+		return palettes[DefaultPalette], false
+	}
+	return p, true
+}
+
+// PaletteNames returns the names of the registered palettes in sorted order.
+func PaletteNames() []string {
+	names := make([]string, 0, len(palettes))
+	for name := range palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// seededPalette returns p varied by seed, for generative art: its hues rotated by a random
+// angle, and its ramp shifted by a random offset, reflected at the ends so that it does not jump
+// from one end to the other; offsets past 1 run it backward.  The same seed always gives the same
+// palette, and gray stays gray.  The hues are rotated with the matrix of the CSS hue-rotate filter,
+// which keeps the luminance of each color roughly as it was.
+func seededPalette(p Palette, seed int) Palette {
+	r := rand.New(rand.NewSource(int64(seed)))
+	sin, cos := math.Sincos(2 * math.Pi * r.Float64())
+	offset := 2 * r.Float64()
+	m := [3][3]float64{
+		{0.213 + 0.787*cos - 0.213*sin, 0.715 - 0.715*cos - 0.715*sin, 0.072 - 0.072*cos + 0.928*sin},
+		{0.213 - 0.213*cos + 0.143*sin, 0.715 + 0.285*cos + 0.140*sin, 0.072 - 0.072*cos - 0.283*sin},
+		{0.213 - 0.213*cos - 0.787*sin, 0.715 - 0.715*cos + 0.715*sin, 0.072 + 0.928*cos + 0.072*sin},
+	}
+	return func(t float64) color.RGBA64 {
+		s := math.Mod(t+offset, 2)
+		c := p(1 - math.Abs(1-s))
+		in := [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+		var out [3]uint16
+		for i, row := range m {
+			v := row[0]*in[0] + row[1]*in[1] + row[2]*in[2]
+			out[i] = uint16(math.Min(math.Max(v, 0), float64(c.A)))
+		}
+		return color.RGBA64{out[0], out[1], out[2], c.A}
+	}
+}
+
+// PaletteStrip writes a width x height image of the palette of params to w, as a horizontal
+// gradient across [0, 1] from t = 0 at the left edge to t = 1 at the right.  It is encoded in
+// params.Format.
+func PaletteStrip(width, height int, params RenderParams, w io.Writer) {
+	p := params.palette()
+	img := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for px := 0; px < width; px++ {
+		t := 0.0
+		if width > 1 {
+			t = float64(px) / float64(width-1)
+		}
+		c := p(t)
+		for py := 0; py < height; py++ {
+			img.SetRGBA64(px, py, c)
+		}
+	}
+	encodeImage(w, img, params)
+}
+
+// escapeColor returns the color that palette p assigns to the escape value v.
+// Values beyond paletteSpan saturate at the end of the palette rather than wrapping.
+func escapeColor(p Palette, v float64) color.RGBA64 {
+	return p(math.Min(math.Max(v/paletteSpan, 0), 1))
+}
+
+// defaultPalette is the original green/blue ramp, going from blue to green as t increases.
+func defaultPalette(t float64) color.RGBA64 {
+	v := ramp(t)
+	return color.RGBA64{0, v, 60000 - v, 60000}
+}
+
+// firePalette goes from black through red and yellow to white.
+func firePalette(t float64) color.RGBA64 {
+	return color.RGBA64{ramp(3 * t), ramp(3*t - 1), ramp(3*t - 2), 60000}
+}
+
+// icePalette goes from black through blue and cyan to white.
+func icePalette(t float64) color.RGBA64 {
+	return color.RGBA64{ramp(3*t - 2), ramp(3*t - 1), ramp(3 * t), 60000}
+}
+
+// grayscalePalette goes from black to white.
+func grayscalePalette(t float64) color.RGBA64 {
+	v := ramp(t)
+	return color.RGBA64{v, v, v, 60000}
+}
+
+// ramp clamps s to [0, 1] and scales it to a channel value in [0, 60000].
+func ramp(s float64) uint16 {
+	if s <= 0 {
+		return 0
+	}
+	if s >= 1 {
+		return 60000
+	}
+	return uint16(60000 * s)
+}
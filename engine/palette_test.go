@@ -0,0 +1,33 @@
+package engine
+
+import (
+	"image/color"
+	"testing"
+)
+
+// Across escape values from 0 to the iteration limit, every channel of every palette moves
+// in one direction only and stays within [0, 60000]: high escape counts saturate at the end of
+// the palette instead of wrapping around.
+func TestEscapeColorRamp(t *testing.T) {
+	channels := func(c color.RGBA64) [4]int { return [4]int{int(c.R), int(c.G), int(c.B), int(c.A)} }
+	for _, name := range PaletteNames() {
+		p, _ := LookupPalette(name)
+		first, last := channels(escapeColor(p, 0)), channels(escapeColor(p, MaxIterLimit))
+		prev := first
+		for v := 0.0; v <= MaxIterLimit; v += 0.25 {
+			cur := channels(escapeColor(p, v))
+			for i, c := range cur {
+				if c < 0 || c > 60000 {
+					t.Fatalf("%s: channel %d of escape value %v is %d, outside [0, 60000]", name, i, v, c)
+				}
+				if rising := last[i] >= first[i]; rising && c < prev[i] || !rising && c > prev[i] {
+					t.Fatalf("%s: channel %d turns back at escape value %v: %d after %d", name, i, v, c, prev[i])
+				}
+			}
+			prev = cur
+		}
+		if first == last {
+			t.Errorf("%s: escape values from 0 to %d all have the color %v", name, MaxIterLimit, first)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Query reads typed request parameters from a URL query.  Missing parameters take their defaults,
+// malformed ones are logged and replaced by their defaults, and values outside the accepted range
+// are logged and clamped to it.  Problems that make a request unusable are recorded with Fail and
+// reported together by Err, so that a handler can reject the request with a single response that
+// lists all of them.
+//
+// A query with strict=true is in strict mode: malformed and out-of-range values are recorded as
+// problems instead, naming the parameter, so that mistakes are reported rather than hidden.
+// Missing parameters still take their defaults.
+type Query struct {
+	values   url.Values
+	strict   bool
+	problems []ParamError
+}
+
+// A ParamError describes a problem with a request, and the parameter it concerns, if any.
+type ParamError struct {
+	Param   string `json:"param,omitempty"`
+	Message string `json:"error"`
+}
+
+// NewQuery returns a Query reading values.
+func NewQuery(values url.Values) *Query {
+	return &Query{values: values, strict: values.Get("strict") == "true"}
+}
+
+// Strict reports whether q is in strict mode.
+func (q *Query) Strict() bool {
+	return q.strict
+}
+
+// Has reports whether the parameter called name is present.
+func (q *Query) Has(name string) bool {
+	return q.values.Has(name)
+}
+
+// Get returns the value of the parameter called name, or "" if it is missing.
+func (q *Query) Get(name string) string {
+	return q.values.Get(name)
+}
+
+// Int returns the parameter called name as an int, clamped to [lo, hi], or def if it is
+// missing or malformed.
+func (q *Query) Int(name string, def, lo, hi int) int {
+	if !q.Has(name) {
+		return def
+	}
+	v, err := strconv.Atoi(q.Get(name))
+	if err != nil {
+		q.Invalid(name, "%s must be an integer", name)
+		return def
+	}
+	return clampParam(q, name, v, lo, hi)
+}
+
+// Float returns the parameter called name as a float64, clamped to [lo, hi], or def if it is
+// missing or malformed.  Infinities and NaN count as malformed.
+func (q *Query) Float(name string, def, lo, hi float64) float64 {
+	if !q.Has(name) {
+		return def
+	}
+	v, err := strconv.ParseFloat(q.Get(name), 64)
+	if err != nil || !finite(v) {
+		q.Invalid(name, "%s must be a finite number", name)
+		return def
+	}
+	return clampParam(q, name, v, lo, hi)
+}
+
+// Bool reports whether the parameter called name is "true".  In strict mode, values other than
+// "true" and "false" are problems.
+func (q *Query) Bool(name string) bool {
+	v := q.Get(name)
+	if q.strict && q.Has(name) && v != "true" && v != "false" {
+		q.Invalid(name, "%s must be true or false", name)
+	}
+	return v == "true"
+}
+
+// String returns the parameter called name if valid accepts it, and def otherwise.
+func (q *Query) String(name string, def string, valid func(string) bool) string {
+	if !q.Has(name) {
+		return def
+	}
+	v := q.Get(name)
+	if valid(v) {
+		return v
+	}
+	q.Invalid(name, "%s %q is not supported", name, v)
+	return def
+}
+
+// Complex returns the parameter called name, written "re,im", as a complex128, or def if it is
+// missing or malformed.  Infinities and NaN count as malformed.
+func (q *Query) Complex(name string, def complex128) complex128 {
+	if !q.Has(name) {
+		return def
+	}
+	if z, ok := parseComplex(q.Get(name)); ok {
+		return z
+	}
+	q.Invalid(name, "%s must have the form re,im, with finite re and im", name)
+	return def
+}
+
+// Complexes returns every value of the parameter called name, which may be repeated, written
+// "re,im" as for Complex.  Malformed values are left out.
+func (q *Query) Complexes(name string) []complex128 {
+	var zs []complex128
+	for _, v := range q.values[name] {
+		if z, ok := parseComplex(v); ok {
+			zs = append(zs, z)
+		} else {
+			q.Invalid(name, "%s %q must have the form re,im, with finite re and im", name, v)
+		}
+	}
+	return zs
+}
+
+// parseComplex parses s, written "re,im", as a complex128.  As for Float, infinite and NaN parts
+// count as malformed.
+func parseComplex(s string) (complex128, bool) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	re, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	im, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err1 != nil || err2 != nil || !finite(re) || !finite(im) {
+		return 0, false
+	}
+	return complex(re, im), true
+}
+
+// Fail records a problem that makes the request unusable.
+func (q *Query) Fail(format string, args ...any) {
+	q.FailParam("", format, args...)
+}
+
+// FailParam records a problem with the parameter called name that makes the request unusable.
+func (q *Query) FailParam(name string, format string, args ...any) {
+	q.problems = append(q.problems, ParamError{Param: name, Message: fmt.Sprintf(format, args...)})
+}
+
+// Invalid handles an explicit value of the parameter called name that cannot be used, described
+// by format and args, which the caller replaces by its default.  In strict mode it is a problem;
+// otherwise it is only logged.
+func (q *Query) Invalid(name string, format string, args ...any) {
+	if q.strict {
+		q.FailParam(name, format, args...)
+		return
+	}
+	log.Println(fmt.Sprintf(format, args...), "- settting to default")
+}
+
+// Err returns an error listing the problems recorded by Fail, one per line, or nil if there are none.
+func (q *Query) Err() error {
+	if len(q.problems) == 0 {
+		return nil
+	}
+	messages := make([]string, len(q.problems))
+	for i, p := range q.problems {
+		messages[i] = p.Message
+	}
+	return errors.New(strings.Join(messages, "\n"))
+}
+
+// Problems returns the problems recorded by Fail, FailParam and, in strict mode, Invalid.
+func (q *Query) Problems() []ParamError {
+	return q.problems
+}
+
+// clampParam clamps the value v of the parameter called name to [lo, hi], logging any change.
+// In strict mode a value outside the range is a problem with q instead.
+func clampParam[T int | float64](q *Query, name string, v, lo, hi T) T {
+	if v >= lo && v <= hi {
+		return v
+	}
+	if q.strict {
+		switch {
+		case float64(lo) == math.SmallestNonzeroFloat64 && float64(hi) == math.MaxFloat64:
+			q.FailParam(name, "%s must be greater than 0", name)
+		case float64(hi) == math.MaxFloat64 || int64(hi) == math.MaxInt:
+			q.FailParam(name, "%s must be at least %v", name, lo)
+		case float64(lo) == -math.MaxFloat64:
+			q.FailParam(name, "%s must be at most %v", name, hi)
+		default:
+			q.FailParam(name, "%s must be between %v and %v", name, lo, hi)
+		}
+	} else if v < lo {
+		log.Println(name, "too small - clamping to", lo)
+	} else {
+		log.Println(name, "too large - clamping to", hi)
+	}
+	return min(max(v, lo), hi)
+}
+
+// finite reports whether v is neither infinite nor NaN.
+func finite(v float64) bool {
+	return !math.IsInf(v, 0) && !math.IsNaN(v)
+}
@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"net/url"
+	"testing"
+)
+
+// Complex, like Float, rejects infinite and NaN parts.
+func TestQueryComplex(t *testing.T) {
+	tests := []struct {
+		value string
+		want  complex128
+		ok    bool
+	}{
+		{"-0.8,0.156", -0.8 + 0.156i, true},
+		{" 1 , -2 ", 1 - 2i, true},
+		{"1", 0, false},
+		{"1,2,3", 0, false},
+		{"NaN,0", 0, false},
+		{"0,Inf", 0, false},
+		{"-inf,1", 0, false},
+	}
+	for _, tt := range tests {
+		q := NewQuery(url.Values{"c": {tt.value}, "strict": {"true"}})
+		got := q.Complex("c", 0)
+		if ok := q.Err() == nil; ok != tt.ok || got != tt.want {
+			t.Errorf("Complex(%q) = %v with error %v, want %v, ok %v", tt.value, got, q.Err(), tt.want, tt.ok)
+		}
+	}
+}
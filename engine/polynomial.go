@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+// horner evaluates the polynomial with the given coefficients, highest degree first, and its
+// derivative at z.
+func horner(coeffs []complex128, z complex128) (p, dp complex128) {
+	for _, a := range coeffs {
+		dp = dp*z + p
+		p = p*z + a
+	}
+	return p, dp
+}
+
+// polyRoots finds the roots of the polynomial with the given coefficients, highest degree first,
+// using the Durand-Kerner method.  The leading coefficient must be nonzero.  The roots are
+// returned counterclockwise from the positive real axis (argument in [0, 2pi), then modulus), so
+// that the colors assigned to them do not depend on the order in which the method happens to find
+// them; for z^n - 1 this is the order of unityRoots.  Imaginary parts within rounding error of 0
+// are set to exactly 0, so that real roots sort as real.
+func polyRoots(coeffs []complex128) []complex128 {
+	const (
+		iterations = 500
+		tol        = 1e-14
+	)
+	n := len(coeffs) - 1
+	monic := make([]complex128, len(coeffs))
+	for k, a := range coeffs {
+		monic[k] = a / coeffs[0]
+	}
+
+	// The usual starting values: powers of a number that is neither real nor a root of unity
+	roots := make([]complex128, n)
+	seed := complex(0.4, 0.9)
+	for k, r := 0, complex(1, 0); k < n; k++ {
+		roots[k] = r
+		r *= seed
+	}
+	for i := 0; i < iterations; i++ {
+		change := 0.0
+		for k, root := range roots {
+			p, _ := horner(monic, root)
+			q := complex(1, 0)
+			for j, other := range roots {
+				if j != k {
+					q *= root - other
+				}
+			}
+			if q == 0 {
+				continue
+			}
+			roots[k] = root - p/q
+			change = max(change, cmplx.Abs(p/q))
+		}
+		if change < tol {
+			break
+		}
+	}
+	for k, root := range roots {
+		if math.Abs(imag(root)) < 1e-12*cmplx.Abs(root) {
+			roots[k] = complex(real(root), 0)
+		}
+	}
+	arg := func(z complex128) float64 {
+		a := cmplx.Phase(z)
+		if a < 0 {
+			a += 2 * math.Pi
+		}
+		return a
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		ai, aj := arg(roots[i]), arg(roots[j])
+		if ai != aj {
+			return ai < aj
+		}
+		return cmplx.Abs(roots[i]) < cmplx.Abs(roots[j])
+	})
+	return roots
+}
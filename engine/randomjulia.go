@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"image/color"
+	"math"
+	"math/cmplx"
+	"math/rand"
+)
+
+const (
+	randomJuliaTries = 1000 // Number of c values RandomJuliaC tries before settling for the best
+	randomJuliaProbe = 32   // Width and height of the grid of pixels probed for each c value
+	// A Julia set is interesting if the fraction of probed pixels that are slow to escape, or
+	// never do, is between randomJuliaMinSlow and randomJuliaMaxSlow: below that the set is
+	// all but empty, and above it the image is mostly filled-in interior.
+	randomJuliaMinSlow = 0.03
+	randomJuliaMaxSlow = 0.5
+	// randomJuliaNear is how close a c value for which the critical orbit does not escape
+	// must be to one for which it does, for c to count as near the boundary.
+	randomJuliaNear = 0.02
+)
+
+// RandomJuliaC returns a c value, chosen pseudo-randomly but deterministically by seed, whose
+// Julia set for the process of params is interesting to look at.  Candidates are drawn near the
+// boundary of the Mandelbrot set (or Multibrot set, for other powers), where the Julia sets are
+// the most intricate, and each is probed with a coarse render of params.View: it is rejected if
+// almost every pixel escapes quickly or if most of them never escape (see randomJuliaMinSlow).
+// If no candidate passes within randomJuliaTries tries, the one that came closest is returned.
+func RandomJuliaC(seed int64, params RenderParams) complex128 {
+	rng := rand.New(rand.NewSource(seed))
+	cl := newColorer(params, color.RGBA64{}, params.pixelWidth())
+	slowIter := math.Max(10, float64(params.MaxIter)/20) // escape values this high count as slow
+	target := (randomJuliaMinSlow + randomJuliaMaxSlow) / 2
+
+	best, bestMiss := complex(0, 0), math.Inf(1)
+	for i := 0; i < randomJuliaTries; i++ {
+		c := complex(-2.2+2.8*rng.Float64(), -1.5+3*rng.Float64())
+		if !nearBoundary(cl, c, slowIter) {
+			continue
+		}
+		slow := juliaSlowFraction(cl, c, params.View, slowIter)
+		if slow >= randomJuliaMinSlow && slow <= randomJuliaMaxSlow {
+			return c
+		}
+		if miss := math.Abs(slow - target); miss < bestMiss {
+			best, bestMiss = c, miss
+		}
+	}
+	return best
+}
+
+// nearBoundary reports whether c is near the boundary of the Mandelbrot set for the process of
+// cl: either the critical orbit escapes, but only after slowIter or more iterations, or it does
+// not escape but does for some point within randomJuliaNear of c.
+func nearBoundary(cl *colorer, c complex128, slowIter float64) bool {
+	if v := cl.escapeValue(cl.critical, c); v != 0 {
+		return v >= slowIter
+	}
+	for k := 0; k < 8; k++ {
+		if cl.escapeValue(cl.critical, c+cmplx.Rect(randomJuliaNear, float64(k)*math.Pi/4)) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// juliaSlowFraction returns the fraction of the pixels of a randomJuliaProbe x randomJuliaProbe
+// image of the Julia set for c in view whose points escape only after slowIter or more
+// iterations, or not at all.
+func juliaSlowFraction(cl *colorer, c complex128, view Viewport, slowIter float64) float64 {
+	n := randomJuliaProbe
+	slow := 0
+	for py := 0; py < n; py++ {
+		y := view.y(py, n)
+		for px := 0; px < n; px++ {
+			if v := cl.escapeValue(complex(view.x(px, n), y), c); v == 0 || v >= slowIter {
+				slow++
+			}
+		}
+	}
+	return float64(slow) / float64(n*n)
+}
@@ -0,0 +1,380 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"runtime"
+	"sync"
+)
+
+const (
+	MaxAA       = 4    // Largest supported supersampling factor
+	DefaultSize = 1024 // Default width and height of rendered images, in pixels
+	MaxSize     = 4096 // Largest width and height accepted from a request
+)
+
+// MaxWorkers is the largest number of goroutines rendering an image or animation accepted from
+// a request.  More than there are CPUs gain nothing.
+var MaxWorkers = 2 * runtime.NumCPU()
+
+// Viewport is a rectangular window in the complex plane.
+type Viewport struct {
+	XMin float64 `json:"xmin"`
+	YMin float64 `json:"ymin"`
+	XMax float64 `json:"xmax"`
+	YMax float64 `json:"ymax"`
+}
+
+var (
+	DefaultView    = Viewport{-2, -2, +2, +2}     // Default window for the Julia and Newton renderers
+	MandelbrotView = Viewport{-2.5, -2, +1.5, +2} // Default window for the Mandelbrot renderer
+)
+
+// x returns the real part of the points in pixel column px of an image width pixels wide.
+func (v Viewport) x(px int, width int) float64 {
+	return float64(px)/float64(width)*(v.XMax-v.XMin) + v.XMin
+}
+
+// y returns the imaginary part of the points in pixel row py of an image height pixels high.
+func (v Viewport) y(py int, height int) float64 {
+	return float64(py)/float64(height)*(v.YMax-v.YMin) + v.YMin
+}
+
+// xs returns the real parts of the points in the pixel columns of an image width pixels wide, as
+// computed by x, so that render loops can look them up instead of dividing for every pixel.
+func (v Viewport) xs(width int) []float64 {
+	xs := make([]float64, width)
+	for px := range xs {
+		xs[px] = v.x(px, width)
+	}
+	return xs
+}
+
+// ys returns the imaginary parts of the points in the pixel rows of an image height pixels high,
+// as computed by y.
+func (v Viewport) ys(height int) []float64 {
+	ys := make([]float64, height)
+	for py := range ys {
+		ys[py] = v.y(py, height)
+	}
+	return ys
+}
+
+// Tile returns the part of v covered by the tile in row row and column col of a grid of rows x cols
+// equal tiles, with row 0 at YMin and column 0 at XMin.  The edges are computed with x and y, so
+// tiles rendered at the same size line up exactly with the corresponding pixels of one image of v
+// that is cols times as wide and rows times as high.
+func (v Viewport) Tile(rows, cols, row, col int) Viewport {
+	return Viewport{
+		XMin: v.x(col, cols),
+		YMin: v.y(row, rows),
+		XMax: v.x(col+1, cols),
+		YMax: v.y(row+1, rows),
+	}
+}
+
+// Center returns the point at the center of v.
+func (v Viewport) Center() complex128 {
+	return complex((v.XMin+v.XMax)/2, (v.YMin+v.YMax)/2)
+}
+
+// Span returns the length of the shorter side of v.
+func (v Viewport) Span() float64 {
+	return math.Min(v.XMax-v.XMin, v.YMax-v.YMin)
+}
+
+// Zoom returns the magnification of v relative to def: how many times longer the shorter side
+// of def is than that of v.  CenterView(v.Center(), v.Zoom(def), def.Span(), ...) gives back
+// v, for a window with the shape of the image.
+func (v Viewport) Zoom(def Viewport) float64 {
+	return def.Span() / v.Span()
+}
+
+// Quadrants returns the centers of the four quarters of v, in the order their pixels appear
+// in an image: the two quarters at YMin, XMin first, then the two at YMax.
+func (v Viewport) Quadrants() [4]complex128 {
+	dx, dy := (v.XMax-v.XMin)/4, (v.YMax-v.YMin)/4
+	return [4]complex128{
+		complex(v.XMin+dx, v.YMin+dy),
+		complex(v.XMax-dx, v.YMin+dy),
+		complex(v.XMin+dx, v.YMax-dy),
+		complex(v.XMax-dx, v.YMax-dy),
+	}
+}
+
+// CenterView returns the window of a width x height pixel image centered on center, with its
+// shorter side spanning span/zoom.  The longer side spans proportionally more, so that pixels
+// cover squares of the complex plane and the image is not stretched whatever its shape.
+func CenterView(center complex128, zoom, span float64, width, height int) Viewport {
+	short := span / zoom
+	dx, dy := short, short
+	if width > height {
+		dx = short * float64(width) / float64(height)
+	} else {
+		dy = short * float64(height) / float64(width)
+	}
+	x, y := real(center), imag(center)
+	return Viewport{x - dx/2, y - dy/2, x + dx/2, y + dy/2}
+}
+
+// PixelRect is the rectangle of pixels X0 <= x < X1, Y0 <= y < Y1 of an image.  The zero
+// PixelRect is empty.
+type PixelRect struct {
+	X0 int `json:"px0"`
+	Y0 int `json:"py0"`
+	X1 int `json:"px1"`
+	Y1 int `json:"py1"`
+}
+
+// RenderParams holds the request-level settings shared by the escape-time renderers.
+// The JSON field names are those of the corresponding request parameters.
+type RenderParams struct {
+	MaxIter  int       `json:"maxiter"`  // Maximum number of iterations per pixel
+	Escape   float64   `json:"escape"`   // Modulus beyond which an iterate is considered to have escaped
+	Smooth   bool      `json:"smooth"`   // Use continuous (normalized iteration count) coloring instead of integer bands
+	AA       int       `json:"aa"`       // Supersampling factor; each pixel averages an AA x AA grid of samples
+	Palette  string    `json:"palette"`  // Name of the palette used to color escaping points
+	Mono     bool      `json:"mono"`     // Convert the image to grayscale (luminance) before encoding it
+	Invert   bool      `json:"invert"`   // Invert the colors of the image before encoding it
+	Degree   int       `json:"degree"`   // Degree n of the polynomial z^n - 1 whose roots Newton seeks
+	Tol      float64   `json:"tol"`      // Distance at which Newton's iterates are taken to have converged
+	Size     int       `json:"size"`     // Width and height of the image, in pixels
+	Relax    float64   `json:"a"`        // Relaxation factor a of the Newton step z -> z - a*p(z)/p'(z)
+	Coeffs   []float64 `json:"coeffs"`   // Coefficients of the polynomial Newton uses instead of z^n - 1, highest degree first
+	Contrast int       `json:"contrast"` // How quickly Newton's shading darkens with the number of iterations
+	Colors   []string  `json:"colors"`   // Hex colors (rrggbb) of Newton's basins, used in turn for the roots
+	NonConv  string    `json:"nonconv"`  // How Newton colors points that do not converge, e.g. NonConvBlack or NonConvGray
+	Format   string    `json:"format"`   // Output format for still images, "png" or "jpeg"
+	Quality  int       `json:"quality"`  // JPEG quality, 1-100
+	Color    string    `json:"color"`    // Coloring mode for escape-time renders, e.g. ColorEscape or ColorTrap
+	Trap     string    `json:"trap"`     // Orbit trap shape used by ColorTrap, TrapPoint or TrapCross
+	Power    float64   `json:"power"`    // Exponent of z in the process z -> z^power + c
+	Map      string    `json:"map"`      // Iteration map, MapSquare (z -> z^power + c) or a transcendental map such as MapSin
+	Z0Re     float64   `json:"z0re"`     // Real part of the offset z0 of the starting point of escape-time orbits
+	Z0Im     float64   `json:"z0im"`     // Imaginary part of z0
+	View     Viewport  `json:"view"`
+	Crop     PixelRect `json:"crop"`   // Pixels of the Size x Size image to render, if not all of them
+	Dither   string    `json:"dither"` // Dithering of escape values, DitherNone or DitherOrdered
+	// Label is whether a caption describing the image is drawn in the corner named by LabelPos,
+	// e.g. LabelBottomLeft (see drawCaption).
+	Label    bool   `json:"label"`
+	LabelPos string `json:"labelpos"`
+	// Grid is whether gridlines, the axes and tick labels are drawn over the image (see drawGrid).
+	Grid bool `json:"grid"`
+	// Thumb, if not 0, is the size of the longer side of the image served: the image is
+	// rendered at Size and shrunk to it by area averaging (see downscale), if it is larger.
+	Thumb int `json:"thumb"`
+	// Transform is the rotation or reflection applied to the finished image, e.g. TransformRot90
+	// (see transformImage).
+	Transform string `json:"transform"`
+	// Transparent is whether the points of escape-time still images that do not escape are
+	// transparent instead of black, as they are in animation frames.
+	Transparent bool `json:"transparent"`
+	// ColorSeed, if not 0, varies the palette reproducibly: the same seed always rotates its hues
+	// and shifts its ramp by the same amounts (see seededPalette).
+	ColorSeed int `json:"colorseed"`
+	// CycleCheck is whether z -> z^2 + c orbits stop iterating once they settle on an attracting
+	// cycle (see juliaIFSClassify).  Period coloring always checks.
+	CycleCheck bool `json:"cyclecheck"`
+	// OrbitSteps, if not 0, is the number of steps of the orbit of OrbitRe + OrbitIm i drawn
+	// over a Julia set (see drawOrbit).  The default start 0 draws the critical orbit.
+	OrbitRe    float64 `json:"orbitre"`
+	OrbitIm    float64 `json:"orbitim"`
+	OrbitSteps int     `json:"orbitsteps"`
+	// orbit is the orbit encodeImage draws, set by the renderers that draw one from OrbitSteps.
+	orbit []complex128
+	// DownFilter is the filter that collapses the samples of each pixel when AA > 1: DownFilterBox
+	// averages them, and DownFilterBilinear and DownFilterLanczos weigh in those of the neighboring
+	// pixels (see renderFiltered).
+	DownFilter string `json:"downfilter"`
+	// Marks are the points marked with crosshairs over the image, if within the window (see
+	// drawMarks).
+	Marks []Mark `json:"marks"`
+	// PNGCompress is the PNG compression level, e.g. PNGDefault or PNGBestSpeed.
+	PNGCompress string `json:"pngcompress"`
+	// Precision is the number of mantissa bits used for the pixel coordinates and iteration.
+	// Values above 53 (float64) select the much slower math/big code path for deep zooms.
+	Precision uint `json:"precision"`
+	// BigView, if its edges are set, is View to more bits than float64 holds, for the math/big
+	// code path; View is then its float64 approximation.
+	BigView BigViewport `json:"-"`
+}
+
+// DefaultRenderParams returns the settings used when a request does not override them.
+func DefaultRenderParams() RenderParams {
+	return RenderParams{
+		MaxIter:  DefaultMaxIter,
+		Escape:   DefaultEscape,
+		AA:       1,
+		Palette:  DefaultPalette,
+		Degree:   DefaultDegree,
+		Format:   DefaultFormat,
+		Quality:  jpeg.DefaultQuality,
+		Color:    ColorEscape,
+		Trap:     TrapPoint,
+		Power:    2,
+		Relax:    1,
+		Size:     DefaultSize,
+		Tol:      DefaultTol,
+		Contrast: DefaultContrast,
+		NonConv:  NonConvBlack,
+		View:     DefaultView,
+
+		Map:         MapSquare,
+		Dither:      DitherNone,
+		DownFilter:  DownFilterBox,
+		LabelPos:    LabelBottomLeft,
+		Transform:   TransformNone,
+		PNGCompress: PNGDefault,
+		Precision:   53,
+	}
+}
+
+// z0 returns the offset of the starting point of escape-time orbits, Z0Re + Z0Im i.
+func (params RenderParams) z0() complex128 {
+	return complex(params.Z0Re, params.Z0Im)
+}
+
+// interior returns the color of the points of escape-time still images that do not escape:
+// black, or transparent if params.Transparent is set.
+func (params RenderParams) interior() color.RGBA64 {
+	if params.Transparent {
+		return color.RGBA64{}
+	}
+	return color.RGBA64{0, 0, 0, 60000}
+}
+
+// palette returns the Palette named by params.Palette, falling back to the default palette, and
+// varied by params.ColorSeed if it is set.
+func (params RenderParams) palette() Palette {
+	p, _ := LookupPalette(params.Palette)
+	if params.ColorSeed != 0 {
+		p = seededPalette(p, params.ColorSeed)
+	}
+	return p
+}
+
+// Bounds returns the pixels of the params.Size x params.Size image of params.View that are
+// rendered: those in params.Crop, or all of them if params.Crop is empty.
+func (params RenderParams) Bounds() image.Rectangle {
+	full := image.Rect(0, 0, params.Size, params.Size)
+	c := params.Crop
+	if crop := image.Rect(c.X0, c.Y0, c.X1, c.Y1).Intersect(full); !crop.Empty() {
+		return crop
+	}
+	return full
+}
+
+// pixelWidth returns the width in the complex plane of one pixel of the rendered image.
+func (params RenderParams) pixelWidth() float64 {
+	return (params.View.XMax - params.View.XMin) / float64(params.Size)
+}
+
+// supersample returns the color of the pixel whose top-left corner is at (x, y) in the complex plane
+// and whose width and height in the plane are dx and dy.  The pixel is sampled on an aa x aa grid
+// and the sampled colors are averaged channel by channel.  With aa <= 1 the single sample at (x, y)
+// is returned unchanged.
+func supersample(x, y, dx, dy float64, aa int, colorAt func(complex128) color.RGBA64) color.RGBA64 {
+	if aa <= 1 {
+		return colorAt(complex(x, y))
+	}
+	var r, g, b, a uint64
+	for i := 0; i < aa; i++ {
+		for j := 0; j < aa; j++ {
+			c := colorAt(complex(x+float64(j)/float64(aa)*dx, y+float64(i)/float64(aa)*dy))
+			r += uint64(c.R)
+			g += uint64(c.G)
+			b += uint64(c.B)
+			a += uint64(c.A)
+		}
+	}
+	n := uint64(aa * aa)
+	return color.RGBA64{clamp16(r / n), clamp16(g / n), clamp16(b / n), clamp16(a / n)}
+}
+
+// renderImage renders a width x height image of params.View, coloring each pixel with colorAt
+// supersampled on a params.AA x params.AA grid.  The rows are rendered concurrently in nWorkers bands.
+// If params.Crop is not empty, only the pixels in it are rendered, and the image has its bounds.
+// The samples are averaged unless params.DownFilter selects another filter (see renderFiltered).
+func renderImage(width, height, nWorkers int, params RenderParams, colorAt func(complex128) color.RGBA64) *image.RGBA64 {
+	if kernel, _ := downKernel(params.DownFilter); kernel != nil && params.AA > 1 {
+		return renderFiltered(width, height, nWorkers, params, colorAt)
+	}
+	view := params.View
+	dx, dy := (view.XMax-view.XMin)/float64(width), (view.YMax-view.YMin)/float64(height)
+	xs, ys := view.xs(width), view.ys(height)
+	b := params.Bounds()
+	img := image.NewRGBA64(b)
+	renderBands(b.Dy(), nWorkers, func(row int) {
+		py := b.Min.Y + row
+		y := ys[py]
+		for px := b.Min.X; px < b.Max.X; px++ {
+			img.Set(px, py, supersample(xs[px], y, dx, dy, params.AA, colorAt))
+		}
+	})
+	return img
+}
+
+// renderSymmetric renders the same image as renderImage for a colorAt with colorAt(-z) ==
+// colorAt(z), as for Julia sets of z^2 + c, and params with AA <= 1 and no Crop, but computes
+// only about half of the pixels when view is centered on the origin.  The point of pixel
+// (width-px, height-py) is then the negative of that of (px, py), so once the top half of the
+// image is rendered, the pixels of the bottom half are copied from it.  A pixel is only copied
+// if the coordinates of the two points are exact negatives of each other, so the image matches
+// a full render pixel for pixel whatever the window; for an asymmetric window nothing is copied.
+func renderSymmetric(width, height, nWorkers int, params RenderParams, colorAt func(complex128) color.RGBA64) *image.RGBA64 {
+	view := params.View
+	xs, ys := view.xs(width), view.ys(height)
+	img := image.NewRGBA64(image.Rect(0, 0, width, height))
+	renderRow := func(py int) {
+		y := ys[py]
+		my := height - py // the row of the points -z, in the top half for rows in the bottom half
+		mirrored := py > height/2 && ys[my] == -y
+		for px := 0; px < width; px++ {
+			x := xs[px]
+			if mx := width - px; mirrored && px > 0 && xs[mx] == -x {
+				img.SetRGBA64(px, py, img.RGBA64At(mx, my))
+				continue
+			}
+			img.SetRGBA64(px, py, colorAt(complex(x, y)))
+		}
+	}
+	top := height/2 + 1
+	renderBands(top, nWorkers, renderRow)
+	renderBands(height-top, nWorkers, func(row int) { renderRow(top + row) })
+	return img
+}
+
+// renderBands calls renderRow for every row 0 <= py < height.  The rows are split into nWorkers
+// contiguous horizontal bands that are rendered concurrently, one goroutine per band.
+// renderRow must only write pixels in its own row, so no locking is needed.
+func renderBands(height int, nWorkers int, renderRow func(py int)) {
+	if nWorkers < 1 {
+		nWorkers = 1
+	}
+	if nWorkers > height {
+		nWorkers = height
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < nWorkers; i++ {
+		start, end := i*height/nWorkers, (i+1)*height/nWorkers
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for py := start; py < end; py++ {
+				renderRow(py)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// clamp16 converts v to a uint16, saturating at the maximum channel value.
+func clamp16(v uint64) uint16 {
+	if v > 0xffff {
+		return 0xffff
+	}
+	return uint16(v)
+}
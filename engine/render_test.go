@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"sync/atomic"
+	"testing"
+)
+
+// renderSymmetric renders exactly the image renderImage does, copying pixels only where the
+// window makes them exact mirror images, and computes about half of them for a window centered
+// on the origin.
+func TestRenderSymmetricMatchesRenderImage(t *testing.T) {
+	const c = -0.8 + 0.156i
+	tests := []struct {
+		name   string
+		view   Viewport
+		size   int
+		halved bool // whether about half of the pixels must be copied
+	}{
+		{"default window", DefaultView, 32, true},
+		{"odd height", DefaultView, 33, false}, // rounding spoils many mirror images,
+		{"wide window", Viewport{-3, -1.5, 3, 1.5}, 24, true},
+		{"symmetric only to within float error", Viewport{-0.3, -(0.1 + 0.2), 0.3, 0.3}, 33, false},
+		{"nearly symmetric", Viewport{-2, -2, 2, 2 + 1e-15}, 32, false},
+		{"off center", Viewport{-1.9, -2, 2.1, 2}, 32, false},
+	}
+	for _, tt := range tests {
+		params := testParams(tt.size)
+		params.View = tt.view
+		cl := newColorer(params, params.interior(), params.pixelWidth())
+		var calls atomic.Int64
+		colorAt := func(z complex128) color.RGBA64 {
+			calls.Add(1)
+			return cl.julia(z, c)
+		}
+		want := renderImage(tt.size, tt.size, 2, params, colorAt)
+		calls.Store(0)
+		got := renderSymmetric(tt.size, tt.size, 2, params, colorAt)
+		if !imagesEqual(got, want) {
+			t.Errorf("%s: renderSymmetric differs from renderImage", tt.name)
+		}
+		pixels := int64(tt.size * tt.size)
+		if n := calls.Load(); tt.halved && n > pixels*6/10 {
+			t.Errorf("%s: computed %d of %d pixels", tt.name, n, pixels)
+		}
+	}
+}
+
+// imagesEqual reports whether a and b have the same bounds and pixels.
+func imagesEqual(a, b *image.RGBA64) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+	for y := a.Rect.Min.Y; y < a.Rect.Max.Y; y++ {
+		for x := a.Rect.Min.X; x < a.Rect.Max.X; x++ {
+			if a.RGBA64At(x, y) != b.RGBA64At(x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"image/color"
+	"runtime"
+	"sync"
+)
+
+// Stats summarizes the escape behavior of the pixels of an escape-time render.
+type Stats struct {
+	Pixels          int     `json:"pixels"`          // Number of pixels in the image
+	Escaped         int     `json:"escaped"`         // Number of pixels whose points escape
+	EscapedFraction float64 `json:"escapedFraction"` // Escaped / Pixels
+	MeanEscapeIter  float64 `json:"meanEscapeIter"`  // Mean escape value (see juliaValue) of the escaping pixels
+}
+
+// JuliaStats returns the Stats of the image JuliaSingle renders for c and params.
+func JuliaStats(c complex128, params RenderParams) Stats {
+	cl := newColorer(params, color.RGBA64{}, params.pixelWidth())
+	return escapeStats(params, func(z complex128) float64 {
+		return cl.escapeValue(z, c)
+	})
+}
+
+// MandelbrotStats returns the Stats of the image Mandelbrot renders for params.
+func MandelbrotStats(params RenderParams) Stats {
+	cl := newColorer(params, color.RGBA64{}, params.pixelWidth())
+	return escapeStats(params, func(c complex128) float64 {
+		return cl.escapeValue(cl.critical, c)
+	})
+}
+
+// BurningShipStats returns the Stats of the image BurningShip renders for params.
+func BurningShipStats(params RenderParams) Stats {
+	cl := newColorer(params, color.RGBA64{}, params.pixelWidth())
+	cl.step = burningShipStep
+	return escapeStats(params, func(c complex128) float64 {
+		return cl.escapeValue(0, c)
+	})
+}
+
+// BurningShipJuliaStats returns the Stats of the image BurningShipJulia renders for c and params.
+func BurningShipJuliaStats(c complex128, params RenderParams) Stats {
+	cl := newColorer(params, color.RGBA64{}, params.pixelWidth())
+	cl.step = burningShipStep
+	return escapeStats(params, func(z complex128) float64 {
+		return cl.escapeValue(z, c)
+	})
+}
+
+// escapeStats accumulates the Stats of the escape values returned by escapeAt for the pixels of
+// a params.Size x params.Size image of params.View.  The values are those that
+// escape coloring would use, whatever params.Color is; supersampling and params.Precision are
+// ignored.
+func escapeStats(params RenderParams, escapeAt func(complex128) float64) Stats {
+	size, view := params.Size, params.View
+	var (
+		mu    sync.Mutex
+		stats Stats
+		sum   float64
+	)
+	renderBands(size, runtime.NumCPU(), func(py int) {
+		escaped, rowSum := 0, 0.0
+		y := view.y(py, size)
+		for px := 0; px < size; px++ {
+			if v := escapeAt(complex(view.x(px, size), y)); v > 0 {
+				escaped++
+				rowSum += v
+			}
+		}
+		mu.Lock()
+		stats.Escaped += escaped
+		sum += rowSum
+		mu.Unlock()
+	})
+	stats.Pixels = size * size
+	stats.EscapedFraction = float64(stats.Escaped) / float64(stats.Pixels)
+	if stats.Escaped > 0 {
+		stats.MeanEscapeIter = sum / float64(stats.Escaped)
+	}
+	return stats
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// MaxThumbScale is the most times larger than a thumbnail (see RenderParams.Thumb) the image it
+// is made from is rendered: larger sizes are capped at it, since averaging more pixels into each
+// pixel of the thumbnail barely changes it.
+const MaxThumbScale = 8
+
+// thumbSize returns the size of the thumbnail of an image of size size whose longer side is
+// shrunk to thumb pixels, keeping its shape, or size itself if it is no larger than that.
+func thumbSize(size image.Point, thumb int) image.Point {
+	long := max(size.X, size.Y)
+	if thumb <= 0 || long <= thumb {
+		return size
+	}
+	scale := float64(thumb) / float64(long)
+	return image.Pt(
+		max(1, int(math.Round(float64(size.X)*scale))),
+		max(1, int(math.Round(float64(size.Y)*scale))))
+}
+
+// areaWeight is the share of a pixel of a downscaled image contributed by the source pixel at
+// offset at.
+type areaWeight struct {
+	at     int
+	weight float64
+}
+
+// areaWeights returns, for each of the dst pixels a row (or column) of src pixels is shrunk to,
+// the source pixels it covers and the share of it that each covers.  Source pixels on the edge
+// of a destination pixel are shared between it and its neighbor in proportion to their overlap.
+func areaWeights(src, dst int) [][]areaWeight {
+	scale := float64(src) / float64(dst)
+	weights := make([][]areaWeight, dst)
+	for i := range weights {
+		lo, hi := float64(i)*scale, float64(i+1)*scale
+		for s := int(lo); float64(s) < hi && s < src; s++ {
+			overlap := math.Min(hi, float64(s+1)) - math.Max(lo, float64(s))
+			weights[i] = append(weights[i], areaWeight{s, overlap / scale})
+		}
+	}
+	return weights
+}
+
+// downscale shrinks img to width x height pixels by area averaging: each pixel of the result is
+// the average of the pixels of img it covers, weighted by how much of each it covers, so that
+// detail finer than the result can show is blended rather than dropped as it is by sampling
+// one point per pixel.  Colors are averaged premultiplied, so that transparent pixels do not
+// darken their neighbors.
+func downscale(img image.Image, width, height int) *image.RGBA64 {
+	b := img.Bounds()
+	xw, yw := areaWeights(b.Dx(), width), areaWeights(b.Dy(), height)
+	pixel := func(x, y int) color.RGBA64 { return color.RGBA64Model.Convert(img.At(x, y)).(color.RGBA64) }
+	if rgba, ok := img.(image.RGBA64Image); ok {
+		pixel = rgba.RGBA64At
+	}
+
+	// Shrink each row to width first, then each column of the result to height.
+	rows := make([][4]float64, b.Dy()*width)
+	for y := 0; y < b.Dy(); y++ {
+		for x, ws := range xw {
+			var sum [4]float64
+			for _, w := range ws {
+				c := pixel(b.Min.X+w.at, b.Min.Y+y)
+				sum[0] += w.weight * float64(c.R)
+				sum[1] += w.weight * float64(c.G)
+				sum[2] += w.weight * float64(c.B)
+				sum[3] += w.weight * float64(c.A)
+			}
+			rows[y*width+x] = sum
+		}
+	}
+	out := image.NewRGBA64(image.Rect(0, 0, width, height))
+	channel := func(v float64) uint16 { return uint16(math.Min(math.Round(v), 0xffff)) }
+	for y, ws := range yw {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+			for _, w := range ws {
+				for i, v := range rows[w.at*width+x] {
+					sum[i] += w.weight * v
+				}
+			}
+			out.SetRGBA64(x, y, color.RGBA64{channel(sum[0]), channel(sum[1]), channel(sum[2]), channel(sum[3])})
+		}
+	}
+	return out
+}
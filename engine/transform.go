@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"image"
+	"image/color"
+)
+
+// Rotations and reflections of output images, selected by RenderParams.Transform.  Rotations are
+// clockwise.
+const (
+	TransformNone   = "none"
+	TransformRot90  = "rot90"
+	TransformRot180 = "rot180"
+	TransformRot270 = "rot270"
+	TransformFlipH  = "fliph" // Mirror left to right
+	TransformFlipV  = "flipv" // Mirror top to bottom
+)
+
+// ValidTransform reports whether name names a supported transform.
+func ValidTransform(name string) bool {
+	switch name {
+	case TransformNone, TransformRot90, TransformRot180, TransformRot270, TransformFlipH, TransformFlipV:
+		return true
+	}
+	return false
+}
+
+// transformImage returns img rotated or flipped as transform names, with its top-left corner
+// at the origin, or img itself for TransformNone.  Each pixel is copied to its new place
+// unchanged, so the overlays drawn on img, captions included, turn with it.
+func transformImage(img image.Image, transform string) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// source returns the offset in img of the pixel shown at (x, y) of the result.
+	var source func(x, y int) (int, int)
+	size := image.Pt(w, h)
+	switch transform {
+	case TransformRot90:
+		size = image.Pt(h, w)
+		source = func(x, y int) (int, int) { return y, h - 1 - x }
+	case TransformRot180:
+		source = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case TransformRot270:
+		size = image.Pt(h, w)
+		source = func(x, y int) (int, int) { return w - 1 - y, x }
+	case TransformFlipH:
+		source = func(x, y int) (int, int) { return w - 1 - x, y }
+	case TransformFlipV:
+		source = func(x, y int) (int, int) { return x, h - 1 - y }
+	default:
+		return img
+	}
+	pixel := func(x, y int) color.RGBA64 { return color.RGBA64Model.Convert(img.At(x, y)).(color.RGBA64) }
+	if rgba, ok := img.(image.RGBA64Image); ok {
+		pixel = rgba.RGBA64At
+	}
+	out := image.NewRGBA64(image.Rectangle{Max: size})
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			sx, sy := source(x, y)
+			out.SetRGBA64(x, y, pixel(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return out
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/psteitz/ifs/engine"
+)
+
+// exploreTile is the text message sent ahead of each tile rendered by /explore.  For a 200 Status
+// it is followed by a binary message holding the image; otherwise Error says what went wrong and
+// the rest of the viewport is skipped.
+type exploreTile struct {
+	Query       string `json:"query"` // the viewport the tile belongs to, as sent by the client
+	Row         int    `json:"row"`
+	Col         int    `json:"col"`
+	Tiles       int    `json:"tiles"` // rows * cols
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// explore serves a live explorer over a WebSocket.  The client sends viewports as text messages,
+// each the query string of a /tile request without row and col (e.g. type=mandelbrot&xmin=-1&...
+// &rows=2&cols=2&size=256), and the server answers with the tiles of each viewport in row-major
+// order, each an exploreTile message followed by the image.  A new viewport cancels the one being
+// rendered: its remaining tiles are skipped, and the tile in progress is finished but not sent.
+// Viewports sent while one is rendering are coalesced, so only the latest is rendered next.
+func explore(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		log.Println("explore:", err)
+		return
+	}
+	defer ws.Close()
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var (
+		mu           sync.Mutex
+		latest       string                         // the latest viewport not yet started
+		waiting      bool                           // whether latest is waiting to be started
+		cancelRender context.CancelFunc = func() {} // cancels the viewport being rendered
+	)
+	pending := make(chan struct{}, 1) // signaled when latest is set
+	go func() {
+		defer cancel()
+		for {
+			opcode, msg, err := ws.readMessage()
+			if err != nil {
+				return
+			}
+			if opcode != wsText {
+				continue
+			}
+			mu.Lock()
+			cancelRender()
+			latest, waiting = string(msg), true
+			mu.Unlock()
+			select {
+			case pending <- struct{}{}:
+			default: // already signaled; the earlier viewport is superseded before it started
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-pending:
+		case <-ctx.Done():
+			return
+		}
+		mu.Lock()
+		if !waiting { // signaled for a viewport already started
+			mu.Unlock()
+			continue
+		}
+		query := latest
+		waiting = false
+		renderCtx, done := context.WithCancel(ctx)
+		cancelRender = done
+		mu.Unlock()
+		err := exploreViewport(renderCtx, ws, r, query)
+		done()
+		if err != nil {
+			log.Println("explore:", err)
+			return
+		}
+	}
+}
+
+// exploreViewport renders the tiles of the viewport given by query with the /tile handler and
+// sends them to ws, stopping early if ctx is canceled.  It returns an error only if ws fails.
+func exploreViewport(ctx context.Context, ws *wsConn, r *http.Request, query string) error {
+	start := time.Now()
+	var (
+		sent   int
+		render time.Duration // total render time of the tiles, excluding encoding
+	)
+	defer func() {
+		slog.Info("explore", "query", query, "tiles", sent, "duration", time.Since(start), "render", render,
+			"canceled", ctx.Err() != nil)
+	}()
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return ws.sendTile(exploreTile{Query: query, Status: http.StatusBadRequest, Error: err.Error()}, nil)
+	}
+	// The request that opened the connection passed keyGated and rateLimited once, with no
+	// parameters to speak of, so each viewport is held to the anonymous limits and counted
+	// against the client's rate as a request of its own.
+	if problems := anonymousProblems(r, values); len(problems) > 0 {
+		data, _ := json.Marshal(struct {
+			Errors []engine.ParamError `json:"errors"`
+		}{problems})
+		return ws.sendTile(exploreTile{Query: query, Status: http.StatusUnauthorized, Error: string(data)}, nil)
+	}
+	if l := rateLimiter; l != nil {
+		if ok, wait := l.allow(l.clientIP(r), time.Now()); !ok {
+			return ws.sendTile(exploreTile{Query: query, Status: http.StatusTooManyRequests,
+				Error: fmt.Sprintf("too many requests, slow down; retry in %d s", int(math.Ceil(wait.Seconds())))}, nil)
+		}
+	}
+	q := engine.NewQuery(values)
+	rows := q.Int("rows", 1, 1, maxTiles)
+	cols := q.Int("cols", 1, 1, maxTiles)
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			if ctx.Err() != nil {
+				return nil
+			}
+			values.Set("row", strconv.Itoa(row))
+			values.Set("col", strconv.Itoa(col))
+			rl := &requestLog{}
+			tr := r.Clone(context.WithValue(ctx, requestLogKey{}, rl))
+			tr.URL.RawQuery = values.Encode()
+			tr.Header.Del("If-None-Match") // the client wants the image, not a 304
+			rec := newResponseRecorder()
+			tile(rec, tr)
+			render += rl.render
+			if ctx.Err() != nil {
+				return nil // superseded while rendering
+			}
+			msg := exploreTile{Query: query, Row: row, Col: col, Tiles: rows * cols, Status: rec.status}
+			if rec.status != http.StatusOK {
+				msg.Error = string(bytes.TrimSpace(rec.body.Bytes()))
+				return ws.sendTile(msg, nil)
+			}
+			msg.ContentType = rec.header.Get("Content-Type")
+			if err := ws.sendTile(msg, rec.body.Bytes()); err != nil {
+				return err
+			}
+			sent++
+		}
+	}
+	return nil
+}
+
+// sendTile sends msg, followed by image unless it is nil.
+func (c *wsConn) sendTile(msg exploreTile, image []byte) error {
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false) // leave the & of the query alone
+	if err := enc.Encode(msg); err != nil {
+		return err
+	}
+	if err := c.writeMessage(wsText, bytes.TrimSpace(data.Bytes())); err != nil {
+		return err
+	}
+	if image == nil {
+		return nil
+	}
+	return c.writeMessage(wsBinary, image)
+}
+
+// responseRecorder is an http.ResponseWriter that keeps the response in memory, so that /explore
+// can send the responses of the /tile handler over its WebSocket.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: http.Header{}, status: http.StatusOK}
+}
+
+func (rr *responseRecorder) Header() http.Header {
+	return rr.header
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+}
+
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	return rr.body.Write(p)
+}
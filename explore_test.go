@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// exploreResult renders the viewport query as /explore would for a connection opened by r, and
+// returns the first tile message sent.
+func exploreResult(t *testing.T, r *http.Request, query string) exploreTile {
+	t.Helper()
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	ws := &wsConn{conn: server, rw: bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server))}
+	go exploreViewport(context.Background(), ws, r, query)
+
+	_, msg, err := readServerFrame(bufio.NewReader(client))
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	var tile exploreTile
+	if err := json.Unmarshal(msg, &tile); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return tile
+}
+
+// Each viewport is held to the anonymous limits when the connection has no API key.
+func TestExploreAnonymousLimits(t *testing.T) {
+	defer setAPIKeys(nil)
+	setAPIKeys([]string{"secret"})
+	anon := httptest.NewRequest("GET", "/explore", nil)
+	keyed := httptest.NewRequest("GET", "/explore", nil)
+	keyed.Header.Set("X-API-Key", "secret")
+
+	tests := []struct {
+		r     *http.Request
+		query string
+		want  int
+	}{
+		{anon, "type=mandelbrot&size=16", http.StatusOK},
+		{anon, "type=mandelbrot&size=4096", http.StatusUnauthorized},
+		{anon, "type=mandelbrot&size=16&precision=200", http.StatusUnauthorized},
+		{anon, "type=mandelbrot&size=16&rows=16&cols=16", http.StatusUnauthorized},
+		{keyed, "type=mandelbrot&size=1100&maxiter=10", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := exploreResult(t, tt.r, tt.query); got.Status != tt.want {
+			t.Errorf("%s (key %q): status %d (%s), want %d", tt.query, tt.r.Header.Get("X-API-Key"), got.Status, got.Error, tt.want)
+		}
+	}
+}
+
+// Each viewport counts against the client's rate.
+func TestExploreRateLimit(t *testing.T) {
+	defer func(l *clientLimiter) { rateLimiter = l }(rateLimiter)
+	rateLimiter = newClientLimiter(0.001, 2, false)
+	r := httptest.NewRequest("GET", "/explore", nil)
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := exploreResult(t, r, "type=mandelbrot&size=16"); got.Status != want {
+			t.Errorf("viewport %d: status %d (%s), want %d", i, got.Status, got.Error, want)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// An endpoint describes one of the server's endpoints, for registering its handler and listing
+// it on the index page.
+type endpoint struct {
+	Path    string
+	Purpose string
+	Params  []paramDoc // request parameters, if any
+	Example string     // example request, if any
+	Info    bool       // whether Path+"/info" serves a JSON description of the image
+	handler http.HandlerFunc
+	cheap   bool // whether requests are exempt from the per-client rate limit (see rateLimited)
+}
+
+// paramDoc documents a request parameter of an endpoint.
+type paramDoc struct {
+	Name    string
+	Meaning string
+	Default string
+}
+
+// Parameters shared by several endpoints
+var (
+	viewDocs = []paramDoc{
+		{"xmin, xmax", "Real range of the window in the complex plane", "-2, 2"},
+		{"ymin, ymax", "Imaginary range of the window in the complex plane", "-2, 2"},
+		{"centerre, centerim", "Center of the window, instead of its edges", "center of the default window"},
+		{"zoom", "Magnification about the center, relative to the default window; the window keeps the shape of the image", "1"},
+	}
+	stillDocs = []paramDoc{
+		{"size", "Width and height of the image in pixels (up to 4096)", "1024"},
+		{"aa", "Supersampling factor (1-4)", "1"},
+		{"downfilter", "How the samples of aa are collapsed into pixels: box (average), bilinear (softest) or lanczos (crisp with less aliasing)", "box"},
+		{"format", "Output format, png or jpeg", "png"},
+		{"quality", "JPEG quality (1-100)", "75"},
+		{"pngcompress", "PNG compression: default, best-speed or best-compression", "default"},
+		{"mono", "true for a grayscale image", "false"},
+		{"invert", "true to invert the colors", "false"},
+		{"thumb", "Longer side of a thumbnail to shrink the image to by area averaging; size is capped at 8 times it, and the crop is ignored", ""},
+		{"grid", "true to draw the axes and gridlines with tick labels over the image", "false"},
+		{"mark", "A point re,im to mark with a crosshair, if in the window; repeat for more (up to 64)", ""},
+		{"transform", "Rotate or flip the finished image: none, rot90, rot180, rot270 (clockwise), fliph or flipv", "none"},
+		{"label", "true to caption the image with its c, if any, and the center and width of its window", "false"},
+		{"labelpos", "Corner of the caption: bottom-left, bottom-right, top-left or top-right", "bottom-left"},
+		{"px0, py0, px1, py1", "Render only the pixels px0 <= x < px1, py0 <= y < py1 of the size x size image", "0, 0, size, size"},
+	}
+	escapeDocs = []paramDoc{
+		{"maxiter", "Maximum iterations per pixel (up to 100000)", "400"},
+		{"escape", "Escape radius, at least 2 (up to 1e150); the default depends on map", "2"},
+		{"smooth", "true for continuous coloring without bands", "false"},
+		{"transparent", "true to make the points of still images that do not escape transparent instead of black, for compositing (PNG only; animation frames always are)", "false"},
+		{"cyclecheck", "true to stop iterating points whose orbit has settled on an attracting cycle; much faster where there is a lot of interior", "false"},
+		{"palette", "Color palette: default, fire, ice or grayscale", "default"},
+		{"colorseed", "Nonzero to vary the palette's hue and ramp reproducibly, a different variation for each number", "0"},
+		{"color", "Coloring mode: escape, trap, distance, histogram, period or maxmod", "escape"},
+		{"trap", "Orbit trap for color=trap: point or cross", "point"},
+		{"dither", "none, or ordered to break up the bands between escape counts with a Bayer pattern", "none"},
+		{"power", "Exponent of z in z -> z^power + c (greater than 1, up to 16)", "2"},
+		{"map", "Iteration: square (z -> z^power + c), sin (z -> c*sin(z)), cos or exp; escape defaults to 2 for square and 50 for the others.  Ignored by /burningship", "square"},
+		{"z0re, z0im", "Offset of the starting point of the iteration from the pixel (Julia) or 0 (Mandelbrot)", "0, 0"},
+		{"autoframe", "true to zoom the window to the boundary of the set, found by a coarse first pass", "false"},
+	}
+	cDocs = []paramDoc{
+		{"re", "Real part of c", "-1.25"},
+		{"im", "Imaginary part of c", "0"},
+	}
+	orbitDocs = []paramDoc{
+		{"orbitsteps", "Steps of an orbit to draw over the Julia set, as dots joined by lines (up to 10000)", "0"},
+		{"orbitre, orbitim", "Starting point of the orbit; the default is the critical orbit", "0, 0"},
+	}
+)
+
+// docs concatenates groups of parameter docs.
+func docs(groups ...[]paramDoc) []paramDoc {
+	var all []paramDoc
+	for _, g := range groups {
+		all = append(all, g...)
+	}
+	return all
+}
+
+// endpoints lists every endpoint of the server other than the index page itself.  main registers
+// their handlers from it, so the index page lists exactly what the server serves.
+var endpoints = []endpoint{
+	{
+		Path:    "/juliaSingle",
+		Purpose: "PNG of the Julia set for z -> z^power + c",
+		Params:  docs(cDocs, escapeDocs, viewDocs, stillDocs, orbitDocs, []paramDoc{{"precision", "Mantissa bits for deep zooms (up to 1024)", "53"}}),
+		Example: "/juliaSingle?re=-0.8&im=0.156&size=512",
+		Info:    true,
+		handler: juliaSingle,
+	},
+	{
+		Path:    "/julia/random",
+		Purpose: "PNG of the Julia set for an interesting c near the Mandelbrot boundary, picked at random",
+		Params:  docs([]paramDoc{{"seed", "Seed making the choice of c reproducible", "random"}}, escapeDocs, viewDocs, stillDocs, orbitDocs),
+		Example: "/julia/random?seed=123&size=512",
+		Info:    true,
+		handler: juliaRandom,
+	},
+	{
+		Path:    "/compare",
+		Purpose: "PNG comparing the Julia sets for two c values, side by side with a divider",
+		Params: docs([]paramDoc{
+			{"c1, c2", "The c values, as re,im", "0.25 and 0.26, either side of the cusp of the Mandelbrot set"},
+			{"layout", "horizontal, or vertical for one above the other", "horizontal"},
+			{"divider", "Width of the divider in pixels (up to 64)", "4"},
+		}, escapeDocs, viewDocs, stillDocs[:len(stillDocs)-1]),
+		Example: "/compare?c1=-0.75,0.05&c2=-0.75,0.15&size=384",
+		handler: juliaCompare,
+	},
+	{
+		Path:    "/montage",
+		Purpose: "PNG contact sheet of Julia set thumbnails for a grid of c values, each labeled with its c",
+		Params: docs([]paramDoc{
+			{"rows, cols", "Grid of thumbnails (1-16)", "4"},
+			{"cxmin, cxmax", "Real range of the c values sampled", "-2.5, 1.5"},
+			{"cymin, cymax", "Imaginary range of the c values sampled, from the top row down", "-2, 2"},
+			{"size", "Width and height of each thumbnail in pixels (16-512)", "128"},
+		}, escapeDocs, viewDocs, stillDocs[1:len(stillDocs)-1]),
+		Example: "/montage?cxmin=-1&cxmax=0.5&cymin=0&cymax=1&rows=3&cols=4",
+		handler: juliaMontage,
+	},
+	{
+		Path:    "/julia/data",
+		Purpose: "JSON matrix of the escape values of the pixels of a /juliaSingle image, 0 for points that do not escape",
+		Params: docs(cDocs, escapeDocs, viewDocs, []paramDoc{
+			{"size", "Width and height of the matrix (up to 1024)", "1024"},
+			{"px0, py0, px1, py1", "Return only the values of the pixels px0 <= x < px1, py0 <= y < py1", "0, 0, size, size"},
+		}),
+		Example: "/julia/data?re=-0.8&im=0.156&size=64",
+		handler: juliaData,
+	},
+	{
+		Path:    "/julia/dimension",
+		Purpose: "JSON estimate of the box-counting dimension of the Julia set for c, with the box counts it is fitted to",
+		Params: docs(cDocs, []paramDoc{
+			{"maxiter", "Maximum iterations per pixel (up to 100000)", "400"},
+			{"escape", "Escape radius, at least 2 (up to 1e150); the default depends on map", "2"},
+			{"power", "Exponent of z in z -> z^power + c (greater than 1, up to 16)", "2"},
+		}, viewDocs, []paramDoc{{"size", "Width and height of the sampled image (up to 1024)", "1024"}}),
+		Example: "/julia/dimension?re=-0.123&im=0.745&size=512",
+		handler: juliaDimension,
+	},
+	{
+		Path:    "/julia/connected",
+		Purpose: "JSON telling whether the Julia set for c is connected, i.e. whether c is in the Mandelbrot set, by the escape test of the critical orbit",
+		Params: docs(cDocs, []paramDoc{
+			{"maxiter", "Iterations after which the orbit is taken not to escape (up to 100000)", "400"},
+			{"escape", "Escape radius, at least 2 (up to 1e150); the default depends on map", "2"},
+			{"power", "Exponent of z in z -> z^power + c (greater than 1, up to 16)", "2"},
+		}),
+		Example: "/julia/connected?re=-0.123&im=0.745",
+		handler: juliaConnected,
+	},
+	{
+		Path:    "/julia",
+		Purpose: "Animated GIF of Julia sets as c follows a path",
+		Params: docs([]paramDoc{
+			{"paramPath", "Path followed by c: Exp, Angor, Wabbit, Line, Spiral, Power or Zoom; a POST can give the c values instead, as a JSON array of {re, im} objects", "Exp"},
+			{"numframes", "Number of frames (up to 1024)", "64"},
+			{"numworkers", "Number of goroutines rendering frames (up to twice the number of CPUs)", "4"},
+			{"cstart, cend", "Ends of the Line path, as re,im", "-1.25,0 and 0.25,0"},
+			{"maxpower", "Exponent at the last frame of the Power path", "5"},
+			{"turns", "Number of turns of the Spiral path", "3"},
+			{"zoomfactor", "Magnification from one frame of the Zoom path to the next, which dives into the center of the window with c fixed at cstart (up to 10)", "1.1"},
+			{"mandelbrot", "true to show the Mandelbrot set in every frame instead of a Julia set", "false"},
+			{"delay", "Delay between frames, in 100ths of a second", "8"},
+			{"loop", "Number of times the animation loops; 0 loops forever", "numframes"},
+			{"boomerang", "true to play the frames forward and then backward", "false"},
+			{"format", "gif, or apng for full-color frames", "gif"},
+			{"gifpalette", "Palette of GIF frames: plan9, adaptive (fitted to each frame), ramp (samples of palette) or global (fitted to a sample of frames and shared by all of them)", "plan9"},
+			{"mono", "true for grayscale frames", "false"},
+			{"invert", "true to invert the colors of the frames", "false"},
+			{"grid", "true to draw the axes and gridlines with tick labels over the frames", "false"},
+			{"mark", "A point re,im to mark with a crosshair in every frame; repeat for more (up to 64)", ""},
+			{"transform", "Rotate or flip every frame: none, rot90, rot180, rot270 (clockwise), fliph or flipv", "none"},
+			{"progress", "An id under which /julia/progress reports the progress of the render", ""},
+			{"size", "Width and height of the frames in pixels (up to 4096)", "1024"},
+		}, escapeDocs, viewDocs),
+		Example: "/julia?numframes=16&size=256",
+		Info:    true,
+		handler: julia,
+	},
+	{
+		Path:    "/julia/progress",
+		Purpose: "Server-Sent Events reporting the frames rendered so far of a /julia animation",
+		Params:  []paramDoc{{"id", "The progress parameter of the /julia request to follow", ""}},
+		Example: "/julia/progress?id=demo",
+		handler: juliaProgress,
+		cheap:   true,
+	},
+	{
+		Path:    "/mandelbrot",
+		Purpose: "PNG of the Mandelbrot set (or the Multibrot set for other powers)",
+		Params:  docs(escapeDocs, viewDocs, stillDocs, []paramDoc{{"precision", "Mantissa bits for deep zooms (up to 1024)", "53"}}),
+		Example: "/mandelbrot?smooth=true&size=512",
+		Info:    true,
+		handler: mandelbrot,
+	},
+	{
+		Path:    "/mandelbrot/inset",
+		Purpose: "PNG of the Mandelbrot set with a thumbnail of the Julia set for c in a corner and c marked on the set",
+		Params: docs(cDocs, []paramDoc{
+			{"inset", "Width and height of the thumbnail in pixels (16 up to half of size)", "size/4"},
+			{"insetpos", "Corner of the thumbnail: top-right, top-left, bottom-left or bottom-right", "top-right"},
+		}, escapeDocs, viewDocs, stillDocs[:len(stillDocs)-1], []paramDoc{{"precision", "Mantissa bits for deep zooms of the Mandelbrot set (up to 1024)", "53"}}),
+		Example: "/mandelbrot/inset?re=-0.745&im=0.113&size=768",
+		handler: mandelbrotInset,
+	},
+	{
+		Path:    "/burningship",
+		Purpose: "PNG of the Burning Ship fractal, or with julia=true its Julia set for c",
+		Params:  docs([]paramDoc{{"julia", "true to render the Julia set for re and im", "false"}}, cDocs, escapeDocs, viewDocs, stillDocs, orbitDocs),
+		Example: "/burningship?xmin=-1.8&xmax=-1.7&ymin=-0.08&ymax=0.02&size=512",
+		Info:    true,
+		handler: burningShip,
+	},
+	{
+		Path:    "/newton",
+		Purpose: "PNG of the basins of Newton's method for z^n - 1 or any real polynomial",
+		Params: docs([]paramDoc{
+			{"degree", "Degree n of z^n - 1 (2-32)", "4"},
+			{"coeffs", "Coefficients of a polynomial to use instead, highest degree first", ""},
+			{"maxiter", "Maximum Newton iterations per pixel", "400"},
+			{"tol", "Convergence tolerance", "1e-10"},
+			{"a", "Relaxation factor of the Newton step", "1"},
+			{"contrast", "How quickly colors darken with slow convergence (0-60000)", "2000"},
+			{"colors", "Basin colors as comma-separated hex rrggbb, repeated as needed", ""},
+			{"nonconv", "Color of points that do not converge: black, gray or ramp", "black"},
+			{"palette", "Color palette for nonconv=ramp", "default"},
+			{"colorseed", "Nonzero to vary the palette reproducibly", "0"},
+			{"numworkers", "Number of goroutines rendering bands of the image (up to twice the number of CPUs)", "4"},
+		}, viewDocs, stillDocs),
+		Example: "/newton?coeffs=1,0,-2,2&size=512",
+		Info:    true,
+		handler: newton,
+	},
+	{
+		Path:    "/newton/roots",
+		Purpose: "JSON of the roots whose basins /newton colors, with the color of each basin",
+		Params: []paramDoc{
+			{"degree", "Degree n of z^n - 1 (2-32)", "4"},
+			{"coeffs", "Coefficients of a polynomial to use instead, highest degree first", ""},
+			{"colors", "Basin colors as comma-separated hex rrggbb, repeated as needed", ""},
+		},
+		Example: "/newton/roots?coeffs=1,0,-2,2",
+		handler: newtonRoots,
+	},
+	{
+		Path:    "/nova",
+		Purpose: "PNG of the Nova fractal, where each pixel c adds to a relaxed Newton step for z^n - 1",
+		Params: docs([]paramDoc{
+			{"R", "Relaxation constant R of z -> z - R*(z^n - 1)/(n*z^(n-1)) + c", "1"},
+			{"degree", "Degree n (2-32)", "3"},
+			{"maxiter", "Maximum iterations per pixel", "400"},
+			{"tol", "Step size below which the iterates count as settled", "1e-10"},
+			{"contrast", "How quickly colors darken with slow convergence (0-60000)", "300"},
+			{"colors", "Basin colors as comma-separated hex rrggbb, repeated as needed", ""},
+			{"z0re, z0im", "Offset of the starting point from the critical point 1", "0, 0"},
+			{"numworkers", "Number of goroutines rendering bands of the image (up to twice the number of CPUs)", "4"},
+		}, viewDocs, stillDocs),
+		Example: "/nova?size=512",
+		Info:    true,
+		handler: nova,
+	},
+	{
+		Path:    "/ifs",
+		Purpose: "PNG of an affine IFS attractor drawn with the chaos game",
+		Params: docs([]paramDoc{
+			{"preset", "fern, sierpinski-triangle or sierpinski-carpet", "fern"},
+			{"iterations", "Number of points plotted", "2000000"},
+			{"color", "density or recency", "density"},
+			{"palette", "Color palette", "default"},
+			{"colorseed", "Nonzero to vary the palette reproducibly", "0"},
+		}, viewDocs, stillDocs),
+		Example: "/ifs?preset=sierpinski-carpet&size=512",
+		Info:    true,
+		handler: affine,
+	},
+	{
+		Path:    "/palette",
+		Purpose: "PNG preview of a color palette, as a horizontal gradient",
+		Params: []paramDoc{
+			{"name", "default, fire, ice or grayscale", "default"},
+			{"colorseed", "Nonzero to preview the palette as varied by colorseed", "0"},
+			{"width", "Width of the strip in pixels (up to 4096)", "512"},
+			{"height", "Height of the strip in pixels (up to 4096)", "32"},
+		},
+		Example: "/palette?name=fire&width=512",
+		handler: paletteStrip,
+	},
+	{
+		Path:    "/render",
+		Purpose: "Any of the images above, selected by type, with the parameters of its endpoint",
+		Params:  []paramDoc{{"type", "newton, julia, animation, mandelbrot, burningship, ifs or nova", ""}},
+		Example: "/render?type=julia&re=-0.8&im=0.156&size=512",
+		handler: render,
+	},
+	{
+		Path:    "/tile",
+		Purpose: "One tile of a large still image, for stitching together client-side",
+		Params: []paramDoc{
+			{"type", "newton, julia, mandelbrot, burningship or nova", ""},
+			{"rows, cols", "Grid of tiles the window is divided into (1-256)", "1"},
+			{"row, col", "Tile to render, counting from 0", "0"},
+		},
+		Example: "/tile?type=mandelbrot&rows=2&cols=2&row=0&col=1&size=256",
+		handler: tile,
+	},
+	{
+		Path:    "/explore",
+		Purpose: "WebSocket live explorer: send /tile query strings (without row and col) as text messages, get back their tiles; a new viewport cancels the last",
+		handler: explore,
+	},
+	{Path: "/healthz", Purpose: "Liveness probe", handler: healthz, cheap: true},
+	{Path: "/readyz", Purpose: "Readiness probe", handler: readyz, cheap: true},
+	{Path: "/metrics", Purpose: "Prometheus metrics", handler: metricsHandler, cheap: true},
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ifs</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.5em; text-align: left; }
+</style>
+</head>
+<body>
+<h1>ifs</h1>
+<p>Images of iterated function systems.  Parameters are passed in the query string; missing or
+invalid values take their defaults.  Add strict=true to any request to have invalid values rejected
+instead, with a 400 response listing them as JSON.</p>
+{{range .}}
+<h2>{{.Path}}</h2>
+<p>{{.Purpose}}.{{if .Info}}  <a href="{{.Path}}/info">{{.Path}}/info</a> describes the image as JSON instead.{{end}}</p>
+{{if .Params}}<table>
+<tr><th>Parameter</th><th>Meaning</th><th>Default</th></tr>
+{{range .Params}}<tr><td>{{.Name}}</td><td>{{.Meaning}}</td><td>{{.Default}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Example}}<p>Example: <a href="{{.Example}}">{{.Example}}</a></p>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// index serves an HTML page listing the endpoints, their parameters and example requests.
+// Any other path that no endpoint serves gets a 404.
+func index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, endpoints); err != nil {
+		log.Println("Error writing index:", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// renderLimiter bounds the number of renders that run at once, so that a burst of expensive
+// requests (e.g. long animations) cannot saturate every core and starve the rest.  Requests over
+// the limit wait up to timeout for a render to finish, and are then turned away.
+type renderLimiter struct {
+	slots   chan struct{} // one element per render in progress
+	timeout time.Duration // how long a request waits for a free slot
+}
+
+// limiter governs every render; main replaces it with one configured from the command line.
+var limiter = newRenderLimiter(4, 10*time.Second)
+
+func newRenderLimiter(maxRenders int, timeout time.Duration) *renderLimiter {
+	return &renderLimiter{slots: make(chan struct{}, maxRenders), timeout: timeout}
+}
+
+// acquire waits for a free render slot and reports whether it got one.  It gives up after the
+// limiter's timeout or when r is canceled.
+func (l *renderLimiter) acquire(r *http.Request) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	serverMetrics.queued.Inc()
+	defer serverMetrics.queued.Dec()
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// release frees a slot taken by acquire.
+func (l *renderLimiter) release() {
+	<-l.slots
+}
+
+// tooBusy sends a 503 response asking the client to retry once the renders ahead of it are
+// likely to have finished.  Any image headers already set for the response are removed.
+func (l *renderLimiter) tooBusy(w http.ResponseWriter) {
+	w.Header().Del("Content-Disposition")
+	w.Header().Del("ETag")
+	w.Header().Set("Retry-After", fmt.Sprint(int(l.timeout.Seconds())+1))
+	http.Error(w, "too many renders in progress, try again later", http.StatusServiceUnavailable)
+}
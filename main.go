@@ -14,67 +14,873 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"math/big"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/psteitz/ifs/engine"
 )
 
+const (
+	shutdownTimeout = 30 * time.Second // How long in-flight requests are given to finish when the server is stopped
+	defaultAddr     = "localhost:8000" // Listen address used when neither -addr nor IFS_ADDR is set
+)
+
+// imageCache holds recently rendered still images, keyed by their canonical parameters.
+var imageCache *engine.Cache
+
 func main() {
-	http.HandleFunc("/newton", newton)    			// Single png 4th roots of unity
-	http.HandleFunc("/julia", julia)      			// Animated GIF of Julia set images
-	http.HandleFunc("/juliaSingle", juliaSingle)   	// Single png of a Julia set
-	log.Fatal(http.ListenAndServe("localhost:8000", nil))
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		os.Exit(renderCommand(os.Args[2:]))
+	}
+	addr := flag.String("addr", envOr("IFS_ADDR", defaultAddr), "address to listen on (overrides the IFS_ADDR environment variable)")
+	cacheSize := flag.Int("cachesize", 64, "maximum number of rendered images to cache (0 disables caching)")
+	maxRenders := flag.Int("maxrenders", runtime.NumCPU(), "maximum number of renders to run at once")
+	queueTimeout := flag.Duration("queuetimeout", 10*time.Second, "how long a request waits for a render slot before getting a 503")
+	rate := flag.Float64("ratelimit", 0, "requests a second each client may make to the endpoints that render, on average (0 for no limit)")
+	burst := flag.Int("rateburst", 10, "requests a client may make at once before -ratelimit applies")
+	trustProxy := flag.Bool("trustproxy", false, "take the client IP for -ratelimit from the X-Forwarded-For header of a proxy in front of the server")
+	configPath := flag.String("config", "", "JSON file of server settings and request parameter defaults (see Config)")
+	flag.Parse()
+	var defaults map[string]url.Values
+	if *configPath != "" {
+		cfg, err := loadConfig(*configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Flags given on the command line, and IFS_ADDR, win over the file.
+		set := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if cfg.Addr != "" && !set["addr"] && os.Getenv("IFS_ADDR") == "" {
+			*addr = cfg.Addr
+		}
+		if cfg.CacheSize != nil && !set["cachesize"] {
+			*cacheSize = *cfg.CacheSize
+		}
+		if cfg.MaxRenders > 0 && !set["maxrenders"] {
+			*maxRenders = cfg.MaxRenders
+		}
+		if cfg.QueueTimeout > 0 && !set["queuetimeout"] {
+			*queueTimeout = time.Duration(cfg.QueueTimeout)
+		}
+		if cfg.RateLimit > 0 && !set["ratelimit"] {
+			*rate = cfg.RateLimit
+		}
+		if cfg.RateBurst > 0 && !set["rateburst"] {
+			*burst = cfg.RateBurst
+		}
+		if cfg.TrustProxy && !set["trustproxy"] {
+			*trustProxy = true
+		}
+		cfg.applyLimits()
+		setAPIKeys(cfg.APIKeys)
+		anonymous = *cfg.Anonymous
+		allowedOrigins = cfg.AllowedOrigins
+		defaults, _ = cfg.defaultValues() // checked by loadConfig
+	}
+	imageCache = engine.NewCache(*cacheSize)
+	limiter = newRenderLimiter(max(1, *maxRenders), *queueTimeout)
+	if *rate > 0 {
+		rateLimiter = newClientLimiter(*rate, *burst, *trustProxy)
+	}
+
+	for _, e := range endpoints {
+		handler := e.handler
+		if !e.cheap {
+			handler = rateLimited(keyGated(handler))
+		}
+		http.HandleFunc(e.Path, handler)
+		if e.Info { // JSON description of the image, without the image
+			http.HandleFunc(e.Path+"/info", handler)
+		}
+	}
+	http.HandleFunc("/", index) // Index page listing the endpoints
+
+	// Serve until SIGINT or SIGTERM, then stop accepting connections and give active
+	// requests up to shutdownTimeout to complete.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{Addr: *addr, Handler: logRequests(compressResponses(withDefaults(defaults, http.DefaultServeMux)))}
+	log.Println("Listening on", *addr)
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Shutdown incomplete:", err)
+	}
+}
+
+// envOr returns the value of the environment variable called name, or def if it is unset or empty.
+func envOr(name string, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// renderers maps the values of the /render type parameter to the handlers that render them.
+var renderers = map[string]http.HandlerFunc{
+	"newton":      newton,
+	"julia":       juliaSingle,
+	"animation":   julia,
+	"mandelbrot":  mandelbrot,
+	"burningship": burningShip,
+	"ifs":         affine,
+	"nova":        nova,
+}
+
+// render serves any of the fractals, selected by the type request parameter (see renderers),
+// with the same request parameters as the dedicated endpoint for that type.  Unknown types
+// get a 400 listing the supported ones.
+func render(w http.ResponseWriter, r *http.Request) {
+	handler, ok := renderers[r.URL.Query().Get("type")]
+	if !ok {
+		types := make([]string, 0, len(renderers))
+		for name := range renderers {
+			types = append(types, name)
+		}
+		sort.Strings(types)
+		q := engine.NewQuery(r.URL.Query())
+		q.FailParam("type", "type must be one of %s", strings.Join(types, ", "))
+		checkQuery(w, q)
+		return
+	}
+	handler(w, r)
+}
+
+// maxTiles is the largest number of rows or columns of tiles accepted by /tile.
+const maxTiles = 256
+
+// tileViews maps the values of the /tile type parameter to the default windows of their renderers.
+var tileViews = map[string]engine.Viewport{
+	"newton":      engine.DefaultView,
+	"julia":       engine.DefaultView,
+	"mandelbrot":  engine.MandelbrotView,
+	"burningship": engine.BurningShipView,
+	"nova":        engine.NovaView,
+}
+
+// tile serves one tile of a still image too large to render in one piece, so that a client can
+// fetch the tiles in parallel and stitch them together.  The window parameters give the window of
+// the whole image, rows and cols the grid of tiles it is divided into, and row and col (counting
+// from 0, row 0 at ymin) the tile to render.  A window given by centerre, centerim and zoom is
+// fitted to the shape of the whole image, cols tiles wide by rows high.  The tile is rendered by
+// the /render handler for the type parameter (one of tileViews) at size x size pixels, with the
+// window narrowed to the tile; the other parameters, except autoframe, are passed on unchanged.  Tiles line up exactly with
+// the pixels of a single render of the whole window at cols*size x rows*size.
+func tile(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	typ := q.Get("type")
+	def, ok := tileViews[typ]
+	if !ok {
+		types := make([]string, 0, len(tileViews))
+		for name := range tileViews {
+			types = append(types, name)
+		}
+		sort.Strings(types)
+		q.FailParam("type", "type must be one of %s", strings.Join(types, ", "))
+		checkQuery(w, q)
+		return
+	}
+	rows := q.Int("rows", 1, 1, maxTiles)
+	cols := q.Int("cols", 1, 1, maxTiles)
+	view, bigView := bigViewParam(q, def, cols, rows) // the whole image is cols tiles wide and rows high
+	row := q.Int("row", 0, 0, rows-1)
+	col := q.Int("col", 0, 0, cols-1)
+	if !checkQuery(w, q) {
+		return
+	}
+	logParams(r, "rows", rows, "cols", cols, "row", row, "col", col)
+
+	t := view.Tile(rows, cols, row, col)
+	values := r.URL.Query()
+	values.Del("autoframe") // each tile would frame itself, and the tiles would no longer line up
+	for _, name := range []string{"centerre", "centerim", "zoom"} {
+		values.Del(name) // the tile's window replaces them
+	}
+	for name, edge := range map[string]float64{"xmin": t.XMin, "ymin": t.YMin, "xmax": t.XMax, "ymax": t.YMax} {
+		values.Set(name, strconv.FormatFloat(edge, 'g', -1, 64))
+	}
+	if bigView != (engine.BigViewport{}) { // the edges need more digits than float64 has
+		bt := bigView.Tile(view, rows, cols, row, col)
+		for name, edge := range map[string]string{"xmin": bt.XMin, "ymin": bt.YMin, "xmax": bt.XMax, "ymax": bt.YMax} {
+			values.Set(name, edge)
+		}
+	}
+	tr := r.Clone(r.Context())
+	tr.URL.RawQuery = values.Encode()
+	renderers[typ](w, tr)
+}
+
+// healthz answers liveness probes.  It always succeeds once the server is up.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// readyz answers readiness probes by rendering a tiny (8x8) Newton image, which exercises the
+// rendering and encoding path without the cost of a full-size render.  It responds 503 if the
+// render panics.
+func readyz(w http.ResponseWriter, r *http.Request) {
+	params := engine.DefaultRenderParams()
+	params.Size = 8
+	if err := probeRender(params); err != nil {
+		log.Println("Readiness check failed:", err)
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// probeRender renders a Newton image for params, discarding it, and returns an error if the
+// render panics.
+func probeRender(params engine.RenderParams) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("render panicked: %v", p)
+		}
+	}()
+	engine.Newton(1, params, io.Discard)
+	return nil
 }
 
 // Creates a PNG image showing eventual behavior of Newton's method IFS
 // seeking 4th roots of unity.  Points in the complex plane are colored according
 // to eventual behavior when they are taken as initial guesses.
+// The aa request parameter sets the supersampling factor and the degree request parameter
+// sets the degree n of the polynomial z^n - 1 (default 4), and contrast how quickly the colors darken
+// as convergence slows (default 2000).  The colors request parameter replaces the basin colors
+// with a comma-separated list of hex colors, repeated if there are fewer than roots.
+// The nonconv request parameter colors the points that do not converge: black (the default),
+// gray, or ramp for colors from the palette named by the palette request parameter.
+// The image is rendered concurrently
+// by numworkers goroutines.
 func newton(w http.ResponseWriter, r *http.Request) {
-	engine.Newton(w)
+	q := engine.NewQuery(r.URL.Query())
+	params := engine.DefaultRenderParams()
+	imageParams(q, &params, engine.DefaultView)
+	params.MaxIter = q.Int("maxiter", engine.DefaultMaxIter, 1, iterLimit)
+	newtonPolyParams(q, &params)
+	params.Relax = q.Float("a", 1, math.SmallestNonzeroFloat64, math.MaxFloat64)
+	params.Tol = q.Float("tol", engine.DefaultTol, math.SmallestNonzeroFloat64, 0.5)
+	basinParams(q, &params, engine.DefaultContrast)
+	params.NonConv = q.String("nonconv", engine.NonConvBlack, engine.ValidNonConv)
+	params.Palette = q.String("palette", engine.DefaultPalette, func(name string) bool {
+		_, found := engine.LookupPalette(name)
+		return found
+	})
+	params.ColorSeed = q.Int("colorseed", 0, math.MinInt, math.MaxInt)
+	nWorkers := workersParam(q)
+	if !checkQuery(w, q) {
+		return
+	}
+	logParams(r, "params", params, "numworkers", nWorkers)
+	if isInfo(r) {
+		writeInfo(w, r, engine.DefaultView, renderInfo{Params: params})
+		return
+	}
+	setFormatHeaders(w, params, "newton")
+	setParamHeaders(w, params)
+	serveImage(w, r, engine.CacheKey("newton", params), func(w io.Writer) {
+		engine.Newton(nWorkers, params, w)
+	})
 }
 
-// Creates a PNG image of a single Julia set for the process z->z^2 + c.
-// The c parameter is constructed from the re and im request parameters.
+// newtonPolyParams gets the polynomial whose roots newton seeks into params: z^degree - 1, or
+// the polynomial with the coefficients given by coeffs if it is present.
+func newtonPolyParams(q *engine.Query, params *engine.RenderParams) {
+	params.Degree = q.Int("degree", engine.DefaultDegree, 2, engine.MaxDegree)
+	if q.Has("coeffs") {
+		coeffs, err := coeffsParam(q)
+		if err != nil {
+			q.Invalid("coeffs", "coeffs invalid: %v", err)
+		} else {
+			params.Coeffs = coeffs
+		}
+	}
+}
+
+// newtonRoots returns as JSON the roots whose basins newton colors for the degree, coeffs and
+// colors request parameters, as engine.NewtonRoots finds them, with the color of each basin, so
+// that clients can label the basins and check how coeffs was read.
+func newtonRoots(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	params := engine.DefaultRenderParams()
+	newtonPolyParams(q, &params)
+	basinParams(q, &params, engine.DefaultContrast)
+	if !checkQuery(w, q) {
+		return
+	}
+	logParams(r, "params", params)
+	roots, colors := engine.NewtonRoots(params)
+	info := rootsInfo{Degree: len(roots), Coeffs: params.Coeffs, Roots: make([]rootInfo, len(roots))}
+	if len(params.Coeffs) == 0 {
+		info.Degree = params.Degree
+	}
+	for k, root := range roots {
+		info.Roots[k] = rootInfo{point{real(root), imag(root)}, engine.HexColor(colors[k])}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(info); err != nil {
+		log.Println("Error writing roots:", err)
+	}
+}
+
+// rootsInfo is the JSON form of the roots of a newton polynomial.  Coeffs is the polynomial as
+// read from the coeffs request parameter, leading zeros dropped, and is left out for z^degree - 1.
+type rootsInfo struct {
+	Degree int        `json:"degree"`
+	Coeffs []float64  `json:"coeffs,omitempty"`
+	Roots  []rootInfo `json:"roots"`
+}
+
+// rootInfo is the JSON form of one root of a newton polynomial and the color of its basin, as
+// rrggbb like the colors request parameter.
+type rootInfo struct {
+	point
+	Color string `json:"color"`
+}
+
+// nova creates a PNG image of the Nova fractal, in which each pixel c is colored by where the
+// process z -> z - R*(z^n - 1)/(n*z^(n-1)) + c started at z = 1 settles.  The R request parameter
+// sets the relaxation constant R (default 1) and degree the degree n (default 3); maxiter, tol,
+// contrast (default 300), colors and numworkers are as for newton, and z0re and z0im offset the
+// starting point.
+func nova(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	params := engine.DefaultRenderParams()
+	imageParams(q, &params, engine.NovaView)
+	params.MaxIter = q.Int("maxiter", engine.DefaultMaxIter, 1, iterLimit)
+	params.Degree = q.Int("degree", engine.DefaultNovaDegree, 2, engine.MaxDegree)
+	params.Relax = q.Float("R", 1, math.SmallestNonzeroFloat64, math.MaxFloat64)
+	params.Tol = q.Float("tol", engine.DefaultTol, math.SmallestNonzeroFloat64, 0.5)
+	params.Z0Re = q.Float("z0re", 0, -math.MaxFloat64, math.MaxFloat64)
+	params.Z0Im = q.Float("z0im", 0, -math.MaxFloat64, math.MaxFloat64)
+	basinParams(q, &params, engine.DefaultNovaContrast)
+	nWorkers := workersParam(q)
+	if !checkQuery(w, q) {
+		return
+	}
+	logParams(r, "params", params, "numworkers", nWorkers)
+	if isInfo(r) {
+		writeInfo(w, r, engine.NovaView, renderInfo{Params: params})
+		return
+	}
+	setFormatHeaders(w, params, "nova")
+	setParamHeaders(w, params)
+	serveImage(w, r, engine.CacheKey("nova", params), func(w io.Writer) {
+		engine.Nova(nWorkers, params, w)
+	})
+}
+
+// Creates a PNG image of a single Julia set for the process z->z^power + c.
+// The c parameter is constructed from the re and im request parameters and the
+// exponent from the power request parameter (default 2).  With autoframe=true, the window is
+// replaced by one fitted to the boundary of the set, found by a coarse pass over the window.
 func juliaSingle(w http.ResponseWriter, r *http.Request) {
-	const (
-		xmin, ymin, xmax, ymax = -2, -2, +2, +2
-		width, height          = 1024, 1024
-	)
+	q := engine.NewQuery(r.URL.Query())
+	c := cParam(q)
+	params, autoFrame := juliaSingleParams(q)
+	if !checkQuery(w, q) {
+		return
+	}
+	serveJuliaSingle(w, r, c, params, autoFrame, renderInfo{}, "julia")
+}
 
-	// Get c from request querystring
-	re, err := strconv.ParseFloat(r.URL.Query().Get("re"), 64)
-	if err != nil {
-		re = -1.25
-		log.Println("re missing or invalid - settting to -1.25")
+// juliaRandom creates a PNG image of the Julia set for a c value picked by engine.RandomJuliaC,
+// for a "surprise me" button.  The seed request parameter makes the choice reproducible; if it
+// is missing, a random seed is used, which the info response and the file name of the image
+// report.  The other request parameters are those of juliaSingle, other than re and im.
+func juliaRandom(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	seed := q.Int("seed", int(rand.Int63()), math.MinInt, math.MaxInt)
+	params, autoFrame := juliaSingleParams(q)
+	if !checkQuery(w, q) {
+		return
 	}
-	im, err := strconv.ParseFloat(r.URL.Query().Get("im"), 64)
-	if err != nil {
-		im = 0
-		log.Println("im missing or invalid - settting to 0")
+	logParams(r, "seed", seed)
+	c := engine.RandomJuliaC(int64(seed), params)
+	serveJuliaSingle(w, r, c, params, autoFrame, renderInfo{Seed: &seed}, "julia-"+strconv.Itoa(seed))
+}
+
+// juliaCompare creates a PNG image comparing the Julia sets for the c values given by the c1 and
+// c2 request parameters, written re,im, side by side or, with layout=vertical, one above the
+// other (see engine.JuliaCompare).  They default to 0.25, the cusp of the main cardioid of the
+// Mandelbrot set, and 0.26, just outside it.  divider sets the width of the divider between them.
+// The other request parameters are those of juliaSingle, other than the crop, and apply to both.
+func juliaCompare(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	cs := []complex128{q.Complex("c1", 0.25), q.Complex("c2", 0.26)}
+	layout := q.String("layout", engine.LayoutHorizontal, engine.ValidLayout)
+	divider := q.Int("divider", engine.DefaultDivider, 0, engine.MaxDivider)
+	params, _ := juliaSingleParams(q)
+	params.Crop = engine.PixelRect{}
+	if !checkQuery(w, q) {
+		return
 	}
-	engine.JuliaSingle(complex(re, im), w)
+	logParams(r, "params", params, "cs", cs, "layout", layout, "divider", divider)
+	setFormatHeaders(w, params, "compare")
+	setParamHeaders(w, params)
+	serveImage(w, r, engine.CacheKey("compare", params, cs, layout, divider), func(w io.Writer) {
+		engine.JuliaCompare(cs, params, layout, divider, w)
+	})
 }
 
+// juliaMontage creates a PNG contact sheet of thumbnails of the Julia sets for a rows x cols grid
+// of c values sampled across the window of the c-plane given by the cxmin, cymin, cxmax and cymax
+// request parameters, which defaults to the window of the Mandelbrot set (see engine.JuliaMontage).
+// size is the size of each thumbnail.  The other request parameters are those of juliaSingle,
+// other than the crop, and apply to every thumbnail.
+func juliaMontage(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	rows := q.Int("rows", engine.DefaultMontageCells, 1, engine.MaxMontageCells)
+	cols := q.Int("cols", engine.DefaultMontageCells, 1, engine.MaxMontageCells)
+	cView := cViewParam(q)
+	params, _ := juliaSingleParams(q)
+	params.Size = q.Int("size", engine.DefaultMontageSize, 16, engine.MaxMontageSize)
+	params.Crop = engine.PixelRect{}
+	if !checkQuery(w, q) {
+		return
+	}
+	logParams(r, "params", params, "rows", rows, "cols", cols, "cview", cView)
+	setFormatHeaders(w, params, "montage")
+	serveImage(w, r, engine.CacheKey("montage", params, cView, rows, cols), func(w io.Writer) {
+		engine.JuliaMontage(cView, rows, cols, params, w)
+	})
+}
+
+// cViewParam gets the window of the c-plane sampled by /montage from the cxmin, cymin, cxmax and
+// cymax request parameters, defaulting to engine.MandelbrotView.
+func cViewParam(q *engine.Query) engine.Viewport {
+	def := engine.MandelbrotView
+	edge := func(name string, def float64) float64 {
+		return q.Float(name, def, -math.MaxFloat64, math.MaxFloat64)
+	}
+	view := engine.Viewport{
+		XMin: edge("cxmin", def.XMin),
+		YMin: edge("cymin", def.YMin),
+		XMax: edge("cxmax", def.XMax),
+		YMax: edge("cymax", def.YMax),
+	}
+	if view.XMin >= view.XMax {
+		q.Invalid("cxmin", "cxmin must be less than cxmax")
+		return def
+	}
+	if view.YMin >= view.YMax {
+		q.Invalid("cymin", "cymin must be less than cymax")
+		return def
+	}
+	return view
+}
+
+// juliaData returns the escape values of the pixels of the image juliaSingle would render for
+// the same request parameters as JSON (see engine.JuliaData and escapeData), for analysis
+// outside the server.  size is capped at engine.MaxDataSize.
+func juliaData(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	c := cParam(q)
+	params, autoFrame := juliaSingleParams(q)
+	if !checkQuery(w, q) {
+		return
+	}
+	if params.Size > engine.MaxDataSize {
+		log.Println("size too large for data - settting to", engine.MaxDataSize)
+		params.Size = engine.MaxDataSize
+	}
+	if autoFrame {
+		params.View = engine.JuliaFrame(c, params)
+	}
+	logParams(r, "params", params, "c", c)
+	b := params.Bounds()
+	data := escapeData{
+		C:       newPoint(c),
+		View:    params.View,
+		Width:   b.Dx(),
+		Height:  b.Dy(),
+		MaxIter: params.MaxIter,
+		Smooth:  params.Smooth,
+		Values:  engine.JuliaData(c, params),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Println("Error writing data:", err)
+	}
+}
+
+// juliaDimension estimates the box-counting dimension of the Julia set for c (see
+// engine.JuliaDimension), for the same request parameters as juliaData, and returns the
+// estimate and the box counts it was fitted to as JSON.
+func juliaDimension(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	c := cParam(q)
+	params, _ := juliaSingleParams(q)
+	if !checkQuery(w, q) {
+		return
+	}
+	if params.Size > engine.MaxDataSize {
+		log.Println("size too large for data - settting to", engine.MaxDataSize)
+		params.Size = engine.MaxDataSize
+	}
+	logParams(r, "params", params, "c", c)
+	d := engine.JuliaDimension(c, params)
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(dimensionInfo{C: newPoint(c), View: params.View, Size: params.Size, MaxIter: params.MaxIter, Dimension: d}); err != nil {
+		log.Println("Error writing dimension:", err)
+	}
+}
+
+// juliaConnected reports as JSON whether the Julia set for c is connected, which it is exactly
+// when c is in the Mandelbrot set (see engine.JuliaConnected), and if not how many iterations the
+// critical orbit took to escape.  It recognizes re, im, maxiter, escape and power.
+func juliaConnected(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	c := cParam(q)
+	params := renderParams(q)
+	params.Power = powerParam(q, "power", 2)
+	if !checkQuery(w, q) {
+		return
+	}
+	logParams(r, "params", params, "c", c)
+	connected, escapeIter := engine.JuliaConnected(c, params)
+	w.Header().Set("Content-Type", "application/json")
+	info := connectedInfo{C: newPoint(c), Power: params.Power, MaxIter: params.MaxIter, Escape: params.Escape,
+		Connected: connected, EscapeIter: escapeIter}
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		log.Println("Error writing connectivity:", err)
+	}
+}
+
+// connectedInfo is the JSON form of the answer of juliaConnected.  EscapeIter is 0 if the Julia
+// set is connected.
+type connectedInfo struct {
+	C          *point  `json:"c"`
+	Power      float64 `json:"power"`
+	MaxIter    int     `json:"maxiter"`
+	Escape     float64 `json:"escape"`
+	Connected  bool    `json:"connected"`
+	EscapeIter int     `json:"escapeIter"`
+}
+
+// dimensionInfo is the JSON form of a box-counting dimension estimate and what it was computed for.
+type dimensionInfo struct {
+	C       *point          `json:"c"`
+	View    engine.Viewport `json:"view"`
+	Size    int             `json:"size"`
+	MaxIter int             `json:"maxiter"`
+	engine.Dimension
+}
+
+// escapeData is the JSON form of the escape values of the pixels of an image.  Values holds
+// Height rows of Width values, the first row at ymin and the first value of each row at xmin.
+type escapeData struct {
+	C       *point          `json:"c,omitempty"`
+	View    engine.Viewport `json:"view"`
+	Width   int             `json:"width"`
+	Height  int             `json:"height"`
+	MaxIter int             `json:"maxiter"`
+	Smooth  bool            `json:"smooth"`
+	Values  [][]float64     `json:"values"`
+}
+
+// juliaSingleParams gets the rendering parameters of a single Julia set, and whether to fit
+// the window to the set, from q.
+func juliaSingleParams(q *engine.Query) (engine.RenderParams, bool) {
+	params := renderParams(q)
+	imageParams(q, &params, engine.DefaultView)
+	params.Precision = precisionParam(q)
+	params.Power = powerParam(q, "power", 2)
+	orbitParams(q, &params)
+	return params, q.Bool("autoframe")
+}
+
+// orbitParams gets the orbit drawn over a Julia set from q: its start, orbitre + orbitim i
+// (default 0, the critical point), and the number of steps drawn, orbitsteps (default 0, none).
+func orbitParams(q *engine.Query, params *engine.RenderParams) {
+	params.OrbitRe = q.Float("orbitre", 0, -math.MaxFloat64, math.MaxFloat64)
+	params.OrbitIm = q.Float("orbitim", 0, -math.MaxFloat64, math.MaxFloat64)
+	params.OrbitSteps = q.Int("orbitsteps", 0, 0, engine.MaxOrbitSteps)
+}
 
-// julia creates an animated GIF with frames displaying Julia sets for the process
-//   z -> z^2 + c
+// serveJuliaSingle serves the image of the Julia set for c and params, or its info (completing
+// info) for an info request, fitting the window to the set first if autoFrame is set.  The
+// image is named name.
+func serveJuliaSingle(w http.ResponseWriter, r *http.Request, c complex128, params engine.RenderParams, autoFrame bool, info renderInfo, name string) {
+	if autoFrame {
+		params.View = engine.JuliaFrame(c, params)
+	}
+	logParams(r, "params", params, "c", c)
+	if isInfo(r) {
+		stats := engine.JuliaStats(c, params)
+		info.Params, info.C, info.Stats = params, newPoint(c), &stats
+		writeInfo(w, r, engine.DefaultView, info)
+		return
+	}
+	setFormatHeaders(w, params, name)
+	setParamHeaders(w, params, c)
+	serveImage(w, r, engine.CacheKey("juliaSingle", params, c), func(w io.Writer) {
+		engine.JuliaSingle(c, params, w)
+	})
+}
+
+// Creates a PNG image of the Mandelbrot set, or of the Multibrot set if power is not 2.
+// Recognizes the same rendering request parameters as juliaSingle, including autoframe, other
+// than re and im.
+func mandelbrot(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	params := renderParams(q)
+	imageParams(q, &params, engine.MandelbrotView)
+	params.Precision = precisionParam(q)
+	params.Power = powerParam(q, "power", 2)
+	autoFrame := q.Bool("autoframe")
+	if !checkQuery(w, q) {
+		return
+	}
+	if autoFrame {
+		params.View = engine.MandelbrotFrame(params)
+	}
+	logParams(r, "params", params)
+	if isInfo(r) {
+		stats := engine.MandelbrotStats(params)
+		writeInfo(w, r, engine.MandelbrotView, renderInfo{Params: params, Stats: &stats})
+		return
+	}
+	setFormatHeaders(w, params, "mandelbrot")
+	setParamHeaders(w, params)
+	serveImage(w, r, engine.CacheKey("mandelbrot", params), func(w io.Writer) {
+		engine.Mandelbrot(params, w)
+	})
+}
+
+// mandelbrotInset creates a PNG image of the Mandelbrot set with a thumbnail of the Julia set
+// for the c given by the re and im request parameters in a corner, and c marked on the set (see
+// engine.MandelbrotInset).  inset is the size of the thumbnail, up to half the size of the image
+// (default a quarter of it), and insetpos its corner (default top-right).  The other request
+// parameters are those of mandelbrot, other than autoframe and the crop, and apply to both.
+func mandelbrotInset(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	c := cParam(q)
+	params := renderParams(q)
+	imageParams(q, &params, engine.MandelbrotView)
+	params.Precision = precisionParam(q)
+	params.Power = powerParam(q, "power", 2)
+	params.Crop = engine.PixelRect{}
+	inset := q.Int("inset", max(engine.MinInsetSize, params.Size/engine.DefaultInsetFraction),
+		engine.MinInsetSize, max(engine.MinInsetSize, params.Size/2))
+	corner := q.String("insetpos", engine.LabelTopRight, engine.ValidLabelPos)
+	if !checkQuery(w, q) {
+		return
+	}
+	logParams(r, "params", params, "c", c, "inset", inset, "insetpos", corner)
+	setFormatHeaders(w, params, "mandelbrot-inset")
+	setParamHeaders(w, params, c)
+	serveImage(w, r, engine.CacheKey("mandelbrotInset", params, c, inset, corner), func(w io.Writer) {
+		engine.MandelbrotInset(c, params, inset, corner, w)
+	})
+}
+
+// Creates a PNG image of the Burning Ship fractal.  Recognizes the same rendering request
+// parameters as mandelbrot, other than power and map.  With julia=true, renders the Julia set of the Burning Ship
+// process for the c value given by the re and im request parameters instead.
+func burningShip(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	params := mapRenderParams(q, engine.MapSquare) // the Burning Ship has its own map
+	imageParams(q, &params, engine.BurningShipView)
+	julia := q.Bool("julia")
+	var c complex128
+	if julia {
+		c = cParam(q)
+		orbitParams(q, &params)
+	}
+	autoFrame := q.Bool("autoframe")
+	if !checkQuery(w, q) {
+		return
+	}
+	if autoFrame && julia {
+		params.View = engine.BurningShipJuliaFrame(c, params)
+	} else if autoFrame {
+		params.View = engine.BurningShipFrame(params)
+	}
+	logParams(r, "params", params)
+	if julia {
+		logParams(r, "c", c)
+	}
+	if isInfo(r) {
+		info := renderInfo{Params: params}
+		var stats engine.Stats
+		if julia {
+			info.C = newPoint(c)
+			stats = engine.BurningShipJuliaStats(c, params)
+		} else {
+			stats = engine.BurningShipStats(params)
+		}
+		info.Stats = &stats
+		writeInfo(w, r, engine.BurningShipView, info)
+		return
+	}
+	setFormatHeaders(w, params, "burningship")
+	if julia {
+		setParamHeaders(w, params, c)
+		serveImage(w, r, engine.CacheKey("burningshipJulia", params, c), func(w io.Writer) {
+			engine.BurningShipJulia(c, params, w)
+		})
+		return
+	}
+	setParamHeaders(w, params)
+	serveImage(w, r, engine.CacheKey("burningship", params), func(w io.Writer) {
+		engine.BurningShip(params, w)
+	})
+}
+
+// Default width and height, in pixels, of the /palette preview
+const (
+	defaultStripWidth  = 512
+	defaultStripHeight = 32
+)
+
+// paletteStrip serves a PNG preview of the palette named by the name request parameter (default
+// engine.DefaultPalette): a horizontal gradient width pixels wide (default 512) and height pixels
+// high (default 32).  Unknown palette names get a 404 listing the known ones.
+func paletteStrip(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	params := engine.DefaultRenderParams()
+	params.Palette = q.String("name", engine.DefaultPalette, func(string) bool { return true })
+	params.ColorSeed = q.Int("colorseed", 0, math.MinInt, math.MaxInt)
+	if _, ok := engine.LookupPalette(params.Palette); !ok {
+		http.Error(w, "unknown palette "+strconv.Quote(params.Palette)+"; palettes are "+
+			strings.Join(engine.PaletteNames(), ", "), http.StatusNotFound)
+		return
+	}
+	width := q.Int("width", defaultStripWidth, 1, sizeLimit)
+	height := q.Int("height", defaultStripHeight, 1, sizeLimit)
+	if !checkQuery(w, q) {
+		return
+	}
+	logParams(r, "name", params.Palette, "width", width, "height", height)
+	setFormatHeaders(w, params, "palette")
+	serveImage(w, r, engine.CacheKey("palette", params, [2]int{width, height}), func(w io.Writer) {
+		engine.PaletteStrip(width, height, params, w)
+	})
+}
+
+// affine creates a PNG image of the attractor of an affine iterated function system, drawn
+// with the chaos game.  The preset request parameter names the system (see engine.PresetNames,
+// default fern), iterations the number of points plotted and color whether pixels are colored
+// by how often or how recently they were hit (engine.ChaosDensity or engine.ChaosRecency).
+// The view defaults to one framing the attractor; size, format, quality and palette are as for
+// the other still images.
+func affine(w http.ResponseWriter, r *http.Request) {
+	q := engine.NewQuery(r.URL.Query())
+	name := q.String("preset", engine.DefaultPreset, func(name string) bool {
+		_, found := engine.LookupPreset(name)
+		return found
+	})
+	ifs, _ := engine.LookupPreset(name)
+	iterations := q.Int("iterations", engine.DefaultIFSIterations, 1, engine.MaxIFSIterations)
+	params := engine.DefaultRenderParams()
+	params.Palette = q.String("palette", engine.DefaultPalette, func(name string) bool {
+		_, found := engine.LookupPalette(name)
+		return found
+	})
+	params.ColorSeed = q.Int("colorseed", 0, math.MinInt, math.MaxInt)
+	params.Color = q.String("color", engine.ChaosDensity, engine.ValidChaosColor)
+	imageParams(q, &params, ifs.View)
+	if !checkQuery(w, q) {
+		return
+	}
+	logParams(r, "params", params, "preset", name, "iterations", iterations)
+	if isInfo(r) {
+		writeInfo(w, r, ifs.View, renderInfo{Params: params, Preset: name, Iters: iterations})
+		return
+	}
+	setFormatHeaders(w, params, name)
+	serveImage(w, r, engine.CacheKey("ifs", params, name, iterations), func(w io.Writer) {
+		engine.ChaosGame(ifs, iterations, params, w)
+	})
+}
+
+// julia creates an animated GIF (or PNG) with frames displaying Julia sets for the process
+//
+//	z -> z^power + c
+//
 // Each frame shows the Julia set for a different c value.  The progression of c values
 // is determined by the parampath request paramter.  The recognized parampath values are:
-//  Exp:     The c values are of the form .7885 e^ia where a ranges from 0 to 2pi.
-//           As a goes from 0 to 2pi, c goes in and out of the Mandelbrot set.
-//           This parameterization is borrowed from one of the examples in
-//           https://en.wikipedia.org/wiki/Julia_set
-//  Angor:   The c values range from -1.45 to 1.25 along the real axis
-//  Wabbit:  The c values vary linearly about  .3887 - .2158i with both parameters
-//           moving from .03 below to .03 above these values.
+//
+//	Exp:     The c values are of the form .7885 e^ia where a ranges from 0 to 2pi.
+//	         As a goes from 0 to 2pi, c goes in and out of the Mandelbrot set.
+//	         This parameterization is borrowed from one of the examples in
+//	         https://en.wikipedia.org/wiki/Julia_set
+//	Angor:   The c values range from -1.45 to 1.25 along the real axis
+//	Wabbit:  The c values vary linearly about  .3887 - .2158i with both parameters
+//	         moving from .03 below to .03 above these values.
+//	Line:    The c values move along the straight line from cstart to cend, given as "re,im".
+//	Spiral:  c winds outward along a logarithmic spiral from radius .3 to 1, making turns
+//	         turns about the origin and crossing in and out of the Mandelbrot set.
+//	Power:   c stays fixed at cstart while the exponent moves from power to maxpower.
+//	         Non-integer exponents use the principal branch of z^power, so those frames
+//	         show a seam along the negative real axis.
+//
+// A POST request can instead give the c value of every frame in its body, as a JSON array of
+// {"re": ..., "im": ...} objects; there is then one frame per value and numframes and parampath
+// are ignored.
 //
 // Frames are generated concurrently by goroutines.
 // The other request parameters are
-//  numworkers:  the number of goroutines to exexute
-//  numframes:   the number of frames in the animation
 //
+//	numworkers:  the number of goroutines to exexute
+//	numframes:   the number of frames in the animation
+//	maxiter:     the maximum number of iterations per pixel
+//	escape:      the escape radius (at least 2)
+//	smooth:      true to use continuous rather than banded coloring
+//	palette:     name of the color palette (default, fire, ice or grayscale)
+//	color:       coloring mode, escape (by escape count), trap (by orbit trap distance),
+//	             distance (by estimated distance to the boundary), period (interior points
+//	             by the period of the cycle their orbit settles on) or maxmod (by the largest
+//	             modulus the orbit reaches)
+//	trap:        orbit trap shape for color=trap, point (the origin) or cross (the axes)
+//	delay:       the delay between frames in 100ths of a second
+//	loop:        the number of times the animation loops (0 = forever)
+//	boomerang:   true to play the frames forward and then backward
+//	power:       the exponent of z (default 2)
+//	maxpower:    the exponent at the last frame of the Power path (default 5)
+//	turns:       the number of turns of the Spiral path (default 3)
+//	zoomfactor:  the magnification from one frame of the Zoom path to the next (default 1.1);
+//	             the Zoom path holds c at cstart and dives into the center of the window
+//	mandelbrot:  true to show the Mandelbrot set in every frame instead of a Julia set
+//	format:      gif (the default) or apng for an animated PNG with full-color frames
+//	gifpalette:  the palette GIF frames are dithered to: plan9 (the default, a fixed palette),
+//	             adaptive (fitted to each frame by median cut), ramp (samples of palette) or
+//	             global (fitted to a sample of frames and shared by all of them)
+//	mono:        true for grayscale frames
+//	invert:      true to invert the colors of the frames
+//	grid:        true to draw the axes and a coordinate grid over the frames
+//	autoframe:   true to replace the window by one fitted to the boundaries of a sample of frames
+//	progress:    an id under which /julia/progress reports the progress of the render
 func julia(w http.ResponseWriter, r *http.Request) {
 
 	// "Set" of the valid parameter paths
@@ -83,24 +889,600 @@ func julia(w http.ResponseWriter, r *http.Request) {
 		"Angor":  true,
 		"Exp":    true,
 		"Wabbit": true,
+		"Line":   true,
+		"Power":  true,
+		"Spiral": true,
+		"Zoom":   true,
 	}
 
 	// Get parameters from request querystring
-	paramPath := r.URL.Query().Get("paramPath")
-	if !paramPaths[paramPath] {
-		paramPath = "Exp"
-		log.Println("parampath missing or invalid - settting to default")
+	q := engine.NewQuery(r.URL.Query())
+	var cs []complex128
+	if r.Method == http.MethodPost {
+		cs = cBodyParam(w, r, q)
+	}
+	nFrames := q.Int("numframes", 64, 1, engine.MaxFrames)
+	if len(cs) > 0 {
+		nFrames = len(cs)
+	}
+	animParams := engine.AnimParams{
+		Frames:  nFrames,
+		Workers: workersParam(q),
+		Path: q.String("paramPath", "Exp", func(path string) bool {
+			return paramPaths[path]
+		}),
+		CStart:   q.Complex("cstart", complex(-1.25, 0)),
+		CEnd:     q.Complex("cend", complex(0.25, 0)),
+		MaxPower: powerParam(q, "maxpower", engine.DefaultMaxPower),
+		Turns:    q.Float("turns", engine.DefaultTurns, math.SmallestNonzeroFloat64, engine.MaxTurns),
+		Delay:    q.Int("delay", engine.DefaultDelay, 1, math.MaxInt),
+		Loop:     q.Int("loop", nFrames, 0, math.MaxInt),
+
+		Boomerang: q.Bool("boomerang"),
+		Format: q.String("format", engine.AnimGIF, func(format string) bool {
+			_, ok := engine.AnimContentType(format)
+			return ok
+		}),
+		GIFPalette: q.String("gifpalette", engine.GIFPlan9, engine.ValidGIFPalette),
+		ZoomFactor: q.Float("zoomfactor", engine.DefaultZoomFactor, math.SmallestNonzeroFloat64, engine.MaxZoomFactor),
+		Mandelbrot: q.Bool("mandelbrot"),
+		Cs:         cs,
+	}
+	if len(cs) > 0 {
+		animParams.Path = "" // the c values replace the parameter path
+	}
+
+	def, name := engine.DefaultView, "julia"
+	if animParams.Mandelbrot {
+		def, name = engine.MandelbrotView, "mandelbrot"
+	}
+	params := renderParams(q)
+	params.Size = q.Int("size", engine.DefaultSize, 1, sizeLimit)
+	params.View = viewParam(q, def, params.Size, params.Size)
+	params.Power = powerParam(q, "power", 2)
+	params.Mono = q.Bool("mono")
+	params.Invert = q.Bool("invert")
+	params.Grid = q.Bool("grid")
+	params.Marks = marksParam(q)
+	params.Transform = q.String("transform", engine.TransformNone, engine.ValidTransform)
+	autoFrame := q.Bool("autoframe")
+	progressID := q.String("progress", "", func(id string) bool { return len(id) <= maxProgressID })
+	if !checkQuery(w, q) {
+		return
+	}
+	if autoFrame {
+		params.View = engine.AnimationFrame(animParams, params)
+	}
+	logParams(r, "params", params, "animation", animParams)
+	if isInfo(r) {
+		writeInfo(w, r, def, renderInfo{Params: params, Animation: &animationInfo{
+			Frames:    animParams.Frames,
+			Path:      animParams.Path,
+			CStart:    *newPoint(animParams.CStart),
+			CEnd:      *newPoint(animParams.CEnd),
+			MaxPower:  animParams.MaxPower,
+			Turns:     animParams.Turns,
+			Zoom:      animParams.ZoomFactor,
+			Delay:     animParams.Delay,
+			Loop:      animParams.Loop,
+			Boomerang: animParams.Boomerang,
+			Format:    animParams.Format,
+			Palette:   animParams.GIFPalette,
+			Mandel:    animParams.Mandelbrot,
+			CValues:   points(animParams.Cs),
+		}})
+		return
+	}
+
+	contentType, _ := engine.AnimContentType(animParams.Format)
+	if animParams.Format == engine.AnimAPNG {
+		setImageHeaders(w, contentType, name+".png")
+	} else {
+		setImageHeaders(w, contentType, name+".gif")
+	}
+	setParamHeaders(w, params)
+	key := animParams
+	key.Workers = 0 // the number of workers does not affect the animation
+	if notModified(w, r, engine.CacheKey("julia", params, key)) {
+		return
+	}
+	timeRender(w, r, func() {
+		out, done := followProgress(w, progressID, animParams.Frames)
+		defer done()
+		engine.Julia(r.Context(), animParams, params, out)
+	})
+}
+
+// renderInfo is the JSON description of a render served by the /info endpoints: the parameters
+// it resolves to after defaults and clamping, the center and zoom of its window with links for
+// zooming in further and, for escape-time still images, its Stats.
+type renderInfo struct {
+	Endpoint  string              `json:"endpoint"`
+	Width     int                 `json:"width"`
+	Height    int                 `json:"height"`
+	Params    engine.RenderParams `json:"params"`
+	C         *point              `json:"c,omitempty"`
+	Seed      *int                `json:"seed,omitempty"`
+	Center    *point              `json:"center"`
+	Zoom      float64             `json:"zoom"`
+	ZoomLinks *zoomLinks          `json:"zoomLinks"`
+	Preset    string              `json:"preset,omitempty"`
+	Iters     int                 `json:"iterations,omitempty"`
+	Animation *animationInfo      `json:"animation,omitempty"`
+	Stats     *engine.Stats       `json:"stats,omitempty"`
+}
+
+// point is the JSON form of a complex number.
+type point struct {
+	Re float64 `json:"re"`
+	Im float64 `json:"im"`
+}
+
+// newPoint returns the JSON form of z.
+func newPoint(z complex128) *point {
+	return &point{real(z), imag(z)}
+}
+
+// animationInfo is the JSON form of the engine.AnimParams of a Julia animation.
+type animationInfo struct {
+	Frames    int     `json:"numframes"`
+	Path      string  `json:"paramPath"`
+	CStart    point   `json:"cstart"`
+	CEnd      point   `json:"cend"`
+	MaxPower  float64 `json:"maxpower"`
+	Turns     float64 `json:"turns"`
+	Zoom      float64 `json:"zoomfactor"`
+	Delay     int     `json:"delay"`
+	Loop      int     `json:"loop"`
+	Boomerang bool    `json:"boomerang"`
+	Format    string  `json:"format"`
+	Palette   string  `json:"gifpalette"`
+	Mandel    bool    `json:"mandelbrot"`
+	CValues   []point `json:"cvalues,omitempty"`
+}
+
+// points returns the JSON forms of zs.
+func points(zs []complex128) []point {
+	var ps []point
+	for _, z := range zs {
+		ps = append(ps, *newPoint(z))
+	}
+	return ps
+}
+
+// isInfo reports whether r asks for the JSON description of a render rather than the image.
+func isInfo(r *http.Request) bool {
+	return strings.HasSuffix(r.URL.Path, "/info")
+}
+
+// writeInfo fills in the endpoint, dimensions and zoom of info and writes it to w as JSON.
+// def is the default window of the endpoint, relative to which the zoom is measured.
+func writeInfo(w http.ResponseWriter, r *http.Request, def engine.Viewport, info renderInfo) {
+	info.Endpoint = strings.TrimSuffix(r.URL.Path, "/info")
+	b := info.Params.Bounds()
+	info.Width, info.Height = b.Dx(), b.Dy()
+	view := info.Params.View
+	info.Center = newPoint(view.Center())
+	info.Zoom = view.Zoom(def)
+	q := view.Quadrants()
+	info.ZoomLinks = &zoomLinks{
+		Center:      zoomURL(r, view.Center(), 2*info.Zoom),
+		TopLeft:     zoomURL(r, q[0], 2*info.Zoom),
+		TopRight:    zoomURL(r, q[1], 2*info.Zoom),
+		BottomLeft:  zoomURL(r, q[2], 2*info.Zoom),
+		BottomRight: zoomURL(r, q[3], 2*info.Zoom),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false) // keep the & in zoom links readable
+	if err := enc.Encode(info); err != nil {
+		log.Println("Error writing info:", err)
+	}
+}
+
+// zoomLinks are the URLs of the image described by an info response zoomed in 2x, centered on
+// the center of the image and on the centers of its quarters.  Top is the first row of pixels,
+// at ymin.
+type zoomLinks struct {
+	Center      string `json:"center"`
+	TopLeft     string `json:"topLeft"`
+	TopRight    string `json:"topRight"`
+	BottomLeft  string `json:"bottomLeft"`
+	BottomRight string `json:"bottomRight"`
+}
+
+// zoomURL returns the URL of the image requested by r (or described, for an info request)
+// with its window replaced by the one at center and zoom, uncropped.
+func zoomURL(r *http.Request, center complex128, zoom float64) string {
+	values := r.URL.Query()
+	for _, name := range []string{"xmin", "ymin", "xmax", "ymax", "autoframe", "px0", "py0", "px1", "py1"} {
+		values.Del(name)
+	}
+	format := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	values.Set("centerre", format(real(center)))
+	values.Set("centerim", format(imag(center)))
+	values.Set("zoom", format(zoom))
+	return strings.TrimSuffix(r.URL.Path, "/info") + "?" + values.Encode()
+}
+
+// checkQuery reports whether q is free of problems.  If it is not, it sends a 400 response
+// listing them: as plain text, one per line, or in strict mode as JSON naming the parameters.
+func checkQuery(w http.ResponseWriter, q *engine.Query) bool {
+	err := q.Err()
+	if err == nil {
+		return true
+	}
+	if q.Strict() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(struct {
+			Errors []engine.ParamError `json:"errors"`
+		}{q.Problems()})
+		return false
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+	return false
+}
+
+// cParam gets the c parameter of a Julia set from the re and im request parameters.
+// Missing or invalid values are replaced by the default, -1.25 + 0i.
+func cParam(q *engine.Query) complex128 {
+	re := q.Float("re", -1.25, -math.MaxFloat64, math.MaxFloat64)
+	im := q.Float("im", 0, -math.MaxFloat64, math.MaxFloat64)
+	return complex(re, im)
+}
+
+// serveImage writes the image with the given cache key to w, along with its ETag.
+// If the request already holds the image (its If-None-Match matches the ETag), a 304 response is
+// sent without rendering.  Otherwise the image is served from imageCache if present, or rendered
+// by calling render and added to the cache, in which case X-IFS-Render-Ms gives the milliseconds
+// the render (and encoding) took.
+func serveImage(w http.ResponseWriter, r *http.Request, key string, render func(w io.Writer)) {
+	if notModified(w, r, key) {
+		return
+	}
+	data, ok := imageCache.Get(key)
+	if !ok {
+		buf := &imageBuffer{log: requestLogOf(r)}
+		var took time.Duration
+		if !timeRender(w, r, func() {
+			start := time.Now()
+			render(buf)
+			took = time.Since(start)
+		}) {
+			return
+		}
+		w.Header().Set("X-IFS-Render-Ms", strconv.FormatInt(took.Milliseconds(), 10))
+		data = buf.Bytes()
+		imageCache.Add(key, data)
+	}
+	w.Write(data)
+}
+
+// notModified sets the ETag for the response with the given cache key and reports whether the
+// request's If-None-Match header matches it, in which case a 304 Not Modified response is sent.
+func notModified(w http.ResponseWriter, r *http.Request, key string) bool {
+	etag := engine.ETag(key)
+	w.Header().Set("ETag", etag)
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// renderParams gets the request parameters shared by the escape-time renderers.  The escape
+// radius defaults to that of the map selected by map (see engine.MapEscape).
+// maxiter is clamped to iterLimit and escape to engine.MaxEscape.  An escape radius below 2 breaks the
+// escape criterion, so an explicit escape value < 2 is recorded as a problem with q.
+func renderParams(q *engine.Query) engine.RenderParams {
+	return mapRenderParams(q, q.String("map", engine.MapSquare, engine.ValidMap))
+}
+
+// mapRenderParams is renderParams for the map named mapName, whatever the map request parameter
+// says, for renderers with a map of their own.
+func mapRenderParams(q *engine.Query, mapName string) engine.RenderParams {
+	params := engine.DefaultRenderParams()
+	params.MaxIter = q.Int("maxiter", engine.DefaultMaxIter, 1, iterLimit)
+	params.Map = mapName
+	params.Escape = q.Float("escape", engine.MapEscape(params.Map), -math.MaxFloat64, engine.MaxEscape)
+	if params.Escape < 2 {
+		q.FailParam("escape", "escape must be at least 2")
+	}
+	params.Smooth = q.Bool("smooth")
+	params.Transparent = q.Bool("transparent")
+	params.CycleCheck = q.Bool("cyclecheck")
+	params.Palette = q.String("palette", engine.DefaultPalette, func(name string) bool {
+		_, found := engine.LookupPalette(name)
+		return found
+	})
+	params.ColorSeed = q.Int("colorseed", 0, math.MinInt, math.MaxInt)
+	params.Color = q.String("color", engine.ColorEscape, engine.ValidColorMode)
+	params.Trap = q.String("trap", engine.TrapPoint, func(trap string) bool {
+		return trap == engine.TrapPoint || trap == engine.TrapCross
+	})
+	params.Z0Re = q.Float("z0re", 0, -math.MaxFloat64, math.MaxFloat64)
+	params.Z0Im = q.Float("z0im", 0, -math.MaxFloat64, math.MaxFloat64)
+	params.Dither = q.String("dither", engine.DitherNone, engine.ValidDither)
+	return params
+}
+
+// imageParams gets the request parameters that describe a still image into params: the window
+// (with default def), size, supersampling factor and filter, format, JPEG quality, PNG compression level,
+// the grayscale and inversion flags, the thumbnail size, the grid flag, the marked points and the
+// caption settings.
+func imageParams(q *engine.Query, params *engine.RenderParams, def engine.Viewport) {
+	params.Size = q.Int("size", engine.DefaultSize, 1, sizeLimit)
+	params.View, params.BigView = bigViewParam(q, def, params.Size, params.Size)
+	params.Crop = cropParam(q, params.Size)
+	params.AA = q.Int("aa", 1, 1, engine.MaxAA)
+	params.DownFilter = q.String("downfilter", engine.DownFilterBox, engine.ValidDownFilter)
+	if q.Get("format") == engine.FormatWebP {
+		q.FailParam("format", "format webp is not supported, since there is no WebP encoder for Go; use png or jpeg")
+	} else {
+		params.Format = q.String("format", engine.DefaultFormat, func(format string) bool {
+			_, ok := engine.ContentType(format)
+			return ok
+		})
+	}
+	params.Quality = q.Int("quality", params.Quality, 1, 100)
+	params.PNGCompress = q.String("pngcompress", engine.PNGDefault, engine.ValidPNGCompress)
+	params.Mono = q.Bool("mono")
+	params.Invert = q.Bool("invert")
+	params.Thumb = q.Int("thumb", 0, 1, sizeLimit)
+	if params.Thumb > 0 {
+		// A thumbnail is made from the whole image, rendered no larger than averaging needs.
+		params.Size = min(params.Size, params.Thumb*engine.MaxThumbScale)
+		params.Crop = engine.PixelRect{}
+	}
+	params.Grid = q.Bool("grid")
+	params.Marks = marksParam(q)
+	params.Label = q.Bool("label")
+	params.LabelPos = q.String("labelpos", engine.LabelBottomLeft, engine.ValidLabelPos)
+	params.Transform = q.String("transform", engine.TransformNone, engine.ValidTransform)
+}
+
+// setFormatHeaders sets the Content-Type for the format of params and a Content-Disposition
+// filename made from name and the format on w.
+func setFormatHeaders(w http.ResponseWriter, params engine.RenderParams, name string) {
+	contentType, _ := engine.ContentType(params.Format)
+	setImageHeaders(w, contentType, name+"."+params.Format)
+}
+
+// setParamHeaders describes the image of a response by the parameters it was rendered with, so
+// that clients need not ask /info: X-IFS-Viewport gives its window as
+// xmin=...,xmax=...,ymin=...,ymax=..., X-IFS-Size its size and X-IFS-MaxIter its iteration cap,
+// and X-IFS-C, if c is given, the parameter c of its Julia set as re,im.
+func setParamHeaders(w http.ResponseWriter, params engine.RenderParams, c ...complex128) {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	v := params.View
+	h := w.Header()
+	h.Set("X-IFS-Viewport", fmt.Sprintf("xmin=%s,xmax=%s,ymin=%s,ymax=%s", f(v.XMin), f(v.XMax), f(v.YMin), f(v.YMax)))
+	h.Set("X-IFS-Size", strconv.Itoa(params.Size))
+	h.Set("X-IFS-MaxIter", strconv.Itoa(params.MaxIter))
+	if len(c) > 0 {
+		h.Set("X-IFS-C", f(real(c[0]))+","+f(imag(c[0])))
+	}
+}
+
+// setImageHeaders sets the Content-Type of an image response and a Content-Disposition
+// suggesting filename as the name to save it under.
+func setImageHeaders(w http.ResponseWriter, contentType string, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+}
+
+// viewParam gets the window in the complex plane of a width x height pixel image.  It is given
+// either by the centerre, centerim and zoom request parameters, if any of them is present, or
+// by the xmin, ymin, xmax and ymax request parameters.  The center defaults to the center of def
+// and zoom, which must be positive, to 1, at which the shorter side of the image spans as much
+// as the shorter side of def; the longer side spans more in proportion (see engine.CenterView).
+// Missing edges take their values from def, and if the edges given do not describe a window
+// (e.g. xmin >= xmax), def is used instead.
+func viewParam(q *engine.Query, def engine.Viewport, width, height int) engine.Viewport {
+	view, _ := bigViewParam(q, def, width, height)
+	return view
+}
+
+// bigViewParam is viewParam for deep zooms.  It reads the window parameters as big.Float
+// numbers of engine.MaxPrecision bits and finds the edges of the window in big.Float arithmetic,
+// returning them, as decimal strings, along with their float64 approximations if those are not
+// exact.  Only the spans of a window given by its center and zoom are float64, which holds them
+// to about 16 digits however deep the zoom.  The edges need only differ at that precision, so the
+// float64 window may be empty.
+func bigViewParam(q *engine.Query, def engine.Viewport, width, height int) (engine.Viewport, engine.BigViewport) {
+	var xmin, ymin, xmax, ymax *big.Float
+	if q.Has("centerre") || q.Has("centerim") || q.Has("zoom") {
+		x := bigParam(q, "centerre", real(def.Center()))
+		y := bigParam(q, "centerim", imag(def.Center()))
+		zoom := q.Float("zoom", 1, math.SmallestNonzeroFloat64, math.MaxFloat64)
+		spans := engine.CenterView(0, zoom, def.Span(), width, height)
+		xmin, ymin = bigAdd(x, spans.XMin), bigAdd(y, spans.YMin)
+		xmax, ymax = bigAdd(x, spans.XMax), bigAdd(y, spans.YMax)
+	} else {
+		xmin, ymin = bigParam(q, "xmin", def.XMin), bigParam(q, "ymin", def.YMin)
+		xmax, ymax = bigParam(q, "xmax", def.XMax), bigParam(q, "ymax", def.YMax)
+		if xmin.Cmp(xmax) >= 0 {
+			q.Invalid("xmin", "xmin must be less than xmax")
+			return def, engine.BigViewport{}
+		}
+		if ymin.Cmp(ymax) >= 0 {
+			q.Invalid("ymin", "ymin must be less than ymax")
+			return def, engine.BigViewport{}
+		}
+	}
+
+	var view engine.Viewport
+	exact := true
+	for _, e := range []struct {
+		edge *big.Float
+		f    *float64
+	}{{xmin, &view.XMin}, {ymin, &view.YMin}, {xmax, &view.XMax}, {ymax, &view.YMax}} {
+		var acc big.Accuracy
+		*e.f, acc = e.edge.Float64()
+		exact = exact && acc == big.Exact
+	}
+	if exact {
+		return view, engine.BigViewport{}
+	}
+	text := func(f *big.Float) string { return f.Text('g', -1) }
+	return view, engine.BigViewport{XMin: text(xmin), YMin: text(ymin), XMax: text(xmax), YMax: text(ymax)}
+}
+
+// bigParam returns the parameter called name as a big.Float of engine.MaxPrecision bits, or def
+// if it is missing or malformed, as q.Float would.
+func bigParam(q *engine.Query, name string, def float64) *big.Float {
+	v := q.Float(name, def, -math.MaxFloat64, math.MaxFloat64) // reports the malformed ones
+	f := new(big.Float).SetPrec(engine.MaxPrecision)
+	if _, ok := f.SetString(q.Get(name)); ok {
+		if g, _ := f.Float64(); g == v {
+			return f
+		}
+	}
+	return f.SetFloat64(v)
+}
+
+// bigAdd returns x + d at the precision of x.
+func bigAdd(x *big.Float, d float64) *big.Float {
+	return new(big.Float).SetPrec(x.Prec()).Add(x, big.NewFloat(d))
+}
+
+// cropParam gets the rectangle of pixels of a size x size image to render from the px0, py0, px1
+// and py1 request parameters, which are clamped to the image.  px0 and py0 default to 0 and px1
+// and py1 to size.  If none is present, or the rectangle is empty, the whole image is rendered.
+func cropParam(q *engine.Query, size int) engine.PixelRect {
+	if !q.Has("px0") && !q.Has("py0") && !q.Has("px1") && !q.Has("py1") {
+		return engine.PixelRect{}
+	}
+	crop := engine.PixelRect{
+		X0: q.Int("px0", 0, 0, size-1),
+		Y0: q.Int("py0", 0, 0, size-1),
+		X1: q.Int("px1", size, 1, size),
+		Y1: q.Int("py1", size, 1, size),
+	}
+	if crop.X0 >= crop.X1 {
+		q.Invalid("px0", "px0 must be less than px1")
+		return engine.PixelRect{}
 	}
-	nFrames, err := strconv.Atoi(r.URL.Query().Get("numframes"))
-	if err != nil {
-		nFrames = 64 // Ignore bad querystring value, replacing with default
-		log.Println("numframes missing or invalid - settting to default")
+	if crop.Y0 >= crop.Y1 {
+		q.Invalid("py0", "py0 must be less than py1")
+		return engine.PixelRect{}
 	}
-	nWorkers, err := strconv.Atoi(r.URL.Query().Get("numworkers"))
-	if err != nil {
-		nWorkers = 4 // Ignore bad querystring value, replacing with default
-		log.Println("numworkers missing or invalid - settting to default")
+	return crop
+}
+
+// marksParam gets the points to mark on an image from the mark request parameters, written re,im,
+// which may be repeated up to engine.MaxMarks times.
+func marksParam(q *engine.Query) []engine.Mark {
+	zs := q.Complexes("mark")
+	if len(zs) > engine.MaxMarks {
+		q.Invalid("mark", "mark may be given at most %d times", engine.MaxMarks)
+		zs = zs[:engine.MaxMarks]
 	}
+	var marks []engine.Mark
+	for _, z := range zs {
+		marks = append(marks, engine.Mark{Re: real(z), Im: imag(z)})
+	}
+	return marks
+}
+
+// precisionParam gets the precision request parameter, the number of mantissa bits used for
+// deep-zoom renders, clamped to [53, engine.MaxPrecision].  Missing or invalid values are
+// replaced by 53, the float64 default.
+func precisionParam(q *engine.Query) uint {
+	return uint(q.Int("precision", 53, 53, engine.MaxPrecision))
+}
+
+// coeffsParam parses the coeffs request parameter, the comma-separated real coefficients of a
+// polynomial, highest degree first (e.g. "1,0,0,0,-1" for z^4 - 1).  Leading zeros are dropped;
+// the remaining polynomial must have degree between 1 and engine.MaxDegree.
+func coeffsParam(q *engine.Query) ([]float64, error) {
+	var coeffs []float64
+	for _, s := range strings.Split(q.Get("coeffs"), ",") {
+		a, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || math.IsInf(a, 0) || math.IsNaN(a) {
+			return nil, fmt.Errorf("bad coefficient %q", s)
+		}
+		if len(coeffs) == 0 && a == 0 {
+			continue
+		}
+		coeffs = append(coeffs, a)
+	}
+	if degree := len(coeffs) - 1; degree < 1 || degree > engine.MaxDegree {
+		return nil, fmt.Errorf("degree must be between 1 and %d", engine.MaxDegree)
+	}
+	return coeffs, nil
+}
+
+// maxBodyBytes limits the size of request bodies, such as the c values POSTed to /julia.
+const maxBodyBytes = 1 << 20
+
+// cBodyParam gets the c values of a POSTed animation from the body of r, a JSON array of
+// {"re": ..., "im": ...} objects.  A body that cannot be decoded, or holds no values or more than
+// engine.MaxFrames, is recorded as a problem with q.
+func cBodyParam(w http.ResponseWriter, r *http.Request, q *engine.Query) []complex128 {
+	var body []point
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&body); err != nil {
+		q.Fail("body must be a JSON array of {\"re\": ..., \"im\": ...} objects: %v", err)
+		return nil
+	}
+	if len(body) == 0 || len(body) > engine.MaxFrames {
+		q.Fail("body must contain from 1 to %d c values", engine.MaxFrames)
+		return nil
+	}
+	cs := make([]complex128, len(body))
+	for k, p := range body {
+		cs[k] = complex(p.Re, p.Im)
+	}
+	return cs
+}
+
+// basinParams gets the request parameters that color the basins of Newton-like processes into
+// params: the contrast of the shading (default defContrast) and the basin colors.
+func basinParams(q *engine.Query, params *engine.RenderParams, defContrast int) {
+	params.Contrast = q.Int("contrast", defContrast, 0, engine.MaxContrast)
+	if q.Has("colors") {
+		colors, err := colorsParam(q)
+		if err != nil {
+			q.Invalid("colors", "colors invalid: %v", err)
+		} else {
+			params.Colors = colors
+		}
+	}
+}
+
+// colorsParam gets the comma-separated list of hex colors in the colors request parameter,
+// normalized to lower-case rrggbb.
+func colorsParam(q *engine.Query) ([]string, error) {
+	var colors []string
+	for _, s := range strings.Split(q.Get("colors"), ",") {
+		s = strings.TrimSpace(s)
+		if _, err := engine.ParseHexColor(s); err != nil {
+			return nil, err
+		}
+		colors = append(colors, strings.ToLower(strings.TrimPrefix(s, "#")))
+	}
+	return colors, nil
+}
+
+// powerParam gets the exponent request parameter called name, clamped to engine.PowerLimit.
+// The exponent must be greater than 1; missing or invalid values are replaced by def.
+func powerParam(q *engine.Query, name string, def float64) float64 {
+	power := q.Float(name, def, -math.MaxFloat64, engine.PowerLimit)
+	if power <= 1 {
+		q.Invalid(name, "%s must be greater than 1", name)
+		return def
+	}
+	return power
+}
 
-	engine.Julia(nFrames, nWorkers, paramPath, w)
+// workersParam gets the numworkers request parameter, the number of goroutines used to render,
+// up to engine.MaxWorkers.  Missing or invalid values are replaced by the default, 4 (or
+// engine.MaxWorkers, if that is less).
+func workersParam(q *engine.Query) int {
+	return q.Int("numworkers", min(4, engine.MaxWorkers), 1, engine.MaxWorkers)
 }
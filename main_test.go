@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/psteitz/ifs/engine"
+)
+
+func TestMain(m *testing.M) {
+	imageCache = engine.NewCache(0) // as for the command line
+	os.Exit(m.Run())
+}
+
+// The escape radius defaults to the bailout of the map, and 2 itself is accepted.
+func TestRenderParamsEscape(t *testing.T) {
+	tests := []struct {
+		query string
+		want  float64
+		ok    bool
+	}{
+		{"", 2, true},
+		{"map=sin", engine.TranscendentalEscape, true},
+		{"map=exp", engine.TranscendentalEscape, true},
+		{"escape=2", 2, true},
+		{"escape=10", 10, true},
+		{"map=cos&escape=3", 3, true},
+		{"escape=1.99", 1.99, false},
+		{"escape=-1", -1, false},
+	}
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		values.Set("strict", "true")
+		q := engine.NewQuery(values)
+		params := renderParams(q)
+		if ok := q.Err() == nil; params.Escape != tt.want || ok != tt.ok {
+			t.Errorf("%q: escape %v with error %v, want %v, ok %v", tt.query, params.Escape, q.Err(), tt.want, tt.ok)
+		}
+	}
+}
+
+// A deep zoom keeps its window to more digits than float64 holds: the center given, to the
+// width of the window, and edges that float64 would round together.
+func TestBigViewParam(t *testing.T) {
+	parse := func(s string) *big.Float {
+		f, _, err := big.ParseFloat(s, 10, engine.MaxPrecision, big.ToNearestEven)
+		if err != nil {
+			t.Fatalf("parsing %q: %v", s, err)
+		}
+		return f
+	}
+
+	const centerRe, centerIm = "-0.743643887037158704752191506114774", "0.131825904205311970493132056385139"
+	values, _ := url.ParseQuery("centerre=" + centerRe + "&centerim=" + centerIm + "&zoom=1e18")
+	q := engine.NewQuery(values)
+	view, bigView := bigViewParam(q, engine.MandelbrotView, 16, 16)
+	if q.Err() != nil || bigView == (engine.BigViewport{}) {
+		t.Fatalf("got %+v, %+v, error %v, want a big window", view, bigView, q.Err())
+	}
+	for _, c := range []struct{ min, max, center string }{{bigView.XMin, bigView.XMax, centerRe}, {bigView.YMin, bigView.YMax, centerIm}} {
+		min, max := parse(c.min), parse(c.max)
+		mid := new(big.Float).Add(min, max)
+		mid.Quo(mid, big.NewFloat(2))
+		if mid.Cmp(parse(c.center)) != 0 {
+			t.Errorf("window [%s, %s] is centered on %s, want %s", c.min, c.max, mid.Text('g', 40), c.center)
+		}
+		if width, _ := new(big.Float).Sub(max, min).Float64(); math.Abs(width-4e-18) > 1e-30 {
+			t.Errorf("window [%s, %s] is %v wide, want 4e-18", c.min, c.max, width)
+		}
+	}
+
+	values, _ = url.ParseQuery("xmin=0.1&xmax=0.1000000000000000000000001&ymin=-1&ymax=1&strict=true")
+	q = engine.NewQuery(values)
+	view, bigView = bigViewParam(q, engine.MandelbrotView, 16, 16)
+	if q.Err() != nil || view.XMin != 0.1 || view.XMax != 0.1 {
+		t.Fatalf("got %+v, error %v, want xmin and xmax 0.1", view, q.Err())
+	}
+	if parse(bigView.XMax).Cmp(parse("0.1000000000000000000000001")) != 0 || parse(bigView.YMin).Cmp(parse("-1")) != 0 {
+		t.Errorf("big window %+v, want the edges given", bigView)
+	}
+
+	values, _ = url.ParseQuery("xmin=0.5&xmax=0.25")
+	if _, bigView := bigViewParam(engine.NewQuery(values), engine.MandelbrotView, 16, 16); bigView != (engine.BigViewport{}) {
+		t.Errorf("an empty window gives the big window %+v, want none", bigView)
+	}
+}
+
+// format=webp is refused, even outside strict mode, rather than served as PNG.
+func TestFormatWebP(t *testing.T) {
+	for _, tt := range []struct {
+		handler http.HandlerFunc
+		path    string
+	}{{juliaSingle, "/juliaSingle"}, {mandelbrot, "/mandelbrot"}, {newton, "/newton"}} {
+		for format, want := range map[string]int{"webp": http.StatusBadRequest, "jpeg": http.StatusOK, "png": http.StatusOK} {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest("GET", tt.path+"?size=8&format="+format, nil))
+			if rec.Code != want {
+				t.Errorf("%s?format=%s: status %d, want %d", tt.path, format, rec.Code, want)
+			}
+			if ct := rec.Header().Get("Content-Type"); want == http.StatusOK && ct != "image/"+format {
+				t.Errorf("%s?format=%s: Content-Type %q", tt.path, format, ct)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Bucket upper bounds for the render duration (seconds) and response size (bytes) histograms.
+var (
+	durationBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+	sizeBuckets     = []float64{1e3, 1e4, 1e5, 1e6, 1e7, 1e8}
+)
+
+// serverMetrics holds the metrics served by /metrics, in the Prometheus text exposition format.
+// Requests are labeled by the endpoint (the ServeMux pattern) that served them, so that requests
+// for unknown paths cannot create an unbounded number of series.
+var serverMetrics = newMetrics()
+
+// metrics holds the few metrics this server exports: request counts, render durations, response
+// sizes, and renders in flight and queued, in a registry of their own.
+type metrics struct {
+	registry      *prometheus.Registry
+	requests      *prometheus.CounterVec   // by endpoint and status code
+	renderSeconds *prometheus.HistogramVec // by endpoint
+	responseBytes *prometheus.HistogramVec // by endpoint
+	inFlight      prometheus.Gauge         // renders in progress
+	queued        prometheus.Gauge         // requests waiting for a render slot
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ifs_requests_total",
+			Help: "Requests served, by endpoint and status code.",
+		}, []string{"endpoint", "code"}),
+		renderSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ifs_render_duration_seconds",
+			Help:    "Time spent rendering and encoding images, by endpoint.",
+			Buckets: durationBuckets,
+		}, []string{"endpoint"}),
+		responseBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ifs_response_size_bytes",
+			Help:    "Size of response bodies, by endpoint.",
+			Buckets: sizeBuckets,
+		}, []string{"endpoint"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "ifs_renders_in_flight",
+			Help: "Renders in progress.",
+		}),
+		queued: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "ifs_renders_queued",
+			Help: "Requests waiting for a render slot.",
+		}),
+	}
+	m.registry.MustRegister(m.requests, m.renderSeconds, m.responseBytes, m.inFlight, m.queued)
+	return m
+}
+
+// observeRequest records a served request and the size of its response.
+func (m *metrics) observeRequest(endpoint string, status int, bytes int64) {
+	m.requests.WithLabelValues(endpoint, fmt.Sprint(status)).Inc()
+	m.responseBytes.WithLabelValues(endpoint).Observe(float64(bytes))
+}
+
+// observeRender records a render, including encoding, that took d.
+func (m *metrics) observeRender(endpoint string, d time.Duration) {
+	m.renderSeconds.WithLabelValues(endpoint).Observe(d.Seconds())
+}
+
+// handler returns a handler serving the metrics in the Prometheus text exposition format.
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{DisableCompression: true}) // the middleware compresses it
+}
+
+// endpointOf returns the ServeMux pattern that serves r, or "other" for unknown paths (which
+// the "/" pattern of the index page would otherwise match).
+func endpointOf(r *http.Request) string {
+	if _, pattern := http.DefaultServeMux.Handler(r); pattern != "" && (pattern != "/" || r.URL.Path == "/") {
+		return pattern
+	}
+	return "other"
+}
+
+// metricsHandler serves the metrics in the Prometheus text exposition format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	serverMetrics.handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The metrics handler serves every metric, with its observations, in the text exposition format.
+func TestMetricsExposition(t *testing.T) {
+	m := newMetrics()
+	m.observeRequest("/julia", 200, 5000)
+	m.observeRender("/julia", 300*time.Millisecond)
+	m.inFlight.Add(2)
+	m.queued.Add(1)
+
+	rec := httptest.NewRecorder()
+	m.handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type %q, want text/plain", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE ifs_requests_total counter",
+		`ifs_requests_total{code="200",endpoint="/julia"} 1`,
+		"# TYPE ifs_render_duration_seconds histogram",
+		`ifs_render_duration_seconds_bucket{endpoint="/julia",le="0.25"} 0`,
+		`ifs_render_duration_seconds_bucket{endpoint="/julia",le="0.5"} 1`,
+		`ifs_render_duration_seconds_count{endpoint="/julia"} 1`,
+		"# TYPE ifs_response_size_bytes histogram",
+		`ifs_response_size_bytes_bucket{endpoint="/julia",le="10000"} 1`,
+		`ifs_response_size_bytes_sum{endpoint="/julia"} 5000`,
+		"# TYPE ifs_renders_in_flight gauge",
+		"ifs_renders_in_flight 2",
+		"# TYPE ifs_renders_queued gauge",
+		"ifs_renders_queued 1",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/psteitz/ifs/engine"
+)
+
+// requestLog collects what the handler of a request learns about it, for the request's log entry.
+type requestLog struct {
+	params []any         // slog attributes describing the resolved request parameters
+	render time.Duration // time spent rendering, excluding encoding
+	encode time.Duration // time spent encoding images
+}
+
+// requestLogKey is the context key of the *requestLog of a request.
+type requestLogKey struct{}
+
+// requestLogOf returns the requestLog of r, or nil if r did not come through logRequests.
+func requestLogOf(r *http.Request) *requestLog {
+	rl, _ := r.Context().Value(requestLogKey{}).(*requestLog)
+	return rl
+}
+
+// logParams records the resolved parameters of r, given as alternating keys and values as for
+// slog.Info, for its log entry.
+func logParams(r *http.Request, args ...any) {
+	if rl := requestLogOf(r); rl != nil {
+		rl.params = append(rl.params, args...)
+	}
+}
+
+// timeRender calls render, which renders (and encodes) the response to r, recording its
+// duration for the request log and metrics and counting it as in flight while it runs.
+// The render waits for a slot from limiter first; if none frees up in time, timeRender sends a
+// 503 response to w instead and returns false.
+func timeRender(w http.ResponseWriter, r *http.Request, render func()) bool {
+	if !limiter.acquire(r) {
+		limiter.tooBusy(w)
+		return false
+	}
+	defer limiter.release()
+	serverMetrics.inFlight.Inc()
+	defer serverMetrics.inFlight.Dec() // even if render panics
+	start := time.Now()
+	render()
+	total := time.Since(start)
+	serverMetrics.observeRender(endpointOf(r), total)
+	if rl := requestLogOf(r); rl != nil {
+		rl.render = total - rl.encode
+	}
+	return true
+}
+
+// logRequests wraps h so that every request is logged with log/slog once it has been served,
+// with its method, path, status, response size and duration, and the resolved parameters and
+// render and encode times reported by the handler.  The request is also counted in serverMetrics.
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rl := &requestLog{}
+		lw := &loggingWriter{ResponseWriter: w, status: http.StatusOK, log: rl}
+		h.ServeHTTP(lw, r.WithContext(context.WithValue(r.Context(), requestLogKey{}, rl)))
+
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", lw.status,
+			"bytes", lw.bytes,
+			"duration", time.Since(start),
+		}
+		if rl.render > 0 {
+			attrs = append(attrs, "render", rl.render)
+		}
+		if rl.encode > 0 {
+			attrs = append(attrs, "encode", rl.encode)
+		}
+		slog.Info("request", append(attrs, rl.params...)...)
+		serverMetrics.observeRequest(endpointOf(r), lw.status, lw.bytes)
+	})
+}
+
+// loggingWriter is an http.ResponseWriter that records the status and size of the response, and
+// the time spent encoding images written to it, for logRequests.
+type loggingWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	log    *requestLog
+}
+
+func (lw *loggingWriter) WriteHeader(status int) {
+	lw.status = status
+	lw.ResponseWriter.WriteHeader(status)
+}
+
+func (lw *loggingWriter) Write(p []byte) (int, error) {
+	n, err := lw.ResponseWriter.Write(p)
+	lw.bytes += int64(n)
+	return n, err
+}
+
+// Flush flushes the underlying writer, if it can be flushed, so that streamed animations
+// still reach the client frame by frame.
+func (lw *loggingWriter) Flush() {
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (lw *loggingWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// ObserveEncode implements engine.EncodeObserver.
+func (lw *loggingWriter) ObserveEncode(d time.Duration) {
+	lw.log.encode += d
+}
+
+// imageBuffer is the buffer still images are rendered into before they are cached and served.
+// It records the time spent encoding them in the requestLog of the request, if any.
+type imageBuffer struct {
+	bytes.Buffer
+	log *requestLog
+}
+
+// ObserveEncode implements engine.EncodeObserver.
+func (b *imageBuffer) ObserveEncode(d time.Duration) {
+	if b.log != nil {
+		b.log.encode += d
+	}
+}
+
+// compressResponses wraps h so that responses are compressed with gzip or deflate when the
+// request's Accept-Encoding allows it, except for images, which are compressed already, and
+// event streams, which must reach the client as they are written.
+func compressResponses(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &compressWriter{ResponseWriter: w, encoding: acceptedEncoding(r)}
+		defer cw.close()
+		h.ServeHTTP(cw, r)
+	})
+}
+
+// acceptedEncoding returns the content encoding to compress the response to r with: gzip or
+// deflate if its Accept-Encoding header accepts them, in that order of preference, or "" for none.
+func acceptedEncoding(r *http.Request) string {
+	if r.Method == http.MethodHead {
+		return ""
+	}
+	accepted := map[string]bool{}
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(coding, ";")
+			q := 1.0
+			if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+			accepted[strings.ToLower(strings.TrimSpace(name))] = q > 0
+		}
+	}
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if accepted[encoding] {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// compressWriter is the http.ResponseWriter of compressResponses.  It decides whether to compress
+// the response from its Content-Type when the header is written.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string     // accepted encoding, or "" if the response may not be compressed
+	started  bool       // whether the header has been written
+	enc      compressor // compressor of the body, or nil if it is not compressed
+}
+
+// A compressor is a gzip.Writer or zlib.Writer.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressible reports whether responses of the given Content-Type are worth compressing.
+func compressible(contentType string) bool {
+	return !strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "text/event-stream")
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.started {
+		return
+	}
+	cw.started = true
+	h := cw.Header()
+	if compressible(h.Get("Content-Type")) {
+		h.Add("Vary", "Accept-Encoding")
+		if cw.encoding != "" && h.Get("Content-Encoding") == "" && status != http.StatusNoContent && status != http.StatusNotModified {
+			h.Set("Content-Encoding", cw.encoding)
+			h.Del("Content-Length")
+			if cw.encoding == "gzip" {
+				cw.enc = gzip.NewWriter(cw.ResponseWriter)
+			} else {
+				cw.enc = zlib.NewWriter(cw.ResponseWriter)
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.started {
+		if cw.Header().Get("Content-Type") == "" { // as net/http would, before it is compressed
+			cw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush flushes the compressor and then the underlying writer, if it can be flushed.
+func (cw *compressWriter) Flush() {
+	if !cw.started {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// ObserveEncode implements engine.EncodeObserver by passing the observation on.
+func (cw *compressWriter) ObserveEncode(d time.Duration) {
+	if o, ok := cw.ResponseWriter.(engine.EncodeObserver); ok {
+		o.ObserveEncode(d)
+	}
+}
+
+// close finishes the compressed body, if any.
+func (cw *compressWriter) close() {
+	if cw.enc != nil {
+		cw.enc.Close()
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// A render that panics must still leave the in-flight gauge and the render slot as it found them.
+func TestTimeRenderPanicReleases(t *testing.T) {
+	before := testutil.ToFloat64(serverMetrics.inFlight)
+	r := httptest.NewRequest("GET", "/julia", nil)
+	func() {
+		defer func() { recover() }()
+		timeRender(httptest.NewRecorder(), r, func() { panic("render failed") })
+	}()
+	if got := testutil.ToFloat64(serverMetrics.inFlight); got != before {
+		t.Errorf("%v renders in flight after a panic, want %v", got, before)
+	}
+	if n := len(limiter.slots); n != 0 {
+		t.Errorf("%d render slots still taken after a panic", n)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/psteitz/ifs/engine"
+)
+
+const (
+	maxProgressID = 64 // Longest accepted progress id
+	// progressWait is how long /julia/progress waits for an animation with its id to start
+	// before giving up.
+	progressWait = 30 * time.Second
+)
+
+// progress is the progress of one animation render, shared between the /julia request
+// rendering it and the /julia/progress requests following it.
+type progress struct {
+	done, total int
+	started     bool          // whether the render has started
+	finished    bool          // whether the render has finished, successfully or not
+	changed     chan struct{} // closed, and replaced, whenever the fields above change
+	refs        int           // requests using the progress; it is dropped when none are left
+}
+
+// progressReport is the JSON form of a progress event.
+type progressReport struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// progressTracker holds the progress of the animations being rendered or followed, by the id
+// the client gave them.
+type progressTracker struct {
+	mu   sync.Mutex
+	byID map[string]*progress
+}
+
+var renderProgress = &progressTracker{byID: map[string]*progress{}}
+
+// join returns the progress for id, creating it if neither a render nor a follower has yet,
+// and counts the caller as a user of it until it calls leave.
+func (t *progressTracker) join(id string) *progress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.byID[id]
+	if !ok {
+		p = &progress{changed: make(chan struct{})}
+		t.byID[id] = p
+	}
+	p.refs++
+	return p
+}
+
+// leave undoes a join, dropping the progress for id once nothing uses it.
+func (t *progressTracker) leave(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p := t.byID[id]; p != nil {
+		if p.refs--; p.refs == 0 {
+			delete(t.byID, id)
+		}
+	}
+}
+
+// update applies f to p under the tracker's lock and wakes up p's followers.
+func (t *progressTracker) update(p *progress, f func(*progress)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f(p)
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// snapshot returns a copy of p, taken under the tracker's lock, and the channel that will be
+// closed when p next changes.
+func (t *progressTracker) snapshot(p *progress) (progress, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return *p, p.changed
+}
+
+// progressWriter is the writer an animation is rendered to when its progress is followed.  It
+// passes the animation on to the client and reports rendered frames to the progress.
+type progressWriter struct {
+	http.ResponseWriter
+	p *progress
+}
+
+// ObserveProgress implements engine.ProgressObserver.
+func (pw *progressWriter) ObserveProgress(done, total int) {
+	renderProgress.update(pw.p, func(p *progress) {
+		p.started, p.done, p.total = true, done, total
+	})
+}
+
+// Flush flushes the underlying writer, if it can be flushed, so that the animation still
+// reaches the client frame by frame.
+func (pw *progressWriter) Flush() {
+	if f, ok := pw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ObserveEncode implements engine.EncodeObserver by passing the observation on.
+func (pw *progressWriter) ObserveEncode(d time.Duration) {
+	if o, ok := pw.ResponseWriter.(engine.EncodeObserver); ok {
+		o.ObserveEncode(d)
+	}
+}
+
+// followProgress returns the writer to render an animation of total frames to: w itself, or, if
+// id is not empty, a progressWriter wrapping it that reports progress under id.  The returned
+// function must be called once the render is over.
+func followProgress(w http.ResponseWriter, id string, total int) (io.Writer, func()) {
+	if id == "" {
+		return w, func() {}
+	}
+	p := renderProgress.join(id)
+	renderProgress.update(p, func(p *progress) {
+		p.started, p.finished, p.done, p.total = true, false, 0, total
+	})
+	return &progressWriter{w, p}, func() {
+		renderProgress.update(p, func(p *progress) { p.finished = true })
+		renderProgress.leave(id)
+	}
+}
+
+// juliaProgress streams the progress of the /julia animation requested with progress=id as
+// Server-Sent Events: a progress event each time a frame is rendered, and a done event when the
+// render is over, each with the JSON data {"done": frames rendered, "total": frames}.  It can
+// be requested before or after the animation; if no animation with the id starts within
+// progressWait, it sends a done event with no frames rendered.  The stream ends after the done
+// event, or when the client disconnects.
+func juliaProgress(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" || len(id) > maxProgressID {
+		http.Error(w, fmt.Sprintf("id must be 1 to %d characters", maxProgressID), http.StatusBadRequest)
+		return
+	}
+	logParams(r, "id", id)
+	p := renderProgress.join(id)
+	defer renderProgress.leave(id)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	wait := time.NewTimer(progressWait)
+	defer wait.Stop()
+	sent := -1 // frames rendered when the last progress event was sent
+	for {
+		state, changed := renderProgress.snapshot(p)
+		if state.finished {
+			sendEvent(w, "done", progressReport{state.done, state.total})
+			rc.Flush()
+			return
+		}
+		if state.started && state.done != sent {
+			sendEvent(w, "progress", progressReport{state.done, state.total})
+			if err := rc.Flush(); err != nil {
+				log.Println("Error sending progress:", err)
+				return
+			}
+			sent = state.done
+		}
+		select {
+		case <-changed:
+		case <-wait.C:
+			if !state.started {
+				sendEvent(w, "done", progressReport{0, 0})
+				rc.Flush()
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// sendEvent writes a Server-Sent Event of the given type with v, as JSON, as its data.
+func sendEvent(w io.Writer, event string, v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clientLimiter limits the rate of requests from each client with a token bucket per client IP:
+// each request takes a token, a client's bucket refills at rate tokens a second up to burst,
+// and requests that find it empty are turned away.  Buckets that have refilled are forgotten
+// from time to time, so that one-off clients do not pile up.
+type clientLimiter struct {
+	rate       float64 // tokens added to a bucket per second
+	burst      float64 // capacity of a bucket
+	trustProxy bool    // whether to take the client IP from X-Forwarded-For (see clientIP)
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// tokenBucket holds the tokens left to a client as of last.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter limits the requests of each client to the endpoints that render; nil, the
+// default, lets every request through.  main sets it from -ratelimit.
+var rateLimiter *clientLimiter
+
+func newClientLimiter(rate float64, burst int, trustProxy bool) *clientLimiter {
+	return &clientLimiter{rate: rate, burst: float64(max(1, burst)), trustProxy: trustProxy, buckets: map[string]*tokenBucket{}}
+}
+
+// allow takes a token from the bucket of client at now and reports whether there was one.  If
+// not, wait is how long until there will be.
+func (l *clientLimiter) allow(client string, now time.Time) (ok bool, wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > time.Minute {
+		l.sweep(now)
+	}
+	b := l.buckets[client]
+	if b == nil {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep forgets the buckets that are full by now, which are as good as new.
+func (l *clientLimiter) sweep(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// clientIP returns the IP address of the client of r.  Behind a proxy, every request comes from
+// the proxy, so with trustProxy set it is the last address of the X-Forwarded-For header, the one
+// the proxy added; the ones before it are whatever the client sent, and can be forged.
+func (l *clientLimiter) clientIP(r *http.Request) string {
+	if l.trustProxy {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			hops := strings.Split(fwd[len(fwd)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimited wraps h, the handler of an endpoint that renders, so that requests from clients
+// over their rate get a 429 response with a Retry-After header instead.  It returns h itself if
+// rateLimiter is nil.
+func rateLimited(h http.HandlerFunc) http.HandlerFunc {
+	l := rateLimiter
+	if l == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := l.allow(l.clientIP(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "too many requests, slow down", http.StatusTooManyRequests)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// WebSocket opcodes (RFC 6455, section 5.2).
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+const (
+	// wsGUID is appended to the client's key to compute the Sec-WebSocket-Accept header.
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// maxWSMessage is the largest message accepted from a client.  Clients of the explorer
+	// only send short query strings.
+	maxWSMessage = 64 << 10
+	// wsProtocolError is the close status code for frames that break the protocol (RFC 6455,
+	// section 7.4.1).
+	wsProtocolError = 1002
+)
+
+var (
+	// errMessageTooLarge is returned by readMessage for messages over maxWSMessage.
+	errMessageTooLarge = errors.New("websocket message too large")
+	// errUnmaskedFrame is returned by readMessage for frames the client did not mask, which
+	// RFC 6455 requires of every client frame.
+	errUnmaskedFrame = errors.New("unmasked websocket frame from the client")
+)
+
+// allowedOrigins holds the origins, such as "https://example.com", other than the server's own
+// whose pages may open WebSocket connections, from the allowedOrigins setting of the config file.
+var allowedOrigins []string
+
+// wsConn is the server end of a WebSocket connection: just enough of RFC 6455 for the explorer,
+// which reads text messages and writes text and binary ones.  One goroutine may read while
+// others write.
+type wsConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+	wmu  sync.Mutex // serializes writes, including the pongs and close sent by readMessage
+}
+
+// upgradeWebSocket completes the WebSocket opening handshake for r and takes over its
+// connection.  If r is not a valid WebSocket handshake, it sends a 400 response and returns
+// an error; if it comes from a page of an origin that is not allowed (see checkOrigin), a 403.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		http.Error(w, "expected a WebSocket (version 13) handshake", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+	if !checkOrigin(r) {
+		http.Error(w, "websocket connections from this origin are not allowed", http.StatusForbidden)
+		return nil, fmt.Errorf("websocket handshake from origin %q", r.Header.Get("Origin"))
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "cannot upgrade the connection", http.StatusInternalServerError)
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + wsGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, rw: rw}, nil
+}
+
+// checkOrigin reports whether r may open a WebSocket connection.  Browsers send the Origin of the
+// page opening the connection, and let any page open one, with the user's cookies and from
+// inside the user's network, so connections are only accepted from pages of the server itself,
+// whose host matches that of r, or of allowedOrigins.  Requests without an Origin do not come
+// from browsers, and are accepted.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range allowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerContains reports whether the comma-separated header name of h contains token, ignoring case.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readMessage returns the next data message from the client, with its opcode, reassembling
+// fragmented messages.  It answers pings itself, and returns io.EOF once the client closes the
+// connection, after echoing the close.  A frame the client did not mask is answered with a close
+// of status 1002 (protocol error), and errUnmaskedFrame returned.
+func (c *wsConn) readMessage() (int, []byte, error) {
+	var (
+		opcode  int
+		message []byte
+	)
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err == errUnmaskedFrame {
+			c.writeMessage(wsClose, binary.BigEndian.AppendUint16(nil, wsProtocolError))
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case wsPing:
+			if err := c.writeMessage(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.writeMessage(wsClose, payload)
+			return 0, nil, io.EOF
+		case wsContinuation:
+		default:
+			opcode, message = op, nil
+		}
+		if len(message)+len(payload) > maxWSMessage {
+			return 0, nil, errMessageTooLarge
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// readFrame reads one frame, unmasking its payload.  It returns errUnmaskedFrame, without
+// reading the rest of the frame, if the frame is not masked.
+func (c *wsConn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.rw, head[:]); err != nil {
+		return
+	}
+	fin, opcode = head[0]&0x80 != 0, int(head[0]&0x0f)
+	if head[1]&0x80 == 0 {
+		err = errUnmaskedFrame
+		return
+	}
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.rw, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.rw, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxWSMessage {
+		err = errMessageTooLarge
+		return
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.rw, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.rw, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// writeMessage sends data to the client as a single, unmasked frame with the given opcode.
+func (c *wsConn) writeMessage(opcode int, data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	head := []byte{0x80 | byte(opcode)}
+	switch n := len(data); {
+	case n < 126:
+		head = append(head, byte(n))
+	case n <= 0xffff:
+		head = append(head, 126)
+		head = binary.BigEndian.AppendUint16(head, uint16(n))
+	default:
+		head = append(head, 127)
+		head = binary.BigEndian.AppendUint64(head, uint64(n))
+	}
+	if _, err := c.rw.Write(head); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(data); err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
+
+// Close closes the connection without a closing handshake.
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
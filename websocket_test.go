@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// readServerFrame reads a frame sent by the server, which does not mask its frames, as a client
+// would, returning its opcode and payload.
+func readServerFrame(r *bufio.Reader) (int, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, n)
+	_, err := io.ReadFull(r, payload)
+	return int(head[0] & 0x0f), payload, err
+}
+
+// Browsers may only open connections from pages of the server itself or of allowedOrigins;
+// other clients send no Origin.
+func TestCheckOrigin(t *testing.T) {
+	defer func() { allowedOrigins = nil }()
+	allowedOrigins = []string{"https://explorer.example.com/"}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"http://ifs.example.com:8000", true},
+		{"https://IFS.example.com:8000", true},
+		{"https://explorer.example.com", true},
+		{"https://evil.example.com", false},
+		{"http://ifs.example.com", false}, // another port is another origin
+		{"null", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "http://ifs.example.com:8000/explore", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := checkOrigin(r); got != tt.want {
+			t.Errorf("checkOrigin(Origin %q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "http://ifs.example.com:8000/explore", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	r.Header.Set("Origin", "https://evil.example.com")
+	rec := httptest.NewRecorder()
+	if _, err := upgradeWebSocket(rec, r); err == nil || rec.Code != http.StatusForbidden {
+		t.Errorf("handshake from another origin: status %d, error %v, want 403", rec.Code, err)
+	}
+}
+
+// A frame the client did not mask is answered with a close of status 1002.
+func TestUnmaskedFrameCloses(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	ws := &wsConn{conn: server, rw: bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server))}
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := ws.readMessage()
+		errc <- err
+	}()
+
+	if _, err := client.Write([]byte{0x80 | wsText, 2, 'h', 'i'}); err != nil {
+		t.Fatal(err)
+	}
+	opcode, payload, err := readServerFrame(bufio.NewReader(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opcode != wsClose || len(payload) < 2 || binary.BigEndian.Uint16(payload) != wsProtocolError {
+		t.Errorf("got opcode %d, payload %v, want a close with status %d", opcode, payload, wsProtocolError)
+	}
+	if err := <-errc; err != errUnmaskedFrame {
+		t.Errorf("readMessage returned %v, want %v", err, errUnmaskedFrame)
+	}
+}